@@ -0,0 +1,508 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 管理员命令：/users 用户列表，/broadcast 群发通知，/ban /unban 封禁和解封，
+// /feeds 订阅源状态，/aistats AI使用统计
+// 用户最近活跃时间在收到消息或按钮点击时记录，订阅源状态在每轮检查时记录
+
+const (
+	activityThrottle       = time.Minute           // 同一用户活跃时间的最小记录间隔
+	broadcastInterval      = 50 * time.Millisecond // 群发消息间隔，约每秒20条
+	broadcastProgressEvery = 3 * time.Second       // 群发进度的刷新间隔
+	broadcastActiveDays    = 30                    // 群发对象：最近活跃天数
+	feedFailureWarnCount   = 3                     // 连续失败达到该次数时标记为异常
+	defaultAIStatsDays     = 7                     // /aistats 默认统计天数
+	maxAIStatsDays         = 90                    // /aistats 最多统计天数
+)
+
+var (
+	activitySeen     = make(map[int64]time.Time) // 用户ID -> 最近一次记录活跃的时间
+	activityMutex    sync.Mutex
+	pendingBroadcast = make(map[int64]string) // 管理员ID -> 等待确认的群发内容
+	broadcastRunning bool
+	broadcastMutex   sync.Mutex
+)
+
+// recordUserActivity 记录用户最近活跃时间，同一用户每分钟最多写入一次
+func recordUserActivity(user *tgbotapi.User) {
+	if user == nil || user.IsBot {
+		return
+	}
+	now := time.Now()
+	activityMutex.Lock()
+	last, ok := activitySeen[user.ID]
+	if ok && now.Sub(last) < activityThrottle {
+		activityMutex.Unlock()
+		return
+	}
+	activitySeen[user.ID] = now
+	activityMutex.Unlock()
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO user_activity (user_id, username, name, last_active_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(user_id) DO UPDATE SET
+				username = excluded.username, name = excluded.name, last_active_at = CURRENT_TIMESTAMP`,
+			user.ID, user.UserName, name)
+		return err
+	})
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("记录用户活跃时间失败: %v", err), user.ID)
+	}
+}
+
+// UserSummary 管理员查看的用户概况
+type UserSummary struct {
+	UserID            int64
+	Username          string
+	Name              string
+	Role              string
+	SubscriptionCount int
+	KeywordCount      int
+	LastActive        string // UTC，空表示没有记录
+}
+
+// label 显示名称
+func (u *UserSummary) label() string {
+	switch {
+	case isGroupID(u.UserID):
+		return "群组"
+	case u.Username != "":
+		return "@" + u.Username
+	case u.Name != "":
+		return u.Name
+	}
+	return "-"
+}
+
+// getUserSummaries 汇总所有出现过的用户，按最近活跃时间倒序
+func getUserSummaries() ([]*UserSummary, error) {
+	users := make(map[int64]*UserSummary)
+	get := func(userID int64) *UserSummary {
+		if users[userID] == nil {
+			users[userID] = &UserSummary{UserID: userID}
+		}
+		return users[userID]
+	}
+
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT users FROM subscriptions")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var usersStr string
+			if err := rows.Scan(&usersStr); err != nil {
+				rows.Close()
+				return err
+			}
+			for _, userID := range parseUserIDs(usersStr) {
+				get(userID).SubscriptionCount++
+			}
+		}
+		rows.Close()
+
+		rows, err = db.Query("SELECT user_id, keywords FROM user_keywords")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var userID int64
+			var keywordsStr string
+			if err := rows.Scan(&userID, &keywordsStr); err != nil {
+				rows.Close()
+				return err
+			}
+			var keywords []string
+			if json.Unmarshal([]byte(keywordsStr), &keywords) == nil && len(keywords) > 0 {
+				get(userID).KeywordCount = len(keywords)
+			}
+		}
+		rows.Close()
+
+		rows, err = db.Query("SELECT user_id, role FROM user_roles")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var userID int64
+			var role string
+			if err := rows.Scan(&userID, &role); err != nil {
+				rows.Close()
+				return err
+			}
+			if role != RoleNone {
+				get(userID).Role = role
+			}
+		}
+		rows.Close()
+
+		rows, err = db.Query("SELECT user_id, username, name, last_active_at FROM user_activity")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var userID int64
+			var username, name, lastActive string
+			if err := rows.Scan(&userID, &username, &name, &lastActive); err != nil {
+				return err
+			}
+			user := get(userID)
+			user.Username, user.Name, user.LastActive = username, name, lastActive
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*UserSummary, 0, len(users))
+	for _, user := range users {
+		summaries = append(summaries, user)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].LastActive != summaries[j].LastActive {
+			return summaries[i].LastActive > summaries[j].LastActive
+		}
+		return summaries[i].UserID < summaries[j].UserID
+	})
+	return summaries, nil
+}
+
+// handleUsersCommand 处理 /users 命令，列出用户及其订阅数、关键词数和最近活跃时间
+func handleUsersCommand(userID int64) {
+	summaries, err := getUserSummaries()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户列表失败: %v", err), userID)
+		sendMessage(userID, "获取用户列表失败，请稍后重试")
+		return
+	}
+	if len(summaries) == 0 {
+		sendMessage(userID, "👥 暂无用户")
+		return
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("👥 共 %d 个用户", len(summaries)), "")
+	for _, user := range summaries {
+		lastActive := "无记录"
+		if user.LastActive != "" {
+			lastActive = formatFeedUpdateTime(userID, user.LastActive)
+		}
+		lines = append(lines, fmt.Sprintf("%d %s [%s]\n  📰 %d  🔍 %d  🕒 %s",
+			user.UserID, user.label(), roleNames[effectiveRole(user.Role)],
+			user.SubscriptionCount, user.KeywordCount, lastActive))
+	}
+	messageSender.HandleLongText(userID, 0, strings.Join(lines, "\n"), false)
+}
+
+// handleBanCommand 处理 /ban 和 /unban 命令，解封后恢复为普通用户
+func handleBanCommand(userID, operatorID int64, args string, ban bool) {
+	command, newRole := "unban", RoleUser
+	if ban {
+		command, newRole = "ban", RoleBanned
+	}
+	targetID, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		sendMessage(userID, fmt.Sprintf("❌ 用法：/%s <用户ID>", command))
+		return
+	}
+
+	targetRole := getUserRole(targetID)
+	if !ban && targetRole != RoleBanned {
+		sendMessage(userID, fmt.Sprintf("用户 %d 未被封禁", targetID))
+		return
+	}
+	if !canAssignRole(getUserRole(operatorID), targetRole, newRole) {
+		sendMessage(userID, "❌ 你不能修改该用户的权限")
+		return
+	}
+	if err := setUserRole(targetID, newRole, operatorID); err != nil {
+		logMessage("error", fmt.Sprintf("设置用户角色失败: %v", err), operatorID)
+		sendMessage(userID, "设置失败，请稍后重试")
+		return
+	}
+
+	logMessage("info", fmt.Sprintf("将用户 %d 的角色设为 %s", targetID, roleNames[newRole]), operatorID)
+	if ban {
+		sendMessage(userID, fmt.Sprintf("🚫 已封禁用户 %d，该用户将不能使用 Bot，也不再收到推送", targetID))
+	} else {
+		sendMessage(userID, fmt.Sprintf("✅ 已解封用户 %d", targetID))
+	}
+}
+
+// getBroadcastRecipients 群发对象：最近活跃或有订阅、关键词且可以使用 Bot 的私聊用户
+func getBroadcastRecipients() ([]int64, error) {
+	summaries, err := getUserSummaries()
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().UTC().AddDate(0, 0, -broadcastActiveDays).Format(inviteTimeLayout)
+
+	var recipients []int64
+	for _, user := range summaries {
+		if isGroupID(user.UserID) || !hasRole(effectiveRole(user.Role), RoleUser) {
+			continue
+		}
+		if user.SubscriptionCount == 0 && user.KeywordCount == 0 && user.LastActive < since {
+			continue
+		}
+		recipients = append(recipients, user.UserID)
+	}
+	return recipients, nil
+}
+
+// handleBroadcastCommand 处理 /broadcast 命令，预览内容并等待确认
+func handleBroadcastCommand(userID, operatorID int64, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		sendMessage(userID, "❌ 用法：/broadcast <通知内容>")
+		return
+	}
+	recipients, err := getBroadcastRecipients()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取群发对象失败: %v", err), operatorID)
+		sendMessage(userID, "获取群发对象失败，请稍后重试")
+		return
+	}
+
+	broadcastMutex.Lock()
+	pendingBroadcast[operatorID] = text
+	broadcastMutex.Unlock()
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 发送", "bc_send"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "bc_cancel"),
+		),
+	)
+	preview := fmt.Sprintf("📣 将向 %d 个用户发送以下通知：\n\n%s", len(recipients), text)
+	messageSender.SendResponse(userID, 0, preview, &keyboard)
+}
+
+// handleBroadcastCallback 处理群发确认按钮
+func handleBroadcastCallback(userID int64, messageID int, operatorID int64, action string) {
+	broadcastMutex.Lock()
+	text, ok := pendingBroadcast[operatorID]
+	delete(pendingBroadcast, operatorID)
+	running := broadcastRunning
+	if ok && action == "send" && !running {
+		broadcastRunning = true
+	}
+	broadcastMutex.Unlock()
+
+	switch {
+	case !ok:
+		messageSender.SendResponse(userID, messageID, "该群发已失效，请重新使用 /broadcast", nil)
+	case action != "send":
+		messageSender.SendResponse(userID, messageID, "已取消群发", nil)
+	case running:
+		messageSender.SendResponse(userID, messageID, "❌ 已有群发正在进行，请稍后再试", nil)
+	default:
+		go runBroadcast(userID, messageID, operatorID, text)
+	}
+}
+
+// runBroadcast 按固定间隔逐个发送通知，并定时刷新进度
+func runBroadcast(userID int64, messageID int, operatorID int64, text string) {
+	defer func() {
+		broadcastMutex.Lock()
+		broadcastRunning = false
+		broadcastMutex.Unlock()
+	}()
+
+	recipients, err := getBroadcastRecipients()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取群发对象失败: %v", err), operatorID)
+		messageSender.SendResponse(userID, messageID, "获取群发对象失败，请稍后重试", nil)
+		return
+	}
+	logMessage("info", fmt.Sprintf("开始群发通知，共 %d 个用户", len(recipients)), operatorID)
+
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+	sent, failed := 0, 0
+	lastProgress := time.Now()
+	for i, recipient := range recipients {
+		<-ticker.C
+		if err := sendBroadcastMessage(recipient, text); err != nil {
+			failed++
+			logMessage("debug", fmt.Sprintf("群发通知失败: %v", err), recipient)
+		} else {
+			sent++
+		}
+		if time.Since(lastProgress) >= broadcastProgressEvery && i < len(recipients)-1 {
+			lastProgress = time.Now()
+			messageSender.SendResponse(userID, messageID,
+				fmt.Sprintf("📣 正在群发… %d/%d（成功 %d，失败 %d）", i+1, len(recipients), sent, failed), nil)
+		}
+	}
+
+	logMessage("info", fmt.Sprintf("群发通知完成，成功 %d，失败 %d", sent, failed), operatorID)
+	messageSender.SendResponse(userID, messageID,
+		fmt.Sprintf("✅ 群发完成，共 %d 个用户，成功 %d，失败 %d", len(recipients), sent, failed), nil)
+}
+
+// sendBroadcastMessage 发送一条群发通知，触发频率限制时按要求等待后重试一次
+func sendBroadcastMessage(chatID int64, text string) error {
+	msg := tgbotapi.NewMessage(chatID, "📣 "+text)
+	_, err := bot.Send(msg)
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+		_, err = bot.Send(msg)
+	}
+	return err
+}
+
+// recordFeedCheck 记录订阅源的检查结果，连续失败次数用于判断订阅源是否异常
+func recordFeedCheck(db *sql.DB, rssName string, checkErr error) {
+	var err error
+	if checkErr == nil {
+		_, err = db.Exec("UPDATE feed_data SET last_check_at = CURRENT_TIMESTAMP, last_error = '', fail_count = 0 WHERE rss_name = ?",
+			rssName)
+	} else {
+		_, err = db.Exec("UPDATE feed_data SET last_check_at = CURRENT_TIMESTAMP, last_error = ?, fail_count = fail_count + 1 WHERE rss_name = ?",
+			checkErr.Error(), rssName)
+	}
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("记录订阅源状态失败 %s: %v", rssName, err))
+	}
+}
+
+// FeedStatus 订阅源状态
+type FeedStatus struct {
+	Name        string
+	URL         string
+	Subscribers int
+	LastUpdate  string // 最近一条内容的时间
+	LastCheck   string // 最近一次检查时间（UTC）
+	LastError   string
+	FailCount   int
+}
+
+// getFeedStatuses 获取所有订阅源的订阅人数和检查状态，异常的排在前面
+func getFeedStatuses() ([]FeedStatus, error) {
+	var feeds []FeedStatus
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT s.rss_name, s.rss_url, s.users, COALESCE(f.last_update_time, ''), COALESCE(f.last_check_at, ''),
+				COALESCE(f.last_error, ''), COALESCE(f.fail_count, 0)
+			FROM subscriptions s LEFT JOIN feed_data f ON f.rss_name = s.rss_name`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var feed FeedStatus
+			var usersStr string
+			if err := rows.Scan(&feed.Name, &feed.URL, &usersStr, &feed.LastUpdate, &feed.LastCheck,
+				&feed.LastError, &feed.FailCount); err != nil {
+				return err
+			}
+			feed.Subscribers = len(parseUserIDs(usersStr))
+			feeds = append(feeds, feed)
+		}
+		return rows.Err()
+	})
+	sort.SliceStable(feeds, func(i, j int) bool {
+		if feeds[i].FailCount != feeds[j].FailCount {
+			return feeds[i].FailCount > feeds[j].FailCount
+		}
+		return feeds[i].Subscribers > feeds[j].Subscribers
+	})
+	return feeds, err
+}
+
+// handleFeedsCommand 处理 /feeds 命令，显示所有订阅源的订阅人数和状态
+func handleFeedsCommand(userID int64) {
+	feeds, err := getFeedStatuses()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取订阅源状态失败: %v", err), userID)
+		sendMessage(userID, "获取订阅源状态失败，请稍后重试")
+		return
+	}
+	if len(feeds) == 0 {
+		sendMessage(userID, "📰 暂无订阅")
+		return
+	}
+
+	failing := 0
+	var blocks []string
+	for _, feed := range feeds {
+		status := "✅"
+		switch {
+		case feed.LastCheck == "":
+			status = "⏳"
+		case feed.FailCount >= feedFailureWarnCount:
+			status = "❌"
+			failing++
+		case feed.FailCount > 0:
+			status = "⚠️"
+		}
+		block := fmt.Sprintf("%s %s（%d 人订阅）\n  %s", status, feed.Name, feed.Subscribers, feed.URL)
+		if feed.LastUpdate != "" {
+			block += "\n  📄 最近更新：" + formatFeedUpdateTime(userID, feed.LastUpdate)
+		}
+		if feed.LastCheck != "" {
+			block += "\n  🕒 最近检查：" + formatFeedUpdateTime(userID, feed.LastCheck)
+		}
+		if feed.FailCount > 0 {
+			block += fmt.Sprintf("\n  连续失败 %d 次：%s", feed.FailCount, feed.LastError)
+		}
+		blocks = append(blocks, block)
+	}
+
+	header := fmt.Sprintf("📰 共 %d 个订阅源，%d 个异常\n✅ 正常 ⚠️ 最近失败 ❌ 连续失败 %d 次以上 ⏳ 尚未检查",
+		len(feeds), failing, feedFailureWarnCount)
+	messageSender.HandleLongText(userID, 0, header+"\n\n"+strings.Join(blocks, "\n\n"), false)
+}
+
+// handleAIStatsCommand 处理 /aistats 命令，显示最近几天的AI使用统计
+func handleAIStatsCommand(userID int64, args string) {
+	days := defaultAIStatsDays
+	if args = strings.TrimSpace(args); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n <= 0 || n > maxAIStatsDays {
+			sendMessage(userID, fmt.Sprintf("❌ 用法：/aistats [天数]，天数为 1-%d", maxAIStatsDays))
+			return
+		}
+		days = n
+	}
+
+	stats, err := GetAIUsageStats(days)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取AI使用统计失败: %v", err), userID)
+		sendMessage(userID, "获取AI使用统计失败，请稍后重试")
+		return
+	}
+	// 报告使用 **粗体** 标记，转为 HTML 发送
+	report := FormatAIStatsReport(stats)
+	parts := strings.Split(report, "**")
+	for i := range parts {
+		parts[i] = html.EscapeString(parts[i])
+		if i%2 == 1 {
+			parts[i] = "<b>" + parts[i] + "</b>"
+		}
+	}
+	if _, err := sendHTMLMessage(userID, strings.Join(parts, "")); err != nil {
+		sendMessage(userID, strings.ReplaceAll(report, "**", ""))
+	}
+}
@@ -28,18 +28,32 @@ func NewAIHandler(service AIService, db *sql.DB) *AIHandler {
 
 // HandleTranslateRequest 处理翻译请求
 func (h *AIHandler) HandleTranslateRequest(ctx context.Context, text, sourceLang, targetLang string) (*TranslateResult, error) {
+	return h.translate(ctx, text, sourceLang, targetLang, nil)
+}
+
+// translate 翻译，缓存未命中且 beforeRequest 不为空时先调用它（用于扣除用户配额），返回错误时不再请求AI服务
+func (h *AIHandler) translate(ctx context.Context, text, sourceLang, targetLang string, beforeRequest func() error) (*TranslateResult, error) {
 	// 生成内容哈希用于缓存
 	contentHash := generateContentHash(text, "translate", sourceLang, targetLang)
 
 	// 检查缓存
-	if cachedResult, found := h.cache.GetCachedTranslation(contentHash); found {
+	cachedResult, found := h.cache.GetCachedTranslation(contentHash)
+	observeAICacheLookup("translate", found)
+	if found {
 		logMessage(
 			"debug", "翻译缓存命中")
 		return cachedResult, nil
 	}
 
+	if beforeRequest != nil {
+		if err := beforeRequest(); err != nil {
+			return nil, err
+		}
+	}
+
 	// 调用AI服务进行翻译
 	result, err := h.service.Translate(ctx, text, sourceLang, targetLang)
+	observeAIRequest("translate", err)
 	if err != nil {
 		return nil, err
 	}
@@ -57,17 +71,31 @@ func (h *AIHandler) HandleTranslateRequest(ctx context.Context, text, sourceLang
 
 // HandleSummarizeRequest 处理摘要请求
 func (h *AIHandler) HandleSummarizeRequest(ctx context.Context, text string, maxLength, minLength int) (*SummaryResult, error) {
+	return h.summarize(ctx, text, maxLength, minLength, nil)
+}
+
+// summarize 生成摘要，beforeRequest 的用法与 translate 相同
+func (h *AIHandler) summarize(ctx context.Context, text string, maxLength, minLength int, beforeRequest func() error) (*SummaryResult, error) {
 	// 生成内容哈希用于缓存
 	contentHash := generateContentHash(text, "summarize", fmt.Sprintf("%d-%d", maxLength, minLength))
 
 	// 检查缓存
-	if cachedResult, found := h.cache.GetCachedSummary(contentHash); found {
+	cachedResult, found := h.cache.GetCachedSummary(contentHash)
+	observeAICacheLookup("summarize", found)
+	if found {
 		logMessage("debug", "摘要缓存命中")
 		return cachedResult, nil
 	}
 
+	if beforeRequest != nil {
+		if err := beforeRequest(); err != nil {
+			return nil, err
+		}
+	}
+
 	// 调用AI服务进行摘要
 	result, err := h.service.Summarize(ctx, text, maxLength, minLength)
+	observeAIRequest("summarize", err)
 	if err != nil {
 		return nil, err
 	}
@@ -83,8 +111,23 @@ func (h *AIHandler) HandleSummarizeRequest(ctx context.Context, text string, max
 	return result, nil
 }
 
+// TranslateForUser 为指定用户翻译，只有缓存未命中时才计入用户每日翻译配额，超出时返回 ErrAIQuotaExceeded
+func (h *AIHandler) TranslateForUser(ctx context.Context, userID int64, text, sourceLang, targetLang string) (*TranslateResult, error) {
+	return h.translate(ctx, text, sourceLang, targetLang, func() error {
+		return reserveUserAIUsage(userID, AIOpTranslate)
+	})
+}
+
+// SummarizeForUser 为指定用户生成摘要，只有缓存未命中时才计入用户每日摘要配额，超出时返回 ErrAIQuotaExceeded
+func (h *AIHandler) SummarizeForUser(ctx context.Context, userID int64, text string, maxLength, minLength int) (*SummaryResult, error) {
+	return h.summarize(ctx, text, maxLength, minLength, func() error {
+		return reserveUserAIUsage(userID, AIOpSummarize)
+	})
+}
+
 // recordUsage 记录AI使用统计
 func (h *AIHandler) recordUsage(operationType string, tokensUsed int, cost float64) {
+	observeAIUsage(operationType, tokensUsed, cost)
 	today := time.Now().Format("2006-01-02")
 
 	err := withDB(func(db *sql.DB) error {
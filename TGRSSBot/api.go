@@ -0,0 +1,755 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 管理 API：供内部工具和 CI 管理订阅、关键词、AI 偏好、个人设置和推送目标
+// 每个请求以 API 密钥认证，按密钥所属用户的身份操作，校验逻辑与 Bot 中的菜单和命令一致
+// 接口说明见 openapi.json，可通过 GET /api/v1/openapi.json 获取
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// apiHandlerFunc 已认证的 API 处理函数，userID 为密钥所属用户
+type apiHandlerFunc func(w http.ResponseWriter, r *http.Request, userID int64)
+
+// registerAPIRoutes 注册管理 API 的路由
+func registerAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(openAPISpec)
+	})
+
+	routes := map[string]apiHandlerFunc{
+		"GET /api/v1/me": apiGetMe,
+
+		"GET /api/v1/subscriptions":           apiListSubscriptions,
+		"POST /api/v1/subscriptions":          apiCreateSubscription,
+		"GET /api/v1/subscriptions/{name}":    apiGetSubscription,
+		"PATCH /api/v1/subscriptions/{name}":  apiUpdateSubscription,
+		"DELETE /api/v1/subscriptions/{name}": apiDeleteSubscription,
+
+		"GET /api/v1/keywords":              apiListKeywords,
+		"POST /api/v1/keywords":             apiAddKeywords,
+		"DELETE /api/v1/keywords/{keyword}": apiDeleteKeyword,
+
+		"GET /api/v1/ai-preferences":    apiGetAIPreferences,
+		"PATCH /api/v1/ai-preferences":  apiUpdateAIPreferences,
+		"DELETE /api/v1/ai-preferences": apiResetAIPreferences,
+
+		"GET /api/v1/settings":   apiGetSettings,
+		"PATCH /api/v1/settings": apiUpdateSettings,
+
+		"GET /api/v1/destinations":         apiListDestinations,
+		"POST /api/v1/destinations":        apiCreateDestination,
+		"GET /api/v1/destinations/{id}":    apiGetDestination,
+		"PATCH /api/v1/destinations/{id}":  apiUpdateDestination,
+		"DELETE /api/v1/destinations/{id}": apiDeleteDestination,
+	}
+	for pattern, handler := range routes {
+		mux.Handle(pattern, apiAuth(handler))
+	}
+}
+
+// apiAuth 校验 API 密钥和用户权限
+func apiAuth(next apiHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "缺少 API 密钥")
+			return
+		}
+		userID, ok, err := authenticateAPIKey(key)
+		if err != nil {
+			logMessage("error", fmt.Sprintf("校验 API 密钥失败: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, "校验密钥失败")
+			return
+		}
+		if !ok {
+			logMessage("warn", fmt.Sprintf("拒绝无效的 API 密钥: %s", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "无效的 API 密钥")
+			return
+		}
+		if ok, reason := checkAccess(userID, RoleUser); !ok {
+			writeJSONError(w, http.StatusForbidden, reason)
+			return
+		}
+		logMessage("debug", fmt.Sprintf("API 请求: %s %s", r.Method, r.URL.Path), userID)
+		next(w, r, userID)
+	})
+}
+
+// apiInternalError 记录错误日志并返回 500
+func apiInternalError(w http.ResponseWriter, userID int64, action string, err error) {
+	logMessage("error", fmt.Sprintf("API %s失败: %v", action, err), userID)
+	writeJSONError(w, http.StatusInternalServerError, action+"失败，请稍后重试")
+}
+
+// userErrorStatus UserError 对应的状态码
+var userErrorStatus = map[UserErrorKind]int{
+	UserErrorInvalid:  http.StatusUnprocessableEntity,
+	UserErrorNotFound: http.StatusNotFound,
+	UserErrorConflict: http.StatusConflict,
+	UserErrorQuota:    http.StatusForbidden,
+}
+
+// apiOperationError 返回操作失败的响应，UserError 按类别返回对应状态码，其他错误返回 500
+func apiOperationError(w http.ResponseWriter, userID int64, action string, err error) {
+	userErr, ok := asUserError(err)
+	if !ok {
+		apiInternalError(w, userID, action, err)
+		return
+	}
+	status, ok := userErrorStatus[userErr.Kind]
+	if !ok {
+		status = http.StatusUnprocessableEntity
+	}
+	logMessage("warn", fmt.Sprintf("API %s失败: %s", action, userErr.Message), userID)
+	writeJSONError(w, status, userErr.Message)
+}
+
+// apiGetMe 返回密钥所属用户的信息和配额
+func apiGetMe(w http.ResponseWriter, r *http.Request, userID int64) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"role":    getUserRole(userID),
+		"quota":   getUserQuota(userID),
+	})
+}
+
+// apiSubscription API 中的订阅
+type apiSubscription struct {
+	ID                    int    `json:"id"`
+	Name                  string `json:"name"`
+	URL                   string `json:"url"`
+	LastUpdate            string `json:"last_update"`
+	ReceiveAll            bool   `json:"receive_all"`
+	DeliveryMode          string `json:"delivery_mode"` // 订阅单独的推送方式，空表示跟随默认
+	EffectiveDeliveryMode string `json:"effective_delivery_mode"`
+}
+
+// apiSubscriptionInput 创建或修改订阅的请求
+type apiSubscriptionInput struct {
+	URL          string  `json:"url"`
+	Name         string  `json:"name"`
+	Display      string  `json:"display"` // full/link，只在创建时有效
+	ReceiveAll   *bool   `json:"receive_all"`
+	DeliveryMode *string `json:"delivery_mode"`
+}
+
+// toAPISubscription 补充订阅的推送设置
+func toAPISubscription(userID int64, sub SubscriptionInfo) (apiSubscription, error) {
+	result := apiSubscription{ID: sub.ID, Name: sub.Name, URL: sub.URL, LastUpdate: sub.LastUpdate}
+	var err error
+	if result.ReceiveAll, err = isReceiveAll(userID, sub.Name); err != nil {
+		return result, err
+	}
+	if result.DeliveryMode, err = getSubscriptionDeliveryMode(userID, sub.Name); err != nil {
+		return result, err
+	}
+	result.EffectiveDeliveryMode = getEffectiveDeliveryMode(userID, sub.Name)
+	return result, nil
+}
+
+// validateSubscriptionSettings 检查订阅推送设置
+func validateSubscriptionSettings(input *apiSubscriptionInput) error {
+	if input.DeliveryMode != nil && *input.DeliveryMode != "" && !isValidDeliveryMode(*input.DeliveryMode) {
+		return fmt.Errorf("无效的推送方式 %s，可选 %s，空字符串表示跟随默认", *input.DeliveryMode, strings.Join(deliveryModes, "/"))
+	}
+	return nil
+}
+
+// applySubscriptionSettings 保存订阅推送设置
+func applySubscriptionSettings(userID int64, rssName string, input *apiSubscriptionInput) error {
+	if input.ReceiveAll != nil {
+		if err := setReceiveAll(userID, rssName, *input.ReceiveAll); err != nil {
+			return err
+		}
+	}
+	if input.DeliveryMode != nil {
+		if err := setSubscriptionDeliveryMode(userID, rssName, *input.DeliveryMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiFindSubscription 按路径中的名称查找订阅，不存在时返回 404
+func apiFindSubscription(w http.ResponseWriter, r *http.Request, userID int64) *SubscriptionInfo {
+	name := r.PathValue("name")
+	sub, err := findUserSubscription(userID, name)
+	if err != nil {
+		apiInternalError(w, userID, "获取订阅", err)
+		return nil
+	}
+	if sub == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("你没有订阅 \"%s\"", name))
+		return nil
+	}
+	return sub
+}
+
+// writeAPISubscription 返回单个订阅
+func writeAPISubscription(w http.ResponseWriter, status int, userID int64, sub SubscriptionInfo) {
+	result, err := toAPISubscription(userID, sub)
+	if err != nil {
+		apiInternalError(w, userID, "获取订阅", err)
+		return
+	}
+	writeJSON(w, status, result)
+}
+
+func apiListSubscriptions(w http.ResponseWriter, r *http.Request, userID int64) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取订阅", err)
+		return
+	}
+	result := make([]apiSubscription, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		item, err := toAPISubscription(userID, sub)
+		if err != nil {
+			apiInternalError(w, userID, "获取订阅", err)
+			return
+		}
+		result = append(result, item)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func apiGetSubscription(w http.ResponseWriter, r *http.Request, userID int64) {
+	if sub := apiFindSubscription(w, r, userID); sub != nil {
+		writeAPISubscription(w, http.StatusOK, userID, *sub)
+	}
+}
+
+// apiCreateSubscription 添加订阅，校验与 Bot 中添加订阅相同
+func apiCreateSubscription(w http.ResponseWriter, r *http.Request, userID int64) {
+	var input apiSubscriptionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	input.URL = strings.TrimSpace(input.URL)
+	if input.URL == "" {
+		writeJSONError(w, http.StatusBadRequest, "url 不能为空")
+		return
+	}
+	channel := "0"
+	if input.Display != "" {
+		var ok bool
+		if channel, ok = parseDisplayMode(input.Display); !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("无效的显示方式 %s，可选 full/link", input.Display))
+			return
+		}
+	}
+	if err := validateSubscriptionSettings(&input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = fetchFeedTitle(input.URL)
+	}
+
+	if err := validateAndProcessSubscription(input.URL, name, channel, userID); err != nil {
+		apiOperationError(w, userID, "添加订阅", err)
+		return
+	}
+	logMessage("info", fmt.Sprintf("API 添加订阅：📰 %s  🔗 %s", name, input.URL), userID)
+
+	sub, err := findUserSubscription(userID, name)
+	if err != nil || sub == nil {
+		// 名称与已有订阅不同但链接相同时，加入的是已有订阅
+		subscriptions, listErr := getSubscriptionsForUser(userID)
+		if listErr != nil {
+			apiInternalError(w, userID, "获取订阅", listErr)
+			return
+		}
+		for i := range subscriptions {
+			if subscriptions[i].URL == input.URL {
+				sub = &subscriptions[i]
+				break
+			}
+		}
+		if sub == nil {
+			apiInternalError(w, userID, "获取订阅", fmt.Errorf("添加后找不到订阅 %s", name))
+			return
+		}
+	}
+	if err := applySubscriptionSettings(userID, sub.Name, &input); err != nil {
+		apiInternalError(w, userID, "保存订阅设置", err)
+		return
+	}
+	writeAPISubscription(w, http.StatusCreated, userID, *sub)
+}
+
+// apiUpdateSubscription 修改订阅的推送范围和推送方式
+func apiUpdateSubscription(w http.ResponseWriter, r *http.Request, userID int64) {
+	sub := apiFindSubscription(w, r, userID)
+	if sub == nil {
+		return
+	}
+	var input apiSubscriptionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if input.URL != "" || input.Name != "" || input.Display != "" {
+		writeJSONError(w, http.StatusBadRequest, "只能修改 receive_all 和 delivery_mode")
+		return
+	}
+	if err := validateSubscriptionSettings(&input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := applySubscriptionSettings(userID, sub.Name, &input); err != nil {
+		apiInternalError(w, userID, "保存订阅设置", err)
+		return
+	}
+	writeAPISubscription(w, http.StatusOK, userID, *sub)
+}
+
+func apiDeleteSubscription(w http.ResponseWriter, r *http.Request, userID int64) {
+	sub := apiFindSubscription(w, r, userID)
+	if sub == nil {
+		return
+	}
+	if _, err := removeSubscriptionForUser(userID, sub.Name); err != nil {
+		apiOperationError(w, userID, "删除订阅", err)
+		return
+	}
+	logMessage("info", fmt.Sprintf("API 删除订阅: %s", sub.Name), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAPIKeywords 返回用户当前的关键词
+func writeAPIKeywords(w http.ResponseWriter, status int, userID int64) {
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取关键词", err)
+		return
+	}
+	if keywords == nil {
+		keywords = []string{}
+	}
+	sort.Strings(keywords)
+	writeJSON(w, status, map[string][]string{"keywords": keywords})
+}
+
+func apiListKeywords(w http.ResponseWriter, r *http.Request, userID int64) {
+	writeAPIKeywords(w, http.StatusOK, userID)
+}
+
+// apiAddKeywords 添加关键词，拆分、语法校验和配额检查与 Bot 中添加关键词相同
+func apiAddKeywords(w http.ResponseWriter, r *http.Request, userID int64) {
+	var input struct {
+		Keywords []string `json:"keywords"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if len(input.Keywords) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "keywords 不能为空")
+		return
+	}
+	if _, err := addKeywordsForUser(userID, input.Keywords); err != nil {
+		apiOperationError(w, userID, "添加关键词", err)
+		return
+	}
+	writeAPIKeywords(w, http.StatusCreated, userID)
+}
+
+func apiDeleteKeyword(w http.ResponseWriter, r *http.Request, userID int64) {
+	keyword := r.PathValue("keyword")
+	if _, err := removeKeywordForUser(userID, keyword); err != nil {
+		apiOperationError(w, userID, "删除关键词", err)
+		return
+	}
+	logMessage("info", fmt.Sprintf("API 删除关键词: %s", keyword), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiGetAIPreferences(w http.ResponseWriter, r *http.Request, userID int64) {
+	preferences, err := GetUserAIPreferences(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取AI偏好", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, preferences)
+}
+
+// apiUpdateAIPreferences 修改 AI 偏好，只修改请求中出现的字段
+func apiUpdateAIPreferences(w http.ResponseWriter, r *http.Request, userID int64) {
+	var input struct {
+		AutoTranslate    *bool   `json:"auto_translate"`
+		AutoSummarize    *bool   `json:"auto_summarize"`
+		PreferredLang    *string `json:"preferred_lang"`
+		MaxSummaryLength *int    `json:"max_summary_length"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if input.PreferredLang != nil {
+		if supported := supportedTranslationLangs(); len(supported) > 0 && !slices.Contains(supported, *input.PreferredLang) {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("不支持的语言 %s，可选 %s", *input.PreferredLang, strings.Join(supported, "/")))
+			return
+		}
+		if *input.PreferredLang == "" {
+			writeJSONError(w, http.StatusBadRequest, "preferred_lang 不能为空")
+			return
+		}
+	}
+	if input.MaxSummaryLength != nil && *input.MaxSummaryLength <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "max_summary_length 必须大于 0")
+		return
+	}
+
+	preferences, err := GetUserAIPreferences(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取AI偏好", err)
+		return
+	}
+	if input.AutoTranslate != nil {
+		preferences.AutoTranslate = *input.AutoTranslate
+	}
+	if input.AutoSummarize != nil {
+		preferences.AutoSummarize = *input.AutoSummarize
+	}
+	if input.PreferredLang != nil {
+		preferences.PreferredLang = *input.PreferredLang
+	}
+	if input.MaxSummaryLength != nil {
+		preferences.MaxSummaryLength = *input.MaxSummaryLength
+	}
+	if err := UpdateUserAIPreferences(preferences); err != nil {
+		apiInternalError(w, userID, "保存AI偏好", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, preferences)
+}
+
+// apiResetAIPreferences 删除 AI 偏好，恢复默认设置
+func apiResetAIPreferences(w http.ResponseWriter, r *http.Request, userID int64) {
+	err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec("DELETE FROM user_ai_preferences WHERE user_id = ?", userID)
+		return err
+	})
+	if err != nil {
+		apiInternalError(w, userID, "重置AI偏好", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// supportedTranslationLangs 配置中允许的翻译目标语言，为空表示不限制
+func supportedTranslationLangs() []string {
+	if globalConfig.AI == nil || globalConfig.AI.Features == nil || globalConfig.AI.Features.Translation == nil {
+		return nil
+	}
+	return globalConfig.AI.Features.Translation.SupportedLangs
+}
+
+// apiSettings API 中可修改的个人设置
+type apiSettings struct {
+	Timezone         string `json:"timezone"`
+	DateFormat       string `json:"date_format"`
+	DeliveryMode     string `json:"delivery_mode"`
+	DigestTime       string `json:"digest_time"`
+	DigestWeekday    int    `json:"digest_weekday"`
+	DigestAIOverview bool   `json:"digest_ai_overview"`
+	TextFolding      bool   `json:"text_folding"`
+}
+
+func toAPISettings(settings *UserSettings) apiSettings {
+	return apiSettings{
+		Timezone:         settings.timezoneName(),
+		DateFormat:       settings.dateLayout(),
+		DeliveryMode:     settings.DeliveryMode,
+		DigestTime:       settings.DigestTime,
+		DigestWeekday:    settings.DigestWeekday,
+		DigestAIOverview: settings.DigestAIOverview,
+		TextFolding:      settings.TextFolding,
+	}
+}
+
+func apiGetSettings(w http.ResponseWriter, r *http.Request, userID int64) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取个人设置", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPISettings(settings))
+}
+
+// apiUpdateSettings 修改个人设置，只修改请求中出现的字段，取值范围与设置菜单相同
+func apiUpdateSettings(w http.ResponseWriter, r *http.Request, userID int64) {
+	var input struct {
+		Timezone         *string `json:"timezone"`
+		DateFormat       *string `json:"date_format"`
+		DeliveryMode     *string `json:"delivery_mode"`
+		DigestTime       *string `json:"digest_time"`
+		DigestWeekday    *int    `json:"digest_weekday"`
+		DigestAIOverview *bool   `json:"digest_ai_overview"`
+		TextFolding      *bool   `json:"text_folding"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	fields := make(map[string]interface{})
+	if input.Timezone != nil {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("无效的时区 %s，请使用IANA时区名称，如 Asia/Shanghai", *input.Timezone))
+			return
+		}
+		fields["timezone"] = *input.Timezone
+	}
+	if input.DateFormat != nil {
+		valid := false
+		for _, option := range DateFormatOptions {
+			if option.Layout == *input.DateFormat {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("不支持的时间格式 %s", *input.DateFormat))
+			return
+		}
+		fields["date_format"] = *input.DateFormat
+	}
+	if input.DeliveryMode != nil {
+		if !isValidDeliveryMode(*input.DeliveryMode) {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("无效的推送方式 %s，可选 %s", *input.DeliveryMode, strings.Join(deliveryModes, "/")))
+			return
+		}
+		fields["delivery_mode"] = *input.DeliveryMode
+	}
+	if input.DigestTime != nil {
+		minutes, err := parseClock(*input.DigestTime)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		fields["digest_time"] = fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+	}
+	if input.DigestWeekday != nil {
+		if *input.DigestWeekday < 0 || *input.DigestWeekday > 6 {
+			writeJSONError(w, http.StatusBadRequest, "digest_weekday 需在 0-6 之间，0 表示周日")
+			return
+		}
+		fields["digest_weekday"] = *input.DigestWeekday
+	}
+	if input.DigestAIOverview != nil {
+		fields["digest_ai_overview"] = *input.DigestAIOverview
+	}
+	if input.TextFolding != nil {
+		fields["text_folding"] = *input.TextFolding
+	}
+
+	if err := UpdateUserSettingFields(userID, fields); err != nil {
+		apiInternalError(w, userID, "保存个人设置", err)
+		return
+	}
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取个人设置", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPISettings(settings))
+}
+
+// apiDestination API 中的推送目标
+type apiDestination struct {
+	ID          int64    `json:"id"`
+	ChatID      int64    `json:"chat_id"`
+	ChatType    string   `json:"chat_type"`
+	Title       string   `json:"title"`
+	Active      bool     `json:"active"`
+	IsForum     bool     `json:"is_forum"`
+	Format      string   `json:"format"`
+	KeywordMode string   `json:"keyword_mode"`
+	Keywords    []string `json:"keywords"`
+	Routes      []string `json:"routes"`
+}
+
+func toAPIDestination(dest *Destination) apiDestination {
+	result := apiDestination{
+		ID:          dest.ID,
+		ChatID:      dest.ChatID,
+		ChatType:    dest.ChatType,
+		Title:       dest.Title,
+		Active:      dest.Active,
+		IsForum:     dest.IsForum,
+		Format:      dest.Format,
+		KeywordMode: dest.KeywordMode,
+		Keywords:    dest.Keywords,
+		Routes:      dest.Routes,
+	}
+	if result.Keywords == nil {
+		result.Keywords = []string{}
+	}
+	if result.Routes == nil {
+		result.Routes = []string{}
+	}
+	return result
+}
+
+// apiFindDestination 按路径中的ID查找推送目标，不存在时返回 404
+func apiFindDestination(w http.ResponseWriter, r *http.Request, userID int64) *Destination {
+	destID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "推送目标不存在")
+		return nil
+	}
+	dest, err := getDestinationForUser(userID, destID)
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusNotFound, "推送目标不存在")
+		return nil
+	}
+	if err != nil {
+		apiInternalError(w, userID, "获取推送目标", err)
+		return nil
+	}
+	return dest
+}
+
+func apiListDestinations(w http.ResponseWriter, r *http.Request, userID int64) {
+	dests, err := getDestinationsForUser(userID)
+	if err != nil {
+		apiInternalError(w, userID, "获取推送目标", err)
+		return
+	}
+	result := make([]apiDestination, 0, len(dests))
+	for _, dest := range dests {
+		result = append(result, toAPIDestination(dest))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func apiGetDestination(w http.ResponseWriter, r *http.Request, userID int64) {
+	if dest := apiFindDestination(w, r, userID); dest != nil {
+		writeJSON(w, http.StatusOK, toAPIDestination(dest))
+	}
+}
+
+// apiCreateDestination 添加推送目标，与 Bot 中相同，需确认用户和 Bot 都是该会话的管理员
+func apiCreateDestination(w http.ResponseWriter, r *http.Request, userID int64) {
+	var input struct {
+		Chat string `json:"chat"` // 数字ID、@用户名或 t.me 链接
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if strings.TrimSpace(input.Chat) == "" {
+		writeJSONError(w, http.StatusBadRequest, "chat 不能为空")
+		return
+	}
+	dest, err := addDestinationByReference(userID, input.Chat)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("API 添加推送目标失败: %v", err), userID)
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	logMessage("info", fmt.Sprintf("API 添加推送目标: %s", dest.label()), userID)
+	writeJSON(w, http.StatusCreated, toAPIDestination(dest))
+}
+
+// apiUpdateDestination 修改推送目标的格式、关键词和转发的订阅
+func apiUpdateDestination(w http.ResponseWriter, r *http.Request, userID int64) {
+	dest := apiFindDestination(w, r, userID)
+	if dest == nil {
+		return
+	}
+	var input struct {
+		Format      *string   `json:"format"`
+		KeywordMode *string   `json:"keyword_mode"`
+		Keywords    *[]string `json:"keywords"`
+		Routes      *[]string `json:"routes"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	if input.Format != nil {
+		if _, ok := destinationFormatNames[*input.Format]; !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("无效的格式 %s，可选 follow/full/link", *input.Format))
+			return
+		}
+		dest.Format = *input.Format
+	}
+	if input.KeywordMode != nil {
+		if _, ok := destinationKeywordModeNames[*input.KeywordMode]; !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("无效的关键词方式 %s，可选 owner/custom/all", *input.KeywordMode))
+			return
+		}
+		dest.KeywordMode = *input.KeywordMode
+	}
+	if input.Keywords != nil {
+		var keywords []string
+		for _, keyword := range *input.Keywords {
+			keywords = append(keywords, splitKeywordInput(keyword)...)
+		}
+		if problems := validateKeywordSyntax(keywords); len(problems) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "以下关键词有误："+strings.Join(problems, "；"))
+			return
+		}
+		dest.Keywords = keywords
+	}
+
+	// 只能转发自己已订阅的订阅，名称统一为订阅的实际名称
+	var routes []string
+	if input.Routes != nil {
+		routes = []string{}
+		for _, name := range *input.Routes {
+			sub, err := findUserSubscription(userID, name)
+			if err != nil {
+				apiInternalError(w, userID, "获取订阅", err)
+				return
+			}
+			if sub == nil {
+				writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("你没有订阅 \"%s\"", name))
+				return
+			}
+			if !slices.Contains(routes, sub.Name) {
+				routes = append(routes, sub.Name)
+			}
+		}
+	}
+
+	if err := updateDestination(dest); err != nil {
+		apiInternalError(w, userID, "保存推送目标", err)
+		return
+	}
+	if routes != nil {
+		if err := setDestinationRoutes(dest, routes); err != nil {
+			apiInternalError(w, userID, "保存推送目标", err)
+			return
+		}
+	}
+	logMessage("info", fmt.Sprintf("API 修改推送目标: %s", dest.label()), userID)
+	writeJSON(w, http.StatusOK, toAPIDestination(dest))
+}
+
+func apiDeleteDestination(w http.ResponseWriter, r *http.Request, userID int64) {
+	dest := apiFindDestination(w, r, userID)
+	if dest == nil {
+		return
+	}
+	if err := deleteDestination(dest); err != nil {
+		apiInternalError(w, userID, "删除推送目标", err)
+		return
+	}
+	logMessage("info", fmt.Sprintf("API 删除推送目标: %s", dest.label()), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// API 密钥：用户在私聊中通过 /apikey 生成，调用管理 API 时以 Authorization: Bearer <密钥> 认证
+// 数据库只保存密钥的 SHA-256，明文只在生成时显示一次
+// 密钥以所属用户的身份操作，用户被封禁或失去权限后密钥随之失效
+
+const (
+	apiKeyPrefix        = "tgrss_"              // 密钥前缀，便于识别和密钥扫描
+	apiKeyRandomBytes   = 24                    // 密钥随机部分的字节数
+	apiKeyMaxPerUser    = 10                    // 每个用户最多的密钥数
+	apiKeyHintLength    = 4                     // 列表中显示的密钥末尾字符数
+	apiKeyTimeLayout    = "2006-01-02 15:04:05" // 数据库中时间的格式（UTC）
+	apiKeyTouchInterval = time.Minute           // 最近使用时间的更新间隔
+)
+
+// APIKey API 密钥，不包含明文
+type APIKey struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Hint       string // 密钥末尾几位
+	CreatedAt  string // UTC
+	LastUsedAt string // UTC，空表示从未使用
+}
+
+// hashAPIKey 计算密钥的哈希
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey 生成随机密钥
+func generateAPIKey() (string, error) {
+	buf := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// createAPIKey 为用户生成密钥，返回明文
+func createAPIKey(userID int64, name string) (string, error) {
+	keys, err := getAPIKeys(userID)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) >= apiKeyMaxPerUser {
+		return "", fmt.Errorf("最多只能创建 %d 个密钥，请先删除不用的密钥", apiKeyMaxPerUser)
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return "", err
+	}
+	err = withDB(func(db *sql.DB) error {
+		_, err := db.Exec("INSERT INTO api_keys (user_id, name, key_hash, hint, created_at) VALUES (?, ?, ?, ?, ?)",
+			userID, name, hashAPIKey(key), key[len(key)-apiKeyHintLength:], time.Now().UTC().Format(apiKeyTimeLayout))
+		return err
+	})
+	return key, err
+}
+
+// getAPIKeys 获取用户的密钥
+func getAPIKeys(userID int64) ([]APIKey, error) {
+	var keys []APIKey
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT id, user_id, name, hint, created_at, last_used_at FROM api_keys
+			WHERE user_id = ? ORDER BY id`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key APIKey
+			if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Hint, &key.CreatedAt, &key.LastUsedAt); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return rows.Err()
+	})
+	return keys, err
+}
+
+// deleteAPIKey 删除用户的密钥
+func deleteAPIKey(userID, keyID int64) (bool, error) {
+	var deleted bool
+	err := withDB(func(db *sql.DB) error {
+		result, err := db.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", keyID, userID)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		deleted = n > 0
+		return nil
+	})
+	return deleted, err
+}
+
+// authenticateAPIKey 根据密钥查找所属用户，并更新最近使用时间
+func authenticateAPIKey(key string) (int64, bool, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return 0, false, nil
+	}
+	var userID int64
+	err := withDB(func(db *sql.DB) error {
+		hash := hashAPIKey(key)
+		if err := db.QueryRow("SELECT user_id FROM api_keys WHERE key_hash = ?", hash).Scan(&userID); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		_, err := db.Exec("UPDATE api_keys SET last_used_at = ? WHERE key_hash = ? AND last_used_at < ?",
+			now.Format(apiKeyTimeLayout), hash, now.Add(-apiKeyTouchInterval).Format(apiKeyTimeLayout))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+// requestAPIKey 从请求头中读取密钥，支持 Authorization: Bearer 和 X-API-Key
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// handleAPIKeyCommand 处理 /apikey [new [名称]|list|del <ID>]，只能在私聊中使用，避免密钥泄露到群组
+func handleAPIKeyCommand(userID int64, message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() {
+		sendMessage(userID, "❌ 请在与 Bot 的私聊中管理 API 密钥")
+		return
+	}
+	if globalConfig.HTTP == nil || !globalConfig.HTTP.Enabled || !globalConfig.HTTP.API {
+		sendMessage(userID, "❌ 管理 API 未启用")
+		return
+	}
+
+	usage := "❌ 用法：/apikey new [名称] 生成密钥，/apikey list 查看密钥，/apikey del <ID> 删除密钥"
+	fields := strings.Fields(message.CommandArguments())
+	action := "list"
+	if len(fields) > 0 {
+		action = strings.ToLower(fields[0])
+	}
+
+	switch action {
+	case "new":
+		name := strings.TrimSpace(strings.Join(fields[1:], " "))
+		if name == "" {
+			name = "默认"
+		}
+		key, err := createAPIKey(userID, name)
+		if err != nil {
+			logMessage("warn", fmt.Sprintf("生成 API 密钥失败: %v", err), userID)
+			sendMessage(userID, "❌ 生成密钥失败："+err.Error())
+			return
+		}
+		logMessage("info", fmt.Sprintf("生成 API 密钥: %s", name), userID)
+		text := fmt.Sprintf("🔑 已生成 API 密钥「%s」：\n\n<code>%s</code>\n\n密钥只显示这一次，请妥善保存。调用 API 时在请求头中加入 <code>Authorization: Bearer 密钥</code>",
+			html.EscapeString(name), key)
+		if _, err := sendHTMLMessage(userID, text); err != nil {
+			logMessage("error", fmt.Sprintf("发送 API 密钥失败: %v", err), userID)
+		}
+
+	case "list":
+		keys, err := getAPIKeys(userID)
+		if err != nil {
+			logMessage("error", fmt.Sprintf("获取 API 密钥失败: %v", err), userID)
+			sendMessage(userID, "获取密钥失败，请稍后重试")
+			return
+		}
+		if len(keys) == 0 {
+			sendMessage(userID, "还没有 API 密钥，使用 /apikey new [名称] 生成")
+			return
+		}
+		var lines []string
+		for _, key := range keys {
+			lastUsed := "从未使用"
+			if key.LastUsedAt != "" {
+				lastUsed = "最近使用 " + formatFeedUpdateTime(userID, key.LastUsedAt)
+			}
+			lines = append(lines, fmt.Sprintf("• ID %d：%s（…%s）\n  创建于 %s，%s",
+				key.ID, key.Name, key.Hint, formatFeedUpdateTime(userID, key.CreatedAt), lastUsed))
+		}
+		sendMessage(userID, "🔑 API 密钥：\n\n"+strings.Join(lines, "\n")+"\n\n使用 /apikey del <ID> 删除")
+
+	case "del":
+		if len(fields) != 2 {
+			sendMessage(userID, usage)
+			return
+		}
+		keyID, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			sendMessage(userID, usage)
+			return
+		}
+		deleted, err := deleteAPIKey(userID, keyID)
+		if err != nil {
+			logMessage("error", fmt.Sprintf("删除 API 密钥失败: %v", err), userID)
+			sendMessage(userID, "删除密钥失败，请稍后重试")
+			return
+		}
+		if !deleted {
+			sendMessage(userID, "❌ 密钥不存在")
+			return
+		}
+		logMessage("info", fmt.Sprintf("删除 API 密钥: %d", keyID), userID)
+		sendMessage(userID, fmt.Sprintf("✅ 已删除密钥 ID %d，使用该密钥的请求将被拒绝", keyID))
+
+	default:
+		sendMessage(userID, usage)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeywordErrorStatus(t *testing.T) {
+	setupTestDB(t)
+	const userID = 7
+
+	add := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/keywords", strings.NewReader(body))
+		apiAddKeywords(w, r, userID)
+		return w
+	}
+	del := func(keyword string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/api/v1/keywords/"+keyword, nil)
+		r.SetPathValue("keyword", keyword)
+		apiDeleteKeyword(w, r, userID)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		do     func() *httptest.ResponseRecorder
+		status int
+	}{
+		{"语法错误", func() *httptest.ResponseRecorder { return add(`{"keywords": ["expr:title:(rust"]}`) }, http.StatusUnprocessableEntity},
+		{"添加", func() *httptest.ResponseRecorder { return add(`{"keywords": ["rust"]}`) }, http.StatusCreated},
+		{"重复添加", func() *httptest.ResponseRecorder { return add(`{"keywords": ["rust"]}`) }, http.StatusConflict},
+		{"超出配额", func() *httptest.ResponseRecorder {
+			globalConfig.Quotas.Keywords = 1
+			defer func() { globalConfig.Quotas.Keywords = 0 }()
+			return add(`{"keywords": ["go"]}`)
+		}, http.StatusForbidden},
+		{"删除不存在的关键词", func() *httptest.ResponseRecorder { return del("go") }, http.StatusNotFound},
+		{"删除", func() *httptest.ResponseRecorder { return del("rust") }, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		w := tt.do()
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d, body %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+		// 错误信息不带 Bot 提示中的 ❌ 前缀
+		if strings.Contains(w.Body.String(), "❌") {
+			t.Errorf("%s: body %s contains ❌", tt.name, w.Body.String())
+		}
+	}
+}
+
+func TestUserErrorResult(t *testing.T) {
+	result, err := userErrorResult("", newUserError(UserErrorNotFound, "关键词 \"%s\" 不存在", "rust"))
+	if err != nil || result != `❌ 关键词 "rust" 不存在` {
+		t.Errorf("userErrorResult(UserError) = %q, %v", result, err)
+	}
+
+	internal := http.ErrHandlerTimeout
+	if result, err := userErrorResult("", internal); err != internal || result != "" {
+		t.Errorf("userErrorResult(internal) = %q, %v", result, err)
+	}
+
+	if result, err := userErrorResult("✅ 已删除", nil); err != nil || result != "✅ 已删除" {
+		t.Errorf("userErrorResult(success) = %q, %v", result, err)
+	}
+}
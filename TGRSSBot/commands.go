@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mmcdole/gofeed"
+)
+
+// 命令行式管理：/sub /unsub /subs /kw /mode /pause /resume 与菜单操作等价，方便脚本和熟练用户使用
+// 参数按空白分隔，包含空格的参数可以用英文或中文引号括起来，如 /sub https://example.com/feed "科技 新闻"
+// 启动时通过 setMyCommands 注册命令，管理员另外注册管理命令
+
+// snoozeForever 不指定时长的 /pause 暂停的时长，视为直到手动恢复
+const snoozeForever = 100 * 365 * 24 * time.Hour
+
+// botCommand 注册到 Telegram 的命令
+type botCommand struct {
+	command     string
+	description string
+	adminOnly   bool
+}
+
+// botCommands 注册到 Telegram 的命令，按客户端显示顺序排列
+var botCommands = []botCommand{
+	{"start", "主菜单", false},
+	{"sub", "添加订阅：/sub <URL> [名称] [full|link]", false},
+	{"unsub", "取消订阅：/unsub <名称>", false},
+	{"subs", "查看订阅", false},
+	{"kw", "关键词：/kw add|del|list ...", false},
+	{"mode", "推送方式：/mode [订阅名称] <方式>", false},
+	{"pause", "暂停推送：/pause [时长]", false},
+	{"resume", "恢复推送", false},
+	{"snooze", "暂停推送指定时长", false},
+	{"apikey", "管理API密钥", false},
+	{"role", "查看自己的角色", false},
+	{"help", "帮助", false},
+	{"users", "用户列表", true},
+	{"feeds", "订阅源状态", true},
+	{"broadcast", "群发通知", true},
+	{"ban", "封禁用户", true},
+	{"unban", "解封用户", true},
+	{"quota", "用户配额", true},
+	{"invite", "邀请码", true},
+	{"pending", "待审核的申请", true},
+	{"aistats", "AI使用统计", true},
+}
+
+// commandQuotePairs 支持的引号，键为左引号，值为对应的右引号
+var commandQuotePairs = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'‘':  '’',
+	'「':  '」',
+}
+
+// splitCommandArgs 按空白拆分命令参数，引号内的空白保留
+// 反斜杠只转义引号、空白和反斜杠本身，其余情况原样保留，避免破坏正则关键词
+func splitCommandArgs(text string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var closing rune
+	escaped := false
+
+	for _, r := range text {
+		switch {
+		case escaped:
+			if r != '\\' && !unicode.IsSpace(r) && commandQuotePairs[r] == 0 && r != closing {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && closing != '\'':
+			escaped = true
+			inArg = true
+		case closing != 0:
+			if r == closing {
+				closing = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case commandQuotePairs[r] != 0:
+			closing = commandQuotePairs[r]
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if closing != 0 {
+		return nil, fmt.Errorf("引号没有闭合")
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// parseCommandArgs 拆分命令参数，格式错误时提示用法
+func parseCommandArgs(userID int64, message *tgbotapi.Message, usage string) ([]string, bool) {
+	args, err := splitCommandArgs(message.CommandArguments())
+	if err != nil {
+		sendMessage(userID, fmt.Sprintf("❌ %v\n%s", err, usage))
+		return nil, false
+	}
+	return args, true
+}
+
+// parseDisplayMode 解析订阅的显示方式，full 显示完整内容，link 只显示标题和链接
+func parseDisplayMode(value string) (string, bool) {
+	switch strings.ToLower(value) {
+	case "full", "1":
+		return "1", true
+	case "link", "0":
+		return "0", true
+	}
+	return "", false
+}
+
+// fetchFeedTitle 获取 RSS 源的标题，用作默认订阅名称
+func fetchFeedTitle(feedURL string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	parser := gofeed.NewParser()
+	parser.Client = createHTTPClient(globalConfig.ProxyURL)
+	feed, err := parser.ParseURLWithContext(feedURL, ctx)
+	if err == nil && strings.TrimSpace(feed.Title) != "" {
+		return strings.TrimSpace(feed.Title)
+	}
+	if parsed, err := url.Parse(feedURL); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return feedURL
+}
+
+// handleSubCommand 处理 /sub <URL> [名称] [full|link]
+func handleSubCommand(userID int64, message *tgbotapi.Message) {
+	usage := "用法：/sub <URL> [名称] [full|link]\nfull 推送完整内容，link 只推送标题和链接（默认）\n例如：/sub https://example.com/feed \"科技 新闻\" full"
+	args, ok := parseCommandArgs(userID, message, usage)
+	if !ok {
+		return
+	}
+	if len(args) == 0 || len(args) > 3 {
+		sendMessage(userID, "❌ "+usage)
+		return
+	}
+
+	feedURL := args[0]
+	channel := "0"
+	var name string
+	if len(args) == 3 {
+		name = args[1]
+		if channel, ok = parseDisplayMode(args[2]); !ok {
+			sendMessage(userID, fmt.Sprintf("❌ 无效的显示方式：%s\n%s", args[2], usage))
+			return
+		}
+	} else if len(args) == 2 {
+		// 第二个参数是显示方式时使用默认名称
+		if mode, ok := parseDisplayMode(args[1]); ok {
+			channel = mode
+		} else {
+			name = args[1]
+		}
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = fetchFeedTitle(feedURL)
+	}
+
+	actionHandler.addSubscription(userID, 0, feedURL, name, channel)
+}
+
+// findUserSubscription 按名称查找用户的订阅，忽略大小写
+func findUserSubscription(userID int64, name string) (*SubscriptionInfo, error) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		if subscriptions[i].Name == name {
+			return &subscriptions[i], nil
+		}
+	}
+	for i := range subscriptions {
+		if strings.EqualFold(subscriptions[i].Name, name) {
+			return &subscriptions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// handleUnsubCommand 处理 /unsub <名称>
+func handleUnsubCommand(userID int64, message *tgbotapi.Message) {
+	usage := "用法：/unsub <名称>，名称包含空格时用引号括起来"
+	args, ok := parseCommandArgs(userID, message, usage)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		sendMessage(userID, "❌ "+usage)
+		return
+	}
+
+	sub, err := findUserSubscription(userID, args[0])
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户订阅失败: %v", err), userID)
+		sendMessage(userID, "获取订阅失败，请稍后重试")
+		return
+	}
+	if sub == nil {
+		sendMessage(userID, fmt.Sprintf("❌ 你没有订阅 \"%s\"，使用 /subs 查看已有订阅", args[0]))
+		return
+	}
+
+	result, err := userErrorResult(removeSubscriptionForUser(userID, sub.Name))
+	if err != nil {
+		logMessage("error", fmt.Sprintf("删除订阅失败: %v", err), userID)
+		sendMessage(userID, "删除订阅失败，请稍后重试")
+		return
+	}
+	sendMessage(userID, result)
+}
+
+// handleKeywordCommand 处理 /kw add|del|list
+func handleKeywordCommand(userID int64, message *tgbotapi.Message) {
+	usage := `用法：
+/kw add <关键词...>  添加关键词，多个关键词用空格或逗号分隔
+/kw del <关键词...>  删除关键词
+/kw list  查看关键词
+包含空格的表达式需要用引号括起来，如 /kw add 'expr:title:(rust OR go)'`
+	args, ok := parseCommandArgs(userID, message, usage)
+	if !ok {
+		return
+	}
+	if len(args) == 0 {
+		sendMessage(userID, usage)
+		return
+	}
+
+	action, keywords := strings.ToLower(args[0]), args[1:]
+	switch action {
+	case "list", "ls":
+		actionHandler.viewKeywords(userID, 0)
+
+	case "add":
+		if len(keywords) == 0 {
+			sendMessage(userID, "❌ 请输入要添加的关键词\n"+usage)
+			return
+		}
+		result, err := userErrorResult(addKeywordsForUser(userID, keywords))
+		if err != nil {
+			logMessage("error", fmt.Sprintf("添加关键词失败: %v", err), userID)
+			sendMessage(userID, "添加关键词失败，请稍后重试")
+			return
+		}
+		sendMessage(userID, result)
+
+	case "del", "rm":
+		if len(keywords) == 0 {
+			sendMessage(userID, "❌ 请输入要删除的关键词\n"+usage)
+			return
+		}
+		var results []string
+		for _, keyword := range keywords {
+			result, err := userErrorResult(removeKeywordForUser(userID, keyword))
+			if err != nil {
+				logMessage("error", fmt.Sprintf("删除关键词失败: %v", err), userID)
+				result = fmt.Sprintf("❌ 删除关键词 \"%s\" 失败", keyword)
+			}
+			results = append(results, result)
+		}
+		sendMessage(userID, strings.Join(results, "\n"))
+
+	default:
+		sendMessage(userID, fmt.Sprintf("❌ 未知的操作：%s\n%s", args[0], usage))
+	}
+}
+
+// handleModeCommand 处理 /mode [订阅名称] <方式>，不带参数时显示推送方式菜单
+func handleModeCommand(userID int64, message *tgbotapi.Message) {
+	usage := fmt.Sprintf(`用法：
+/mode <方式>  设置默认推送方式
+/mode <订阅名称> <方式>  设置单个订阅的推送方式，方式为 default 时跟随默认
+可选方式：%s`, strings.Join(deliveryModes, "、"))
+	args, ok := parseCommandArgs(userID, message, usage)
+	if !ok {
+		return
+	}
+
+	switch len(args) {
+	case 0:
+		showDeliveryMenu(userID, 0)
+
+	case 1:
+		mode := strings.ToLower(args[0])
+		if !isValidDeliveryMode(mode) {
+			sendMessage(userID, fmt.Sprintf("❌ 无效的推送方式：%s\n%s", args[0], usage))
+			return
+		}
+		if err := setUserDeliveryMode(userID, mode); err != nil {
+			logMessage("error", fmt.Sprintf("设置推送方式失败: %v", err), userID)
+			sendMessage(userID, "设置推送方式失败，请稍后重试")
+			return
+		}
+		sendMessage(userID, fmt.Sprintf("✅ 默认推送方式已设置为：%s", deliveryModeNames[mode]))
+
+	case 2:
+		mode := strings.ToLower(args[1])
+		if mode == "default" {
+			mode = ""
+		} else if !isValidDeliveryMode(mode) {
+			sendMessage(userID, fmt.Sprintf("❌ 无效的推送方式：%s\n%s", args[1], usage))
+			return
+		}
+		sub, err := findUserSubscription(userID, args[0])
+		if err != nil {
+			logMessage("error", fmt.Sprintf("获取用户订阅失败: %v", err), userID)
+			sendMessage(userID, "获取订阅失败，请稍后重试")
+			return
+		}
+		if sub == nil {
+			sendMessage(userID, fmt.Sprintf("❌ 你没有订阅 \"%s\"，使用 /subs 查看已有订阅", args[0]))
+			return
+		}
+		if err := setSubscriptionDeliveryMode(userID, sub.Name, mode); err != nil {
+			logMessage("error", fmt.Sprintf("设置订阅推送方式失败: %v", err), userID)
+			sendMessage(userID, "设置推送方式失败，请稍后重试")
+			return
+		}
+		if mode == "" {
+			sendMessage(userID, fmt.Sprintf("✅ 订阅 \"%s\" 已改为跟随默认推送方式", sub.Name))
+		} else {
+			sendMessage(userID, fmt.Sprintf("✅ 订阅 \"%s\" 的推送方式已设置为：%s", sub.Name, deliveryModeNames[mode]))
+		}
+
+	default:
+		sendMessage(userID, "❌ "+usage)
+	}
+}
+
+// handlePauseCommand 处理 /pause [时长]，不指定时长时暂停到手动恢复
+func handlePauseCommand(userID int64, args string) {
+	duration := snoozeForever
+	if args = strings.TrimSpace(args); args != "" {
+		var err error
+		duration, err = parseSnoozeDuration(args)
+		if err != nil {
+			sendMessage(userID, "❌ "+err.Error()+"\n用法：/pause 暂停到手动恢复，/pause 2h 暂停2小时")
+			return
+		}
+	}
+
+	result, err := setSnooze(userID, duration)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("设置暂停推送失败: %v", err), userID)
+		sendMessage(userID, "设置暂停推送失败，请稍后重试")
+		return
+	}
+	sendMessage(userID, result+"\n使用 /resume 恢复推送")
+}
+
+// handleResumeCommand 处理 /resume，恢复推送并补发暂停期间的内容
+func handleResumeCommand(userID int64) {
+	result, err := setSnooze(userID, 0)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("恢复推送失败: %v", err), userID)
+		sendMessage(userID, "恢复推送失败，请稍后重试")
+		return
+	}
+	sendMessage(userID, result)
+}
+
+// commandList 返回注册到 Telegram 的命令列表
+func commandList(includeAdmin bool) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, c := range botCommands {
+		if c.adminOnly && !includeAdmin {
+			continue
+		}
+		commands = append(commands, tgbotapi.BotCommand{Command: c.command, Description: c.description})
+	}
+	return commands
+}
+
+// registerBotCommands 注册命令，使客户端显示命令补全；管理员的私聊中额外显示管理命令
+func registerBotCommands() {
+	if _, err := bot.Request(tgbotapi.NewSetMyCommands(commandList(false)...)); err != nil {
+		logMessage("warn", fmt.Sprintf("注册命令失败: %v", err))
+		return
+	}
+
+	adminIDs, err := getAdminIDs()
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取管理员失败: %v", err))
+		return
+	}
+	for _, adminID := range adminIDs {
+		updateUserCommands(adminID)
+	}
+}
+
+// updateUserCommands 按用户当前角色更新其私聊中显示的命令
+func updateUserCommands(userID int64) {
+	scope := tgbotapi.NewBotCommandScopeChat(userID)
+	var config tgbotapi.Chattable = tgbotapi.NewDeleteMyCommandsWithScope(scope)
+	if hasRole(getUserRole(userID), RoleAdmin) {
+		config = tgbotapi.NewSetMyCommandsWithScope(scope, commandList(true)...)
+	}
+	if _, err := bot.Request(config); err != nil {
+		logMessage("warn", fmt.Sprintf("更新命令列表失败: %v", err), userID)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"  add   rust\tgo\n", []string{"add", "rust", "go"}},
+		// 各种引号内的空白保留
+		{`add "machine learning" rust`, []string{"add", "machine learning", "rust"}},
+		{`add 'machine learning'`, []string{"add", "machine learning"}},
+		{"add “机器 学习” ‘显卡 降价’ 「群组 名称」", []string{"add", "机器 学习", "显卡 降价", "群组 名称"}},
+		{`name="My Feed"`, []string{"name=My Feed"}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{`add "" rust`, []string{"add", "", "rust"}},
+		// 不同引号之间互不闭合
+		{`"it's here"`, []string{"it's here"}},
+		{`'say "hi"'`, []string{`say "hi"`}},
+		// 反斜杠转义空白、引号和反斜杠本身
+		{`a\ b c`, []string{"a b", "c"}},
+		{`\"quoted\"`, []string{`"quoted"`}},
+		{`"a \" b"`, []string{`a " b`}},
+		{`a\\b`, []string{`a\b`}},
+		{`trailing\`, []string{`trailing\`}},
+		// 其他反斜杠原样保留，正则关键词不受影响
+		{`add /rust\s+\d+\.\d+/i`, []string{"add", `/rust\s+\d+\.\d+/i`}},
+		{`add "/a\sb c/"`, []string{"add", `/a\sb c/`}},
+		// 单引号内反斜杠不转义
+		{`'C:\path\'`, []string{`C:\path\`}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommandArgs(tt.text)
+		if err != nil {
+			t.Errorf("splitCommandArgs(%q) error: %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommandArgs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommandArgsErrors(t *testing.T) {
+	for _, text := range []string{
+		`add "rust`,
+		`add 'rust`,
+		"add “rust",
+		"add 「rust」」「",
+		`"a \"`,
+		`'it\'s'`,
+	} {
+		if got, err := splitCommandArgs(text); err == nil {
+			t.Errorf("splitCommandArgs(%q) = %q, want error", text, got)
+		}
+	}
+}
+
+func TestParseDisplayMode(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"full", "1", true},
+		{"FULL", "1", true},
+		{"1", "1", true},
+		{"link", "0", true},
+		{"0", "0", true},
+		{"", "", false},
+		{"summary", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDisplayMode(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDisplayMode(%q) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 跨订阅去重：开启后记录用户在去重窗口内收到的推送（规范化链接和标题指纹）
+// 新内容的链接与已推送内容相同（去掉跟踪参数、按 canonical 地址比较），或标题相似时视为重复
+// 标题相似度为特征集合（英文按词、中日文按相邻两字）的 Jaccard 系数，标题中的数字（如版本号）必须完全一致
+// 合并模式下重复内容不再推送，而是在原推送末尾追加 "👀 也见于：X、Y"；丢弃模式下直接不推送
+// 原推送进入摘要或免打扰暂存时没有可编辑的消息，只做去重
+
+const (
+	DedupModeFold = "fold" // 合并到原推送
+	DedupModeDrop = "drop" // 直接丢弃
+
+	DefaultDedupWindowHours = 24 // 开启去重时的默认窗口
+	MaxDedupWindowHours     = 72 // 最大去重窗口，推送记录保留同样时长
+
+	titleSimilarityThreshold = 0.7 // 标题特征 Jaccard 系数不低于此值视为相同
+	minTitleFeatures         = 3   // 标题特征少于此数时只比较归一化后的标题
+
+	canonicalFetchTimeout = 10 * time.Second
+	canonicalCycleBudget  = 30 * time.Second // 每轮检查获取 canonical 地址的总耗时上限，超出后只按原链接和标题去重
+	canonicalMaxBytes     = 256 * 1024       // 查找 canonical 时最多读取的页面大小
+	canonicalCacheSize    = 2000
+
+	pushHistoryTimeLayout = "2006-01-02 15:04:05"
+)
+
+// DedupWindowOptions 可选的去重窗口（小时），0 表示关闭
+var DedupWindowOptions = []int{0, 6, 24, 72}
+
+// dedupModeNames 去重方式显示名称
+var dedupModeNames = map[string]string{
+	DedupModeFold: "合并为 \"也见于\"",
+	DedupModeDrop: "直接丢弃",
+}
+
+// trackingParams 链接中需要去掉的跟踪参数，utm_ 开头的参数另行处理
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "yclid": true,
+	"mc_cid": true, "mc_eid": true, "igshid": true, "_hsenc": true, "_hsmi": true,
+	"ref": true, "ref_src": true, "ref_url": true, "spm": true, "from": true,
+	"share_source": true, "share_medium": true, "vd_source": true, "scene": true, "isappinstalled": true,
+}
+
+var (
+	canonicalLinkTag  = regexp.MustCompile(`(?is)<link\s[^>]*rel\s*=\s*["']?canonical["']?[^>]*>`)
+	canonicalLinkHref = regexp.MustCompile(`(?is)href\s*=\s*["']?([^"'\s>]+)`)
+
+	canonicalCache      = make(map[string]string)
+	canonicalBudgetLeft = canonicalCycleBudget
+	canonicalCacheMutex sync.Mutex
+
+	// dedupMutex 保证查重与写入推送记录、记录消息ID与追加 "也见于" 不会交错
+	dedupMutex sync.Mutex
+
+	pushHistoryPrunedDay  string
+	pushHistoryPruneMutex sync.Mutex
+)
+
+// isValidDedupMode 检查去重方式是否有效
+func isValidDedupMode(mode string) bool {
+	_, ok := dedupModeNames[mode]
+	return ok
+}
+
+// describeDedup 描述用户的去重设置
+func describeDedup(settings *UserSettings) string {
+	if settings.DedupWindow <= 0 {
+		return "未开启"
+	}
+	return fmt.Sprintf("%d 小时内，%s", settings.DedupWindow, dedupModeNames[settings.DedupMode])
+}
+
+// normalizeLink 规范化链接：忽略协议、www 前缀、默认端口、锚点和末尾斜杠，去掉跟踪参数并排序查询参数
+func normalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+
+	normalized := host + strings.TrimRight(u.EscapedPath(), "/")
+	if encoded := query.Encode(); encoded != "" {
+		normalized += "?" + encoded
+	}
+	return normalized
+}
+
+// resetCanonicalBudget 每轮检查开始时重置获取 canonical 地址的耗时预算
+func resetCanonicalBudget() {
+	canonicalCacheMutex.Lock()
+	canonicalBudgetLeft = canonicalCycleBudget
+	canonicalCacheMutex.Unlock()
+}
+
+// resolveCanonicalLink 获取链接跳转后的最终地址和页面声明的 canonical 地址，失败时返回空
+// 结果按链接缓存；本轮预算用完后不再请求，也不缓存，下一轮再尝试
+func resolveCanonicalLink(client *http.Client, link string) string {
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return ""
+	}
+
+	canonicalCacheMutex.Lock()
+	canonical, ok := canonicalCache[link]
+	budget := canonicalBudgetLeft
+	canonicalCacheMutex.Unlock()
+	if ok {
+		return canonical
+	}
+	if budget <= 0 {
+		logMessage("debug", fmt.Sprintf("本轮获取canonical地址的时间已用完，跳过 %s", link))
+		return ""
+	}
+
+	start := time.Now()
+	timeout := min(budget, canonicalFetchTimeout)
+	canonical = fetchCanonicalLink(client, link, timeout)
+
+	canonicalCacheMutex.Lock()
+	canonicalBudgetLeft -= time.Since(start)
+	if canonical == "" && timeout < canonicalFetchTimeout {
+		// 可能因预算不足而超时，不缓存失败结果
+		canonicalCacheMutex.Unlock()
+		return ""
+	}
+	if len(canonicalCache) >= canonicalCacheSize {
+		canonicalCache = make(map[string]string)
+	}
+	canonicalCache[link] = canonical
+	canonicalCacheMutex.Unlock()
+	return canonical
+}
+
+// fetchCanonicalLink 请求页面并解析 <link rel="canonical">，没有声明时返回跳转后的地址
+func fetchCanonicalLink(client *http.Client, link string, timeout time.Duration) string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logMessage("debug", fmt.Sprintf("获取canonical地址失败 %s: %v", link, err))
+		return ""
+	}
+	defer resp.Body.Close()
+
+	final := resp.Request.URL
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return final.String()
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, canonicalMaxBytes))
+	if err != nil {
+		return final.String()
+	}
+	tag := canonicalLinkTag.Find(body)
+	if tag == nil {
+		return final.String()
+	}
+	href := canonicalLinkHref.FindSubmatch(tag)
+	if href == nil {
+		return final.String()
+	}
+	ref, err := url.Parse(html.UnescapeString(string(href[1])))
+	if err != nil {
+		return final.String()
+	}
+	return final.ResolveReference(ref).String()
+}
+
+// titleFingerprint 标题指纹
+type titleFingerprint struct {
+	text     string          // 归一化后的标题
+	features map[string]bool // 标题特征集合
+	numbers  string          // 标题中的数字，按出现顺序
+}
+
+// normalizeTitle 归一化标题：简繁、全角半角折叠并转为小写，只保留字母数字，词之间用一个空格分隔
+func normalizeTitle(title string) string {
+	folded := strings.ToLower(foldChineseText(title))
+	return strings.Join(strings.FieldsFunc(folded, func(r rune) bool { return !isWordRune(r) }), " ")
+}
+
+// titleFeatures 提取标题特征：英文等按词切分，中日文按相邻两字切分
+func titleFeatures(text string) []string {
+	var features []string
+	for _, field := range strings.Fields(text) {
+		var word []rune
+		var cjk []rune
+		flushCJK := func() {
+			if len(cjk) == 1 {
+				features = append(features, string(cjk))
+			}
+			for i := 0; i+1 < len(cjk); i++ {
+				features = append(features, string(cjk[i:i+2]))
+			}
+			cjk = nil
+		}
+		for _, r := range field {
+			if isCJKRune(r) {
+				if len(word) > 0 {
+					features = append(features, string(word))
+					word = nil
+				}
+				cjk = append(cjk, r)
+				continue
+			}
+			flushCJK()
+			word = append(word, r)
+		}
+		flushCJK()
+		if len(word) > 0 {
+			features = append(features, string(word))
+		}
+	}
+	return features
+}
+
+// newTitleFingerprint 根据归一化后的标题计算指纹
+func newTitleFingerprint(text string) titleFingerprint {
+	fingerprint := titleFingerprint{text: text, features: make(map[string]bool)}
+	var numbers []string
+	for _, feature := range titleFeatures(text) {
+		fingerprint.features[feature] = true
+		if strings.ContainsAny(feature, "0123456789") {
+			numbers = append(numbers, feature)
+		}
+	}
+	fingerprint.numbers = strings.Join(numbers, " ")
+	return fingerprint
+}
+
+// similar 判断两个标题是否相似
+func (f titleFingerprint) similar(other titleFingerprint) bool {
+	if f.text == "" || other.text == "" {
+		return false
+	}
+	if f.text == other.text {
+		return true
+	}
+	if f.numbers != other.numbers {
+		return false
+	}
+	if len(f.features) < minTitleFeatures || len(other.features) < minTitleFeatures {
+		return false
+	}
+
+	common := 0
+	for feature := range f.features {
+		if other.features[feature] {
+			common++
+		}
+	}
+	union := len(f.features) + len(other.features) - common
+	return float64(common)/float64(union) >= titleSimilarityThreshold
+}
+
+// pushRecord 推送记录
+type pushRecord struct {
+	id           int64
+	rssName      string
+	linkKey      string
+	canonicalKey string
+	title        titleFingerprint
+	messageID    int
+	isPhoto      bool
+	content      string
+	alsoSeen     []string
+}
+
+// sameLink 判断两条推送记录的链接是否相同，原链接和 canonical 地址交叉比较
+func (r *pushRecord) sameLink(other *pushRecord) bool {
+	for _, a := range []string{r.linkKey, r.canonicalKey} {
+		if a == "" {
+			continue
+		}
+		if a == other.linkKey || a == other.canonicalKey {
+			return true
+		}
+	}
+	return false
+}
+
+// newPushRecord 根据消息构造推送记录，开启去重时会请求原文获取 canonical 地址
+func newPushRecord(rssName string, msg Message, client *http.Client) *pushRecord {
+	record := &pushRecord{
+		rssName: rssName,
+		linkKey: normalizeLink(msg.Link),
+		title:   newTitleFingerprint(normalizeTitle(msg.Title)),
+	}
+	if canonical := resolveCanonicalLink(client, strings.TrimSpace(msg.Link)); canonical != "" {
+		if key := normalizeLink(canonical); key != record.linkKey {
+			record.canonicalKey = key
+		}
+	}
+	return record
+}
+
+// checkDuplicatePush 检查消息是否与用户去重窗口内的推送重复
+// 不重复时写入推送记录并返回记录ID（未开启去重时返回0），重复时返回 true
+func checkDuplicatePush(userID int64, rssName string, msg Message, client *http.Client) (int64, bool) {
+	settings, err := GetUserSettings(userID)
+	if err != nil || settings.DedupWindow <= 0 {
+		return 0, false
+	}
+
+	record := newPushRecord(rssName, msg, client)
+	since := time.Now().UTC().Add(-time.Duration(settings.DedupWindow) * time.Hour).Format(pushHistoryTimeLayout)
+
+	dedupMutex.Lock()
+	defer dedupMutex.Unlock()
+
+	var original *pushRecord
+	err = withDB(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT id, rss_name, link_key, canonical_key, title_norm, message_id, is_photo, content, also_seen
+			FROM push_history WHERE user_id = ? AND created_at >= ? ORDER BY id`, userID, since)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r pushRecord
+			var titleText, alsoSeen string
+			if err := rows.Scan(&r.id, &r.rssName, &r.linkKey, &r.canonicalKey, &titleText,
+				&r.messageID, &r.isPhoto, &r.content, &alsoSeen); err != nil {
+				return err
+			}
+			r.title = newTitleFingerprint(titleText)
+			if record.sameLink(&r) || record.title.similar(r.title) {
+				json.Unmarshal([]byte(alsoSeen), &r.alsoSeen)
+				original = &r
+				return nil
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("查询推送记录失败: %v", err), userID)
+		return 0, false
+	}
+
+	if original != nil {
+		logMessage("debug", fmt.Sprintf("重复内容已去重（原推送来自 %s）: %s", original.rssName, msg.Title), userID)
+		if settings.DedupMode != DedupModeDrop {
+			foldDuplicatePush(userID, original, rssName)
+		}
+		return 0, true
+	}
+
+	var id int64
+	err = withDB(func(db *sql.DB) error {
+		result, err := db.Exec(`
+			INSERT INTO push_history
+			(user_id, rss_name, link_key, canonical_key, title_norm, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, rssName, record.linkKey, record.canonicalKey, record.title.text,
+			time.Now().UTC().Format(pushHistoryTimeLayout))
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("保存推送记录失败: %v", err), userID)
+		return 0, false
+	}
+	return id, false
+}
+
+// foldDuplicatePush 将重复内容的订阅名称记入原推送，原推送已发送时追加 "也见于"
+func foldDuplicatePush(userID int64, original *pushRecord, rssName string) {
+	if rssName == original.rssName {
+		return
+	}
+	for _, name := range original.alsoSeen {
+		if name == rssName {
+			return
+		}
+	}
+	original.alsoSeen = append(original.alsoSeen, rssName)
+
+	alsoSeenJSON, _ := json.Marshal(original.alsoSeen)
+	err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE push_history SET also_seen = ? WHERE id = ?", string(alsoSeenJSON), original.id)
+		return err
+	})
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("更新推送记录失败: %v", err), userID)
+		return
+	}
+	if original.messageID != 0 {
+		editPushAlsoSeen(userID, original)
+	}
+}
+
+// attachPushMessage 记录推送发送后的消息ID，发送期间出现的重复内容在此时补充 "也见于"
+func attachPushMessage(userID int64, pushID int64, messageID int, isPhoto bool, content string) {
+	dedupMutex.Lock()
+	defer dedupMutex.Unlock()
+
+	record := &pushRecord{id: pushID, messageID: messageID, isPhoto: isPhoto, content: content}
+	var alsoSeen string
+	err := withDB(func(db *sql.DB) error {
+		if _, err := db.Exec("UPDATE push_history SET message_id = ?, is_photo = ?, content = ? WHERE id = ?",
+			messageID, isPhoto, content, pushID); err != nil {
+			return err
+		}
+		return db.QueryRow("SELECT also_seen FROM push_history WHERE id = ?", pushID).Scan(&alsoSeen)
+	})
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("更新推送记录失败: %v", err), userID)
+		return
+	}
+	json.Unmarshal([]byte(alsoSeen), &record.alsoSeen)
+	if len(record.alsoSeen) > 0 {
+		editPushAlsoSeen(userID, record)
+	}
+}
+
+// editPushAlsoSeen 编辑原推送，在末尾追加 "也见于" 的订阅列表
+func editPushAlsoSeen(userID int64, record *pushRecord) {
+	names := make([]string, len(record.alsoSeen))
+	for i, name := range record.alsoSeen {
+		names[i] = html.EscapeString(name)
+	}
+	text := strings.TrimRight(record.content, "\n") + "\n👀 也见于：" + strings.Join(names, "、")
+
+	var edit tgbotapi.Chattable
+	if record.isPhoto {
+		if utf8.RuneCountInString(text) > 1024 {
+			return // 超出图片说明长度限制，保持原样
+		}
+		caption := tgbotapi.NewEditMessageCaption(userID, record.messageID, text)
+		caption.ParseMode = "HTML"
+		edit = caption
+	} else {
+		if utf8.RuneCountInString(text) > 4096 {
+			return
+		}
+		message := tgbotapi.NewEditMessageText(userID, record.messageID, text)
+		message.ParseMode = "HTML"
+		edit = message
+	}
+	if _, err := bot.Send(edit); err != nil {
+		logMessage("warn", fmt.Sprintf("追加 \"也见于\" 失败: %v", err), userID)
+	}
+}
+
+// sendTrackedPush 发送推送，pushID 不为0时记录消息ID以便之后追加 "也见于"
+func sendTrackedPush(userID int64, rssName, imageURL, htmlMessage string, pushID int64) {
+	var sent tgbotapi.Message
+	var err error
+	if imageURL != "" {
+		sent, err = sendPhotoMessage(userID, imageURL, htmlMessage)
+		if err == nil && len(sent.Photo) == 0 {
+			htmlMessage = photoFallbackText(imageURL, htmlMessage)
+		}
+	} else {
+		sent, err = sendHTMLMessage(userID, htmlMessage)
+	}
+	if err != nil {
+		// 用户没有收到推送，删除推送记录，避免其他订阅中的相同内容被当作重复
+		if pushID != 0 {
+			deletePushRecord(userID, pushID)
+		}
+		return
+	}
+	metricFeedPushes.Inc(rssName)
+	recordPush(rssName)
+	if pushID == 0 {
+		return
+	}
+	attachPushMessage(userID, pushID, sent.MessageID, len(sent.Photo) > 0, htmlMessage)
+}
+
+// deletePushRecord 删除发送失败的推送记录
+func deletePushRecord(userID int64, pushID int64) {
+	dedupMutex.Lock()
+	defer dedupMutex.Unlock()
+
+	err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec("DELETE FROM push_history WHERE id = ?", pushID)
+		return err
+	})
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("删除推送记录失败: %v", err), userID)
+	}
+}
+
+// prunePushHistory 清理超出最大去重窗口的推送记录，每天最多执行一次
+func prunePushHistory(db *sql.DB) {
+	today := time.Now().UTC().Format(keywordHitDayLayout)
+
+	pushHistoryPruneMutex.Lock()
+	defer pushHistoryPruneMutex.Unlock()
+	if pushHistoryPrunedDay == today {
+		return
+	}
+
+	cutoff := time.Now().UTC().Add(-MaxDedupWindowHours * time.Hour).Format(pushHistoryTimeLayout)
+	result, err := db.Exec("DELETE FROM push_history WHERE created_at < ?", cutoff)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("清理推送记录失败: %v", err))
+		return
+	}
+	pushHistoryPrunedDay = today
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		logMessage("debug", fmt.Sprintf("已清理 %d 条过期的推送记录", affected))
+	}
+}
+
+// showDedupMenu 显示跨订阅去重设置
+func showDedupMenu(userID int64, messageID int) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取设置失败，请稍后重试")
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var windowRow []tgbotapi.InlineKeyboardButton
+	for _, hours := range DedupWindowOptions {
+		label := "关闭"
+		if hours > 0 {
+			label = fmt.Sprintf("%d小时", hours)
+		}
+		if hours == settings.DedupWindow {
+			label = "✅ " + label
+		}
+		windowRow = append(windowRow, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("set_dedup_window_%d", hours)))
+	}
+	rows = append(rows, windowRow)
+
+	var modeRow []tgbotapi.InlineKeyboardButton
+	for _, mode := range []string{DedupModeFold, DedupModeDrop} {
+		label := dedupModeNames[mode]
+		if mode == settings.DedupMode {
+			label = "✅ " + label
+		}
+		modeRow = append(modeRow, tgbotapi.NewInlineKeyboardButtonData(label, "set_dedup_mode_"+mode))
+	}
+	rows = append(rows, modeRow, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+	))
+
+	text := fmt.Sprintf(`🔁 跨订阅去重
+
+当前：%s
+
+同一条新闻出现在多个订阅中时只推送一次：
+• 链接相同（忽略 utm_ 等跟踪参数，按原文声明的 canonical 地址比较）或标题高度相似即视为重复
+• 合并：在第一次推送的消息末尾追加 "👀 也见于：订阅A、订阅B"
+• 丢弃：重复内容直接不推送
+• 进入摘要或免打扰暂存的推送只去重，不追加 "也见于"`, describeDedup(settings))
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleDedupCallback 处理去重设置按钮，value 格式为 "window_<小时>" 或 "mode_<方式>"
+func handleDedupCallback(userID int64, messageID int, value string) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+
+	fields := make(map[string]interface{})
+	switch {
+	case strings.HasPrefix(value, "window_"):
+		var hours int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(value, "window_"), "%d", &hours); err != nil ||
+			hours < 0 || hours > MaxDedupWindowHours {
+			messageSender.SendError(userID, messageID, "❌ 无效的去重窗口")
+			return
+		}
+		settings.DedupWindow = hours
+		fields["dedup_window"] = hours
+	case strings.HasPrefix(value, "mode_"):
+		mode := strings.TrimPrefix(value, "mode_")
+		if !isValidDedupMode(mode) {
+			messageSender.SendError(userID, messageID, "❌ 无效的去重方式")
+			return
+		}
+		settings.DedupMode = mode
+		fields["dedup_mode"] = mode
+		if settings.DedupWindow == 0 {
+			settings.DedupWindow = DefaultDedupWindowHours
+			fields["dedup_window"] = settings.DedupWindow
+		}
+	default:
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+
+	if err := UpdateUserSettingFields(userID, fields); err != nil {
+		logMessage("error", fmt.Sprintf("保存去重设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("用户设置跨订阅去重: %s", describeDedup(settings)), userID)
+	showDedupMenu(userID, messageID)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"https://example.com/a/b", "example.com/a/b"},
+		// 协议、www、大小写主机名、末尾斜杠和锚点不影响结果
+		{"http://www.Example.com/a/b/#comments", "example.com/a/b"},
+		{"https://example.com/", "example.com"},
+		{"  https://example.com/a  ", "example.com/a"},
+		// 默认端口忽略，其他端口保留
+		{"http://example.com:80/a", "example.com/a"},
+		{"https://example.com:443/a", "example.com/a"},
+		{"https://example.com:8443/a", "example.com:8443/a"},
+		// 去掉跟踪参数，其余参数排序
+		{"https://example.com/p?utm_source=rss&id=2&fbclid=x", "example.com/p?id=2"},
+		{"https://example.com/p?UTM_Medium=feed&Ref=hn", "example.com/p"},
+		{"https://example.com/p?b=2&a=1", "example.com/p?a=1&b=2"},
+		{"https://example.com/p?spm=a.b.c&vd_source=123", "example.com/p"},
+		// 路径大小写和编码保持不变
+		{"https://example.com/Post/%E4%BD%A0", "example.com/Post/%E4%BD%A0"},
+		// 无法解析或没有主机名时原样返回
+		{"not a link", "not a link"},
+		{" /relative/path ", "/relative/path"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeLink(tt.link); got != tt.want {
+			t.Errorf("normalizeLink(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Rust 1.80 Released!", "rust 1 80 released"},
+		{"  【快讯】显卡 降价  ", "快讯 显卡 降价"},
+		{"新款顯卡 ＲＴＸ５０９０", "新款显卡 rtx5090"},
+		{"snake_case title", "snake_case title"},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeTitle(tt.title); got != tt.want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestTitleFingerprintSimilar(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		// 归一化后相同
+		{"Rust 1.80 released", "RUST 1.80 Released!", true},
+		{"新款顯卡发布", "新款显卡发布", true},
+		// 多一个词，Jaccard 系数 6/7
+		{"Apple announces new iPhone at event", "Apple announces new iPhone at big event", true},
+		{"苹果发布新款手机 官方", "苹果发布新款手机", true},
+		// 数字不同时不视为相同，避免合并不同版本的新闻
+		{"Rust 1.80 released today", "Rust 1.81 released today", false},
+		// 共同特征不足
+		{"Apple announces new iPhone", "Google announces new Pixel", false},
+		// 特征太少时只比较完整标题
+		{"Rust", "Rust news", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		a := newTitleFingerprint(normalizeTitle(tt.a))
+		b := newTitleFingerprint(normalizeTitle(tt.b))
+		if got := a.similar(b); got != tt.want {
+			t.Errorf("similar(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.similar(a); got != tt.want {
+			t.Errorf("similar(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestTitleFeatures(t *testing.T) {
+	got := titleFeatures("rust发布 新款手机 a")
+	want := []string{"rust", "发布", "新款", "款手", "手机", "a"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("titleFeatures = %q, want %q", got, want)
+	}
+}
+
+func TestPushRecordSameLink(t *testing.T) {
+	a := &pushRecord{linkKey: "feeds.example.com/r/1", canonicalKey: "example.com/post/1"}
+	tests := []struct {
+		other *pushRecord
+		want  bool
+	}{
+		{&pushRecord{linkKey: "feeds.example.com/r/1"}, true},
+		{&pushRecord{linkKey: "example.com/post/1"}, true},
+		{&pushRecord{linkKey: "other.com/x", canonicalKey: "example.com/post/1"}, true},
+		{&pushRecord{linkKey: "other.com/x"}, false},
+		{&pushRecord{}, false},
+	}
+	for _, tt := range tests {
+		if got := a.sameLink(tt.other); got != tt.want {
+			t.Errorf("sameLink(%+v) = %v, want %v", tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestFetchCanonicalLink(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><LINK href="/posts/1?a=1&amp;b=2" rel='canonical'></head></html>`)
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>no canonical</title></head></html>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/plain", http.StatusFound)
+	})
+	mux.HandleFunc("/data.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"link": "<link rel=canonical href=/nope>"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/article", server.URL + "/posts/1?a=1&b=2"},
+		{"/plain", server.URL + "/plain"},
+		{"/redirect", server.URL + "/plain"},
+		{"/data.json", server.URL + "/data.json"},
+	}
+	for _, tt := range tests {
+		if got := fetchCanonicalLink(server.Client(), server.URL+tt.path, canonicalFetchTimeout); got != tt.want {
+			t.Errorf("fetchCanonicalLink(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if got := resolveCanonicalLink(server.Client(), "ftp://example.com/file"); got != "" {
+		t.Errorf("resolveCanonicalLink(ftp) = %q, want empty", got)
+	}
+}
+
+func TestResolveCanonicalLinkBudget(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<link rel="canonical" href="/canonical">`)
+	}))
+	defer server.Close()
+	t.Cleanup(resetCanonicalBudget)
+
+	// 预算用完后不再请求，也不缓存
+	canonicalCacheMutex.Lock()
+	canonicalBudgetLeft = 0
+	canonicalCacheMutex.Unlock()
+	if got := resolveCanonicalLink(server.Client(), server.URL+"/a"); got != "" || requests != 0 {
+		t.Errorf("resolveCanonicalLink without budget = %q after %d requests, want empty and no request", got, requests)
+	}
+
+	// 下一轮重新请求，之后命中缓存
+	resetCanonicalBudget()
+	want := server.URL + "/canonical"
+	for i := 0; i < 2; i++ {
+		if got := resolveCanonicalLink(server.Client(), server.URL+"/a"); got != want {
+			t.Errorf("resolveCanonicalLink = %q, want %q", got, want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,940 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 推送目标：用户可以把订阅推送到自己管理的群组、超级群组或频道
+// 添加时通过 getChatMember 确认用户是该会话的创建者或管理员，且 Bot 是管理员（频道需有发消息权限）
+// 每个目标单独设置推送格式和关键词，并选择要转发的订阅（只能选择自己已订阅的）
+// Bot 被移出或降级时通过 my_chat_member 更新停用目标并通知所有者，重新设为管理员后自动恢复
+
+// 推送目标格式
+const (
+	DestinationFormatFollow = "follow" // 跟随订阅设置
+	DestinationFormatFull   = "full"   // 完整内容
+	DestinationFormatLink   = "link"   // 标题和链接
+)
+
+// 推送目标关键词方式
+const (
+	DestinationKeywordsOwner  = "owner"  // 使用所有者的关键词和生效范围
+	DestinationKeywordsCustom = "custom" // 使用目标单独的关键词
+	DestinationKeywordsAll    = "all"    // 全部推送，自定义关键词中的屏蔽词仍然生效
+)
+
+var destinationFormatNames = map[string]string{
+	DestinationFormatFollow: "跟随订阅",
+	DestinationFormatFull:   "完整内容",
+	DestinationFormatLink:   "标题和链接",
+}
+
+var destinationKeywordModeNames = map[string]string{
+	DestinationKeywordsOwner:  "使用我的关键词",
+	DestinationKeywordsCustom: "单独的关键词",
+	DestinationKeywordsAll:    "全部推送",
+}
+
+var chatTypeNames = map[string]string{
+	"group":      "群组",
+	"supergroup": "超级群组",
+	"channel":    "频道",
+}
+
+// Destination 推送目标
+type Destination struct {
+	ID          int64
+	OwnerID     int64
+	ChatID      int64
+	ChatType    string
+	Title       string
+	Active      bool
+	Format      string
+	KeywordMode string
+	Keywords    []string
+	IsForum     bool                // 是否为开启话题的超级群组
+	Routes      []string            // 转发到此目标的订阅名称
+	Topics      []*DestinationTopic // 话题路由
+}
+
+// engineKey 推送目标的自定义关键词在关键词引擎中使用的键，取远小于任何会话ID的负数，避免与用户和群组ID冲突
+func (d *Destination) engineKey() int64 {
+	return math.MinInt64 + d.ID
+}
+
+// label 目标的显示名称
+func (d *Destination) label() string {
+	title := d.Title
+	if title == "" {
+		title = strconv.FormatInt(d.ChatID, 10)
+	}
+	return fmt.Sprintf("%s（%s）", title, chatTypeNames[d.ChatType])
+}
+
+// applyFormat 返回按目标格式调整后的订阅
+func (d *Destination) applyFormat(sub Subscription) Subscription {
+	switch d.Format {
+	case DestinationFormatFull:
+		sub.Channel = 1
+	case DestinationFormatLink:
+		sub.Channel = 0
+	}
+	return sub
+}
+
+// destinationColumns 查询推送目标的列
+const destinationColumns = "id, owner_id, chat_id, chat_type, title, active, format, keyword_mode, keywords, is_forum"
+
+// scanDestination 读取一行推送目标
+func scanDestination(scanner interface{ Scan(...interface{}) error }) (*Destination, error) {
+	var dest Destination
+	var keywordsJSON string
+	if err := scanner.Scan(&dest.ID, &dest.OwnerID, &dest.ChatID, &dest.ChatType, &dest.Title, &dest.Active,
+		&dest.Format, &dest.KeywordMode, &keywordsJSON, &dest.IsForum); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(keywordsJSON), &dest.Keywords)
+	return &dest, nil
+}
+
+// loadDestinationRoutes 读取推送目标转发的订阅
+func loadDestinationRoutes(db *sql.DB, dests []*Destination) error {
+	if len(dests) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*Destination, len(dests))
+	for _, dest := range dests {
+		byID[dest.ID] = dest
+	}
+
+	rows, err := db.Query("SELECT destination_id, rss_name FROM destination_routes ORDER BY rss_name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var rssName string
+		if err := rows.Scan(&id, &rssName); err != nil {
+			return err
+		}
+		if dest, ok := byID[id]; ok {
+			dest.Routes = append(dest.Routes, rssName)
+		}
+	}
+	return rows.Err()
+}
+
+// getDestinationsForUser 获取用户的所有推送目标
+func getDestinationsForUser(userID int64) ([]*Destination, error) {
+	var dests []*Destination
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT "+destinationColumns+" FROM destinations WHERE owner_id = ? ORDER BY id", userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			dest, err := scanDestination(rows)
+			if err != nil {
+				return err
+			}
+			dests = append(dests, dest)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := loadDestinationRoutes(db, dests); err != nil {
+			return err
+		}
+		return loadDestinationTopics(db, dests)
+	})
+	return dests, err
+}
+
+// getDestinationForUser 获取用户的单个推送目标
+func getDestinationForUser(userID, destID int64) (*Destination, error) {
+	dests, err := getDestinationsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, dest := range dests {
+		if dest.ID == destID {
+			return dest, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// getActiveDestinations 获取所有启用中的推送目标，返回 订阅名称 -> 推送目标列表
+func getActiveDestinations(db *sql.DB) (map[string][]*Destination, error) {
+	rows, err := db.Query("SELECT " + destinationColumns + " FROM destinations WHERE active = 1")
+	if err != nil {
+		return nil, err
+	}
+	var dests []*Destination
+	for rows.Next() {
+		dest, err := scanDestination(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dests = append(dests, dest)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadDestinationRoutes(db, dests); err != nil {
+		return nil, err
+	}
+	if err := loadDestinationTopics(db, dests); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]*Destination)
+	for _, dest := range dests {
+		for _, rssName := range dest.Routes {
+			result[rssName] = append(result[rssName], dest)
+		}
+	}
+	return result, nil
+}
+
+// saveDestination 保存推送目标，已存在时更新会话信息并重新启用
+func saveDestination(ownerID int64, chat tgbotapi.Chat) (int64, error) {
+	forum := chat.IsSuperGroup() && isForumChat(chat.ID)
+	var id int64
+	err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO destinations (owner_id, chat_id, chat_type, title, active, is_forum)
+			VALUES (?, ?, ?, ?, 1, ?)
+			ON CONFLICT(owner_id, chat_id) DO UPDATE SET
+				chat_type = excluded.chat_type, title = excluded.title, active = 1, is_forum = excluded.is_forum`,
+			ownerID, chat.ID, chat.Type, chat.Title, forum)
+		if err != nil {
+			return err
+		}
+		return db.QueryRow("SELECT id FROM destinations WHERE owner_id = ? AND chat_id = ?", ownerID, chat.ID).Scan(&id)
+	})
+	return id, err
+}
+
+// updateDestination 更新推送目标的格式和关键词设置
+func updateDestination(dest *Destination) error {
+	keywordsJSON, err := json.Marshal(dest.Keywords)
+	if err != nil {
+		return err
+	}
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE destinations SET format = ?, keyword_mode = ?, keywords = ? WHERE id = ? AND owner_id = ?",
+			dest.Format, dest.KeywordMode, string(keywordsJSON), dest.ID, dest.OwnerID)
+		return err
+	})
+}
+
+// toggleDestinationRoute 切换订阅是否转发到推送目标，返回切换后的状态
+func toggleDestinationRoute(dest *Destination, rssName string) (bool, error) {
+	for _, route := range dest.Routes {
+		if route == rssName {
+			return false, withDB(func(db *sql.DB) error {
+				_, err := db.Exec("DELETE FROM destination_routes WHERE destination_id = ? AND rss_name = ?", dest.ID, rssName)
+				return err
+			})
+		}
+	}
+	return true, withDB(func(db *sql.DB) error {
+		_, err := db.Exec("INSERT OR IGNORE INTO destination_routes (destination_id, rss_name) VALUES (?, ?)", dest.ID, rssName)
+		return err
+	})
+}
+
+// setDestinationRoutes 替换转发到推送目标的订阅
+func setDestinationRoutes(dest *Destination, rssNames []string) error {
+	return withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("DELETE FROM destination_routes WHERE destination_id = ?", dest.ID); err != nil {
+			return err
+		}
+		for _, rssName := range rssNames {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO destination_routes (destination_id, rss_name) VALUES (?, ?)", dest.ID, rssName); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		dest.Routes = rssNames
+		return nil
+	})
+}
+
+// deleteDestination 删除推送目标及其转发设置
+func deleteDestination(dest *Destination) error {
+	return withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("DELETE FROM destination_routes WHERE destination_id = ?", dest.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM destination_topics WHERE destination_id = ?", dest.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM destinations WHERE id = ? AND owner_id = ?", dest.ID, dest.OwnerID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// deactivateDestinations 停用指定会话的所有推送目标，返回受影响的目标
+func deactivateDestinations(chatID int64) ([]*Destination, error) {
+	var dests []*Destination
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT "+destinationColumns+" FROM destinations WHERE chat_id = ? AND active = 1", chatID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			dest, err := scanDestination(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			dests = append(dests, dest)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		_, err = db.Exec("UPDATE destinations SET active = 0 WHERE chat_id = ?", chatID)
+		return err
+	})
+	return dests, err
+}
+
+// migrateDestinationChat 群组升级为超级群组后更新会话ID
+func migrateDestinationChat(oldChatID, newChatID int64) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE destinations SET chat_id = ?, chat_type = 'supergroup' WHERE chat_id = ?", newChatID, oldChatID)
+		return err
+	})
+}
+
+// parseChatReference 解析用户输入的会话：数字ID、@用户名或 t.me 链接
+func parseChatReference(text string) (tgbotapi.ChatConfig, error) {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "https://")
+	text = strings.TrimPrefix(text, "http://")
+	text = strings.TrimPrefix(text, "t.me/")
+	if text == "" {
+		return tgbotapi.ChatConfig{}, fmt.Errorf("请输入会话ID或 @用户名")
+	}
+	if id, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return tgbotapi.ChatConfig{ChatID: id}, nil
+	}
+	if !strings.HasPrefix(text, "@") {
+		text = "@" + text
+	}
+	return tgbotapi.ChatConfig{SuperGroupUsername: text}, nil
+}
+
+// getChatMemberStatus 获取用户在会话中的成员信息
+func getChatMemberStatus(chatID, userID int64) (tgbotapi.ChatMember, error) {
+	return bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+}
+
+// verifyDestination 校验会话能否作为用户的推送目标：用户须是创建者或管理员，Bot 须是管理员
+func verifyDestination(userID int64, chat tgbotapi.Chat) error {
+	if chat.IsPrivate() {
+		return fmt.Errorf("只能添加群组、超级群组或频道")
+	}
+
+	member, err := getChatMemberStatus(chat.ID, userID)
+	if err != nil {
+		return fmt.Errorf("无法确认你在该会话中的身份: %v", err)
+	}
+	if !member.IsCreator() && !member.IsAdministrator() {
+		return fmt.Errorf("只有该会话的创建者或管理员才能添加推送")
+	}
+
+	botMember, err := getChatMemberStatus(chat.ID, bot.Self.ID)
+	if err != nil {
+		return fmt.Errorf("无法确认 Bot 在该会话中的身份: %v", err)
+	}
+	if !botMember.IsAdministrator() && !botMember.IsCreator() {
+		return fmt.Errorf("请先将 @%s 设为该会话的管理员", bot.Self.UserName)
+	}
+	if chat.IsChannel() && !botMember.CanPostMessages {
+		return fmt.Errorf("请在频道管理员设置中允许 @%s 发布消息", bot.Self.UserName)
+	}
+	return nil
+}
+
+// addDestinationByReference 根据用户输入添加推送目标
+func addDestinationByReference(userID int64, text string) (*Destination, error) {
+	chatConfig, err := parseChatReference(text)
+	if err != nil {
+		return nil, err
+	}
+	chat, err := bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: chatConfig})
+	if err != nil {
+		return nil, fmt.Errorf("找不到该会话，请确认 Bot 已加入: %v", err)
+	}
+	if err := verifyDestination(userID, chat); err != nil {
+		return nil, err
+	}
+	id, err := saveDestination(userID, chat)
+	if err != nil {
+		return nil, err
+	}
+	return getDestinationForUser(userID, id)
+}
+
+// handleMyChatMember 处理 Bot 在群组或频道中的成员状态变化
+// 被设为管理员时为操作者自动添加推送目标，被移出或降级时停用相关目标
+func handleMyChatMember(update *tgbotapi.ChatMemberUpdated) {
+	chat := update.Chat
+	if chat.IsPrivate() {
+		return
+	}
+	newMember := update.NewChatMember
+
+	if newMember.IsAdministrator() || newMember.IsCreator() {
+		userID := update.From.ID
+		if err := verifyDestination(userID, chat); err != nil {
+			logMessage("debug", fmt.Sprintf("未自动添加推送目标 %s: %v", chat.Title, err), userID)
+			return
+		}
+		if _, err := saveDestination(userID, chat); err != nil {
+			logMessage("error", fmt.Sprintf("保存推送目标失败: %v", err), userID)
+			return
+		}
+		logMessage("info", fmt.Sprintf("已添加推送目标: %s (%d)", chat.Title, chat.ID), userID)
+		sendMessage(userID, fmt.Sprintf("📢 已添加推送目标：%s\n\n在 ⚙️ 个人设置 → 📢 群组/频道推送 中选择要转发的订阅", chat.Title))
+		return
+	}
+
+	// 被移出、封禁或降为普通成员
+	dests, err := deactivateDestinations(chat.ID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("停用推送目标失败: %v", err))
+		return
+	}
+	for _, dest := range dests {
+		logMessage("info", fmt.Sprintf("Bot 已失去会话权限，停用推送目标: %s", dest.label()), dest.OwnerID)
+		notifyDestinationInactive(dest, "Bot 已被移出或不再是管理员")
+	}
+}
+
+// notifyDestinationInactive 通知所有者推送目标已停用
+func notifyDestinationInactive(dest *Destination, reason string) {
+	sendMessage(dest.OwnerID, fmt.Sprintf("⚠️ 推送目标 %s 已停用：%s\n\n重新将 Bot 设为管理员后会自动恢复", dest.label(), reason))
+}
+
+// engineKeywords 返回用于编译关键词引擎的关键词，包含推送目标单独的关键词
+func engineKeywords(userKeywords map[int64][]string, destinations map[string][]*Destination) map[int64][]string {
+	merged := make(map[int64][]string, len(userKeywords))
+	for userID, keywords := range userKeywords {
+		merged[userID] = keywords
+	}
+	for _, dests := range destinations {
+		for _, dest := range dests {
+			if dest.KeywordMode != DestinationKeywordsOwner && len(dest.Keywords) > 0 {
+				merged[dest.engineKey()] = dest.Keywords
+			}
+		}
+	}
+	return merged
+}
+
+// deliverToDestination 按推送目标的关键词设置匹配消息，命中时推送，返回是否推送
+// 所有者已取消订阅、已被封禁或失去使用权限时不再转发
+func deliverToDestination(dest *Destination, sub Subscription, msg Message, matcher *MessageMatcher, data *rssCheckData) bool {
+	if !canReceivePushes(dest.OwnerID, data.roles[dest.OwnerID]) {
+		return false
+	}
+	subscribed := false
+	for _, userID := range sub.Users {
+		if userID == dest.OwnerID {
+			subscribed = true
+			break
+		}
+	}
+	if !subscribed {
+		return false
+	}
+
+	keywords, all := destinationKeywords(dest, data.userKeywords, data.keywordScopes, sub.Name)
+	hits := matcher.MatchHits(keywords, data.foldingUsers[dest.OwnerID])
+	matchedKeywords := matchedKeywordsFromHits(hits, msg.Title)
+	if all && len(matchedKeywords) == 0 && !hasBlockedHit(hits) {
+		matchedKeywords = []string{ReceiveAllLabel}
+	}
+	if len(matchedKeywords) == 0 {
+		return false
+	}
+	metricFeedMatches.Inc(sub.Name)
+
+	logMessage("debug", fmt.Sprintf("关键词[%s]匹配 推送到 %s: %s",
+		strings.Join(matchedKeywords, ", "), dest.label(), msg.Title), dest.OwnerID)
+	processedMsg := &ProcessedMessage{Original: &msg, HasAI: false}
+	htmlMessage, imageURL := buildPushMessage(dest.OwnerID, dest.applyFormat(sub), processedMsg, formatKeywordCodes(matchedKeywords))
+
+	// 发送失败时可能修改会话ID和话题ID，使用副本避免与其他订阅的协程冲突
+	target := *dest
+	var topic *DestinationTopic
+	if route := dest.topicFor(sub.Name, matchedKeywords); route != nil {
+		copied := *route
+		topic = &copied
+	}
+	go sendToDestination(&target, topic, sub.Name, imageURL, htmlMessage)
+	return true
+}
+
+// sendToDestination 向推送目标发送消息，设置了话题路由时发到对应话题，会话失效时停用目标
+func sendToDestination(dest *Destination, topic *DestinationTopic, rssName, imageURL, htmlMessage string) {
+	var err error
+	if topic != nil {
+		err = sendToDestinationTopic(dest, topic, imageURL, htmlMessage)
+	} else if imageURL != "" {
+		_, err = sendPhotoMessage(dest.ChatID, imageURL, htmlMessage)
+	} else {
+		_, err = sendHTMLMessage(dest.ChatID, htmlMessage)
+	}
+	if err == nil {
+		metricFeedPushes.Inc(rssName)
+		recordPush(rssName)
+		return
+	}
+
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return
+	}
+	switch {
+	case apiErr.MigrateToChatID != 0:
+		// 群组已升级为超级群组，更新会话ID后重发
+		if err := migrateDestinationChat(dest.ChatID, apiErr.MigrateToChatID); err != nil {
+			logMessage("error", fmt.Sprintf("更新推送目标会话ID失败: %v", err), dest.OwnerID)
+			return
+		}
+		dest.ChatID = apiErr.MigrateToChatID
+		sendToDestination(dest, nil, rssName, imageURL, htmlMessage)
+	case apiErr.Code == 403 || strings.Contains(apiErr.Message, "chat not found"):
+		dests, err := deactivateDestinations(dest.ChatID)
+		if err != nil {
+			logMessage("error", fmt.Sprintf("停用推送目标失败: %v", err), dest.OwnerID)
+			return
+		}
+		// 只通知本次停用的目标，同一轮中其他失败的发送不再重复通知
+		for _, inactive := range dests {
+			notifyDestinationInactive(inactive, apiErr.Message)
+		}
+	}
+}
+
+// destinationKeywords 返回推送目标用于匹配的关键词，以及是否为全部推送
+func destinationKeywords(dest *Destination, userKeywords map[int64][]string, keywordScopes map[int64]map[string][]string, rssName string) ([]string, bool) {
+	switch dest.KeywordMode {
+	case DestinationKeywordsCustom:
+		return dest.Keywords, false
+	case DestinationKeywordsAll:
+		return dest.Keywords, true
+	default:
+		return keywordsForSubscription(userKeywords[dest.OwnerID], keywordScopes[dest.OwnerID], rssName), false
+	}
+}
+
+// showDestinationMenu 显示推送目标列表
+func showDestinationMenu(userID int64, messageID int) {
+	dests, err := getDestinationsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取推送目标失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取推送目标失败，请稍后重试")
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, dest := range dests {
+		status := "✅"
+		if !dest.Active {
+			status = "⏸"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s %s", status, dest.label()), fmt.Sprintf("dest_view_%d", dest.ID)),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ 添加群组/频道", "dest_add"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+		),
+	)
+
+	text := fmt.Sprintf(`📢 群组/频道推送
+
+将订阅推送到你管理的群组、超级群组或频道，每个目标可单独设置格式和关键词。
+
+添加方式：
+• 把 @%s 设为群组或频道的管理员，会自动添加
+• 或点击 "➕ 添加群组/频道"，输入会话ID或 @用户名
+
+当前共 %d 个推送目标，⏸ 表示已停用`, bot.Self.UserName, len(dests))
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showDestinationAddPrompt 提示输入要添加的会话
+func showDestinationAddPrompt(userID int64, messageID int) {
+	setUserState(userID, "add_destination", messageID, nil)
+	text := fmt.Sprintf(`➕ 请输入群组或频道的会话ID、@用户名或 t.me 链接：
+
+📝 示例：@my_channel、-1001234567890
+
+添加前请确认：
+• 你是该会话的创建者或管理员
+• @%s 已是该会话的管理员（频道需允许发布消息）`, bot.Self.UserName)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "dest_menu"),
+		),
+	)
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleDestinationInput 处理添加推送目标的输入
+func handleDestinationInput(message *tgbotapi.Message) {
+	userID := message.Chat.ID
+	state := getUserState(userID)
+	messageID := 0
+	if state != nil {
+		messageID = state.MessageID
+	}
+
+	dest, err := addDestinationByReference(userID, message.Text)
+	if err != nil {
+		messageSender.SendError(userID, 0, "❌ "+err.Error())
+		return
+	}
+	clearUserState(userID)
+	logMessage("info", fmt.Sprintf("添加推送目标: %s", dest.label()), userID)
+	showDestinationDetail(userID, messageID, dest.ID)
+}
+
+// showDestinationDetail 显示推送目标详情和设置
+func showDestinationDetail(userID int64, messageID int, destID int64) {
+	dest, err := getDestinationForUser(userID, destID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 推送目标不存在")
+		return
+	}
+
+	status := "✅ 启用中"
+	if !dest.Active {
+		status = "⏸ 已停用（Bot 已被移出或不再是管理员）"
+	}
+	routes := "未选择，不会推送任何内容"
+	if len(dest.Routes) > 0 {
+		routes = strings.Join(dest.Routes, "、")
+	}
+	keywords := destinationKeywordModeNames[dest.KeywordMode]
+	if dest.KeywordMode != DestinationKeywordsOwner && len(dest.Keywords) > 0 {
+		keywords += "：" + strings.Join(dest.Keywords, " ")
+	}
+
+	text := fmt.Sprintf(`📢 %s
+
+状态：%s
+📰 转发订阅：%s
+📄 推送格式：%s
+🔑 关键词：%s`, dest.label(), status, routes, destinationFormatNames[dest.Format], keywords)
+	if dest.IsForum {
+		text += fmt.Sprintf("\n🧵 话题路由：%d 条", len(dest.Topics))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📰 选择订阅", fmt.Sprintf("dest_routes_%d", dest.ID)),
+	))
+	if dest.IsForum {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🧵 话题路由", fmt.Sprintf("dest_topics_%d", dest.ID)),
+		))
+	}
+
+	var formatRow []tgbotapi.InlineKeyboardButton
+	for _, format := range []string{DestinationFormatFollow, DestinationFormatFull, DestinationFormatLink} {
+		label := destinationFormatNames[format]
+		if format == dest.Format {
+			label = "✅ " + label
+		}
+		formatRow = append(formatRow, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("dest_fmt_%d_%s", dest.ID, format)))
+	}
+	rows = append(rows, formatRow)
+
+	var modeRow []tgbotapi.InlineKeyboardButton
+	for _, mode := range []string{DestinationKeywordsOwner, DestinationKeywordsCustom, DestinationKeywordsAll} {
+		label := destinationKeywordModeNames[mode]
+		if mode == dest.KeywordMode {
+			label = "✅ " + label
+		}
+		modeRow = append(modeRow, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("dest_kwm_%d_%s", dest.ID, mode)))
+	}
+	rows = append(rows, modeRow)
+
+	if dest.KeywordMode != DestinationKeywordsOwner {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📝 设置单独的关键词", fmt.Sprintf("dest_kw_%d", dest.ID)),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 重新验证", fmt.Sprintf("dest_verify_%d", dest.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("🗑️ 删除", fmt.Sprintf("dest_del_%d", dest.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回推送目标", "dest_menu"),
+		),
+	)
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showDestinationRoutes 显示可转发到推送目标的订阅
+func showDestinationRoutes(userID int64, messageID int, dest *Destination) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取订阅失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取订阅失败，请稍后重试")
+		return
+	}
+	if len(subscriptions) == 0 {
+		messageSender.SendError(userID, messageID, "你还没有添加任何订阅")
+		return
+	}
+
+	routed := make(map[string]bool, len(dest.Routes))
+	for _, route := range dest.Routes {
+		routed[route] = true
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, sub := range subscriptions {
+		label := "⬜ " + sub.Name
+		if routed[sub.Name] {
+			label = "✅ " + sub.Name
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("dest_route_%d_%d", dest.ID, sub.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("dest_view_%d", dest.ID)),
+	))
+
+	text := fmt.Sprintf("📰 选择要推送到 %s 的订阅：", dest.label())
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showDestinationKeywordPrompt 提示输入推送目标的关键词
+func showDestinationKeywordPrompt(userID int64, messageID int, dest *Destination) {
+	setUserState(userID, "set_destination_keywords", messageID, map[string]interface{}{"destination_id": dest.ID})
+	text := fmt.Sprintf(`📝 请输入 %s 的关键词，多个关键词用空格或逗号分隔，输入的内容会替换现有关键词：
+
+支持与个人关键词相同的写法（屏蔽词、正则、表达式、修饰符等）
+"全部推送" 方式下只有屏蔽词生效`, dest.label())
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("dest_view_%d", dest.ID)),
+		),
+	)
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleDestinationKeywordInput 处理推送目标关键词输入
+func handleDestinationKeywordInput(message *tgbotapi.Message, state *UserState) {
+	userID := message.Chat.ID
+	destID, _ := state.Data["destination_id"].(int64)
+	dest, err := getDestinationForUser(userID, destID)
+	if err != nil {
+		clearUserState(userID)
+		messageSender.SendError(userID, 0, "❌ 推送目标不存在")
+		return
+	}
+
+	keywords := splitKeywordInput(message.Text)
+	if len(keywords) == 0 {
+		messageSender.SendError(userID, 0, "❌ 请输入有效的关键词")
+		return
+	}
+	if problems := validateKeywordSyntax(keywords); len(problems) > 0 {
+		messageSender.SendError(userID, 0, fmt.Sprintf("❌ 以下关键词有误：\n\n%s", strings.Join(problems, "\n")))
+		return
+	}
+
+	dest.Keywords = keywords
+	if err := updateDestination(dest); err != nil {
+		logMessage("error", fmt.Sprintf("保存推送目标关键词失败: %v", err), userID)
+		messageSender.SendError(userID, 0, "保存失败，请稍后重试")
+		return
+	}
+	clearUserState(userID)
+	logMessage("info", fmt.Sprintf("设置推送目标 %s 的关键词: %s", dest.label(), strings.Join(keywords, ", ")), userID)
+	showDestinationDetail(userID, state.MessageID, dest.ID)
+}
+
+// handleDestinationCallback 处理推送目标相关按钮，value 为去掉 "dest_" 前缀后的内容
+func handleDestinationCallback(userID int64, messageID int, value string) {
+	if isGroupID(userID) {
+		messageSender.SendError(userID, messageID, "❌ 群组中不支持转发到其他群组或频道")
+		return
+	}
+
+	switch value {
+	case "menu":
+		showDestinationMenu(userID, messageID)
+		return
+	case "add":
+		showDestinationAddPrompt(userID, messageID)
+		return
+	}
+
+	parts := strings.SplitN(value, "_", 3)
+	if len(parts) < 2 {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	destID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	dest, err := getDestinationForUser(userID, destID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 推送目标不存在")
+		return
+	}
+	arg := ""
+	if len(parts) == 3 {
+		arg = parts[2]
+	}
+
+	switch parts[0] {
+	case "view":
+		showDestinationDetail(userID, messageID, dest.ID)
+	case "routes":
+		showDestinationRoutes(userID, messageID, dest)
+	case "route":
+		subID, err := strconv.Atoi(arg)
+		if err != nil {
+			messageSender.SendError(userID, messageID, "❌ 参数错误")
+			return
+		}
+		sub, err := getSubscriptionInfoByID(userID, subID)
+		if err != nil {
+			messageSender.SendError(userID, messageID, "❌ 订阅不存在")
+			return
+		}
+		routed, err := toggleDestinationRoute(dest, sub.Name)
+		if err != nil {
+			logMessage("error", fmt.Sprintf("设置推送目标订阅失败: %v", err), userID)
+			messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+			return
+		}
+		logMessage("info", fmt.Sprintf("推送目标 %s 转发订阅 %s: %v", dest.label(), sub.Name, routed), userID)
+		if dest, err = getDestinationForUser(userID, dest.ID); err == nil {
+			showDestinationRoutes(userID, messageID, dest)
+		}
+	case "fmt":
+		if _, ok := destinationFormatNames[arg]; !ok {
+			messageSender.SendError(userID, messageID, "❌ 无效的推送格式")
+			return
+		}
+		dest.Format = arg
+		saveDestinationSettings(userID, messageID, dest)
+	case "kwm":
+		if _, ok := destinationKeywordModeNames[arg]; !ok {
+			messageSender.SendError(userID, messageID, "❌ 无效的关键词方式")
+			return
+		}
+		dest.KeywordMode = arg
+		if arg == DestinationKeywordsCustom && len(dest.Keywords) == 0 {
+			if err := updateDestination(dest); err == nil {
+				showDestinationKeywordPrompt(userID, messageID, dest)
+				return
+			}
+		}
+		saveDestinationSettings(userID, messageID, dest)
+	case "kw":
+		showDestinationKeywordPrompt(userID, messageID, dest)
+	case "topics":
+		showDestinationTopics(userID, messageID, dest)
+	case "tpset":
+		showDestinationTopicPrompt(userID, messageID, dest, arg)
+	case "tpdel":
+		if err := deleteDestinationKeywordTopic(dest, arg); err != nil {
+			logMessage("error", fmt.Sprintf("删除话题路由失败: %v", err), userID)
+			messageSender.SendError(userID, messageID, "删除失败，请稍后重试")
+			return
+		}
+		if dest, err = getDestinationForUser(userID, dest.ID); err == nil {
+			showDestinationTopics(userID, messageID, dest)
+		}
+	case "verify":
+		chat, err := bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: dest.ChatID}})
+		if err == nil {
+			err = verifyDestination(userID, chat)
+		}
+		if err != nil {
+			messageSender.SendError(userID, messageID, "❌ 验证失败："+err.Error())
+			return
+		}
+		if _, err := saveDestination(userID, chat); err != nil {
+			logMessage("error", fmt.Sprintf("保存推送目标失败: %v", err), userID)
+		}
+		showDestinationDetail(userID, messageID, dest.ID)
+	case "del":
+		if err := deleteDestination(dest); err != nil {
+			logMessage("error", fmt.Sprintf("删除推送目标失败: %v", err), userID)
+			messageSender.SendError(userID, messageID, "删除失败，请稍后重试")
+			return
+		}
+		logMessage("info", fmt.Sprintf("删除推送目标: %s", dest.label()), userID)
+		showDestinationMenu(userID, messageID)
+	default:
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+	}
+}
+
+// saveDestinationSettings 保存推送目标设置并刷新详情
+func saveDestinationSettings(userID int64, messageID int, dest *Destination) {
+	if err := updateDestination(dest); err != nil {
+		logMessage("error", fmt.Sprintf("保存推送目标设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	showDestinationDetail(userID, messageID, dest.ID)
+}
@@ -0,0 +1,733 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 推送方式
+const (
+	DeliveryInstant = "instant" // 即时推送
+	DeliveryHourly  = "hourly"  // 每小时摘要
+	DeliveryDaily   = "daily"   // 每日摘要
+	DeliveryWeekly  = "weekly"  // 每周摘要
+
+	DefaultDigestTime = "08:00" // 默认摘要发送时间
+)
+
+// 推送方式列表，按菜单显示顺序排列
+var deliveryModes = []string{DeliveryInstant, DeliveryHourly, DeliveryDaily, DeliveryWeekly}
+
+// 推送方式显示名称
+var deliveryModeNames = map[string]string{
+	DeliveryInstant: "即时推送",
+	DeliveryHourly:  "每小时摘要",
+	DeliveryDaily:   "每日摘要",
+	DeliveryWeekly:  "每周摘要",
+}
+
+// 星期显示名称，下标与 time.Weekday 对应
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// DigestItem 等待汇总推送的条目
+type DigestItem struct {
+	ID        int64
+	UserID    int64
+	Mode      string
+	RSSName   string
+	Keywords  []string
+	Title     string
+	Link      string
+	PubDate   time.Time
+	CreatedAt time.Time
+}
+
+// digestGroup 摘要中按订阅和关键词分组的条目
+type digestGroup struct {
+	RSSName  string
+	Keywords []string
+	Items    []DigestItem
+}
+
+// isValidDeliveryMode 检查推送方式是否有效
+func isValidDeliveryMode(mode string) bool {
+	_, ok := deliveryModeNames[mode]
+	return ok
+}
+
+// describeDeliveryMode 描述推送方式，mode为空时使用用户默认推送方式
+func describeDeliveryMode(settings *UserSettings, mode string) string {
+	if mode == "" {
+		mode = settings.DeliveryMode
+	}
+	switch mode {
+	case DeliveryDaily:
+		return fmt.Sprintf("%s（%s）", deliveryModeNames[mode], settings.DigestTime)
+	case DeliveryWeekly:
+		return fmt.Sprintf("%s（%s %s）", deliveryModeNames[mode], weekdayNames[settings.DigestWeekday], settings.DigestTime)
+	default:
+		return deliveryModeNames[mode]
+	}
+}
+
+// getSubscriptionDeliveryMode 获取订阅单独设置的推送方式，未设置时返回空字符串
+func getSubscriptionDeliveryMode(userID int64, rssName string) (string, error) {
+	var mode string
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow(`
+			SELECT delivery_mode FROM user_subscription_settings
+			WHERE user_id = ? AND rss_name = ?`, userID, rssName).Scan(&mode)
+	})
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return mode, err
+}
+
+// setSubscriptionDeliveryMode 设置订阅单独的推送方式，mode为空表示跟随默认
+func setSubscriptionDeliveryMode(userID int64, rssName, mode string) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO user_subscription_settings (user_id, rss_name, delivery_mode)
+			VALUES (?, ?, ?)
+			ON CONFLICT(user_id, rss_name) DO UPDATE SET delivery_mode = excluded.delivery_mode`,
+			userID, rssName, mode)
+		return err
+	})
+}
+
+// getEffectiveDeliveryMode 获取订阅实际生效的推送方式
+func getEffectiveDeliveryMode(userID int64, rssName string) string {
+	mode, err := getSubscriptionDeliveryMode(userID, rssName)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取订阅推送方式失败: %v", err), userID)
+	}
+	if isValidDeliveryMode(mode) {
+		return mode
+	}
+
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		return DeliveryInstant
+	}
+	return settings.DeliveryMode
+}
+
+// queueDigestItem 将匹配的条目加入摘要队列
+func queueDigestItem(userID int64, mode, rssName string, msg *Message, matchedKeywords []string) error {
+	keywordsJSON, err := json.Marshal(matchedKeywords)
+	if err != nil {
+		return err
+	}
+
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO digest_items (user_id, mode, rss_name, keywords, title, link, pub_date, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, mode, rssName, string(keywordsJSON), msg.Title, msg.Link, msg.PubDate, time.Now())
+		return err
+	})
+}
+
+// getDigestItems 获取用户指定推送方式下待汇总的条目
+func getDigestItems(userID int64, mode string) ([]DigestItem, error) {
+	var items []DigestItem
+
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT id, user_id, mode, rss_name, keywords, title, link, pub_date, created_at
+			FROM digest_items WHERE user_id = ? AND mode = ? ORDER BY id`, userID, mode)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var item DigestItem
+			var keywordsStr string
+			if err := rows.Scan(&item.ID, &item.UserID, &item.Mode, &item.RSSName, &keywordsStr,
+				&item.Title, &item.Link, &item.PubDate, &item.CreatedAt); err != nil {
+				continue
+			}
+			item.Keywords = parseKeywords(keywordsStr)
+			items = append(items, item)
+		}
+		return nil
+	})
+
+	return items, err
+}
+
+// deleteDigestItems 删除已发送的摘要条目
+func deleteDigestItems(userID int64, ids []int64) error {
+	return withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, id := range ids {
+			if _, err := tx.Exec("DELETE FROM digest_items WHERE user_id = ? AND id = ?", userID, id); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// pendingDigest 待发送的摘要
+type pendingDigest struct {
+	UserID   int64
+	Mode     string
+	Earliest time.Time
+}
+
+// getPendingDigests 获取所有待发送摘要及其最早条目时间
+func getPendingDigests() ([]pendingDigest, error) {
+	var pending []pendingDigest
+
+	err := withDB(func(db *sql.DB) error {
+		// 以最早条目的入队时间作为计算发送时间的基准
+		rows, err := db.Query(`
+			SELECT d.user_id, d.mode, d.created_at FROM digest_items d
+			JOIN (SELECT MIN(id) AS id FROM digest_items GROUP BY user_id, mode) f ON d.id = f.id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var p pendingDigest
+			if err := rows.Scan(&p.UserID, &p.Mode, &p.Earliest); err != nil {
+				continue
+			}
+			pending = append(pending, p)
+		}
+		return nil
+	})
+
+	return pending, err
+}
+
+// nextDigestTime 计算 after 之后的下一个摘要发送时间
+func nextDigestTime(settings *UserSettings, mode string, after time.Time) time.Time {
+	loc := loadLocation(settings.Timezone)
+	local := after.In(loc)
+
+	switch mode {
+	case DeliveryHourly:
+		return local.Truncate(time.Hour).Add(time.Hour)
+
+	case DeliveryDaily, DeliveryWeekly:
+		minutes, err := parseClock(settings.DigestTime)
+		if err != nil {
+			minutes, _ = parseClock(DefaultDigestTime)
+		}
+		next := time.Date(local.Year(), local.Month(), local.Day(), minutes/60, minutes%60, 0, 0, loc)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 1)
+		}
+		if mode == DeliveryWeekly {
+			for int(next.Weekday()) != settings.DigestWeekday {
+				next = next.AddDate(0, 0, 1)
+			}
+		}
+		return next
+
+	default:
+		return after
+	}
+}
+
+// groupDigestItems 按订阅和关键词对条目分组
+func groupDigestItems(items []DigestItem) []digestGroup {
+	groupIndex := make(map[string]int)
+	var groups []digestGroup
+
+	for _, item := range items {
+		// 关键词可能包含空格（表达式、NEAR、引号短语），以 \x00 拼接作为分组键
+		key := item.RSSName + "\x00" + strings.Join(item.Keywords, "\x00")
+		idx, ok := groupIndex[key]
+		if !ok {
+			idx = len(groups)
+			groupIndex[key] = idx
+			groups = append(groups, digestGroup{RSSName: item.RSSName, Keywords: item.Keywords})
+		}
+		groups[idx].Items = append(groups[idx].Items, item)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].RSSName != groups[j].RSSName {
+			return groups[i].RSSName < groups[j].RSSName
+		}
+		return slices.Compare(groups[i].Keywords, groups[j].Keywords) < 0
+	})
+	return groups
+}
+
+// formatDigestGroupHeader 格式化分组标题
+func formatDigestGroupHeader(group digestGroup, continued bool) string {
+	header := fmt.Sprintf("📰 <b>%s</b>", html.EscapeString(group.RSSName))
+	if continued {
+		header += "（续）"
+	}
+	if len(group.Keywords) > 0 {
+		var codes []string
+		for _, kw := range group.Keywords {
+			codes = append(codes, fmt.Sprintf("<code>%s</code>", html.EscapeString(kw)))
+		}
+		header += "\n🔖 " + strings.Join(codes, " ")
+	}
+	return header
+}
+
+// buildDigestMessages 构造摘要消息，超长时在分组或条目之间安全切分
+// 同时返回每条消息包含的条目，发送失败时只清理已发送的部分
+func buildDigestMessages(userID int64, settings *UserSettings, mode string, items []DigestItem, overview string) ([]string, [][]DigestItem) {
+	header := fmt.Sprintf("📬 <b>%s</b>（共 %d 条）\n🕒 %s - %s",
+		deliveryModeNames[mode], len(items),
+		formatTimeForUser(userID, items[0].CreatedAt), formatTimeForUser(userID, time.Now()))
+	if overview != "" {
+		header += "\n\n🤖 <b>AI概览</b>：\n" + html.EscapeString(overview)
+	}
+
+	// 预留分组标题的空间，单个分组过长时拆分为多个块
+	maxBlock := MaxMessageLength - len(header) - 64
+	var blocks []string
+	var blockItems [][]DigestItem
+	for _, group := range groupDigestItems(items) {
+		block := formatDigestGroupHeader(group, false)
+		var current []DigestItem
+		for _, item := range group.Items {
+			title := item.Title
+			if title == "" {
+				title = item.Link
+			}
+			line := fmt.Sprintf("• <a href=\"%s\">%s</a>", html.EscapeString(item.Link), html.EscapeString(title))
+			if len(block)+len(line)+1 > maxBlock {
+				blocks = append(blocks, block)
+				blockItems = append(blockItems, current)
+				block = formatDigestGroupHeader(group, true)
+				current = nil
+			}
+			block += "\n" + line
+			current = append(current, item)
+		}
+		blocks = append(blocks, block)
+		blockItems = append(blockItems, current)
+	}
+
+	chunks, counts := splitHTMLEntriesCounted(header, blocks, MaxMessageLength)
+	chunkItems := make([][]DigestItem, len(chunks))
+	next := 0
+	for i, count := range counts {
+		for _, itemsInBlock := range blockItems[next : next+count] {
+			chunkItems[i] = append(chunkItems[i], itemsInBlock...)
+		}
+		next += count
+	}
+	return chunks, chunkItems
+}
+
+// generateDigestOverview 使用AI为摘要生成概览段落
+func generateDigestOverview(userID int64, items []DigestItem) string {
+	aiService := initializeAIService()
+	if aiService == nil {
+		return ""
+	}
+
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, fmt.Sprintf("[%s] %s", item.RSSName, item.Title))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	handler := NewAIHandler(aiService, db)
+	result, err := handler.SummarizeForUser(ctx, userID, strings.Join(titles, "\n"), 200, 0)
+	if err == ErrAIQuotaExceeded {
+		return ""
+	}
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("生成摘要概览失败: %v", err))
+		return ""
+	}
+	return result.SummaryText
+}
+
+// sendDigest 汇总并发送用户的摘要
+func sendDigest(userID int64, mode string, settings *UserSettings) {
+	items, err := getDigestItems(userID, mode)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取摘要条目失败: %v", err), userID)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	var overview string
+	if settings.DigestAIOverview && globalConfig.AI != nil && globalConfig.AI.Enabled {
+		overview = generateDigestOverview(userID, items)
+	}
+
+	// 只清理已发送消息中的条目，发送失败的部分留待下次检查时重新发送
+	chunks, chunkItems := buildDigestMessages(userID, settings, mode, items, overview)
+	var sentIDs []int64
+	for i, chunk := range chunks {
+		if _, err := sendHTMLMessage(userID, chunk); err != nil {
+			logMessage("error", fmt.Sprintf("发送%s失败，未发送的条目保留待重试: %v", deliveryModeNames[mode], err), userID)
+			break
+		}
+		for _, item := range chunkItems[i] {
+			metricFeedPushes.Inc(item.RSSName)
+			recordPush(item.RSSName)
+			sentIDs = append(sentIDs, item.ID)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(sentIDs) == 0 {
+		return
+	}
+
+	if err := deleteDigestItems(userID, sentIDs); err != nil {
+		logMessage("error", fmt.Sprintf("清理摘要条目失败: %v", err), userID)
+	}
+	logMessage("info", fmt.Sprintf("已发送%s，共 %d/%d 条", deliveryModeNames[mode], len(sentIDs), len(items)), userID)
+}
+
+// checkDigests 检查并发送到期的摘要
+func checkDigests() {
+	pending, err := getPendingDigests()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取待发送摘要失败: %v", err))
+		return
+	}
+
+	now := time.Now()
+	for _, p := range pending {
+		settings, err := GetUserSettings(p.UserID)
+		if err != nil {
+			logMessage("warn", fmt.Sprintf("获取用户设置失败: %v", err), p.UserID)
+			continue
+		}
+		if now.Before(nextDigestTime(settings, p.Mode, p.Earliest)) {
+			continue
+		}
+		// 免打扰或暂停期间推迟发送，结束后的下一次检查再发送
+		if shouldDeferPush(p.UserID, false) {
+			continue
+		}
+		sendDigest(p.UserID, p.Mode, settings)
+	}
+}
+
+// startDigestScheduler 启动摘要定时发送协程
+func startDigestScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logMessage("error", fmt.Sprintf("发送摘要时发生panic: %v", r))
+				}
+			}()
+			checkDigests()
+		}()
+	}
+}
+
+// showDeliveryMenu 显示推送方式设置菜单
+func showDeliveryMenu(userID int64, messageID int) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取设置失败，请稍后重试")
+		return
+	}
+
+	var modeRow []tgbotapi.InlineKeyboardButton
+	for _, mode := range deliveryModes {
+		label := deliveryModeNames[mode]
+		if mode == settings.DeliveryMode {
+			label = "✅ " + label
+		}
+		modeRow = append(modeRow, tgbotapi.NewInlineKeyboardButtonData(label, "set_delivery_"+mode))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		modeRow[:2],
+		modeRow[2:],
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏰ 摘要时间", "set_digest_time"),
+			tgbotapi.NewInlineKeyboardButtonData("📰 按订阅设置", "sub_delivery_list"),
+		),
+	}
+
+	if settings.DeliveryMode == DeliveryWeekly {
+		var weekdayRow []tgbotapi.InlineKeyboardButton
+		for i, name := range weekdayNames {
+			label := name
+			if i == settings.DigestWeekday {
+				label = "✅" + name
+			}
+			weekdayRow = append(weekdayRow, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("set_digest_wd_%d", i)))
+		}
+		rows = append(rows, weekdayRow[:4], weekdayRow[4:])
+	}
+
+	aiOverview := "未启用"
+	if globalConfig.AI != nil && globalConfig.AI.Enabled {
+		label := "🤖 AI概览：关"
+		if settings.DigestAIOverview {
+			label = "🤖 AI概览：开"
+			aiOverview = "已启用"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "toggle_digest_ai"),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+	))
+
+	text := fmt.Sprintf(`📬 推送方式
+
+当前默认：%s
+🤖 摘要AI概览：%s
+
+• 即时推送：命中关键词后立即推送
+• 每小时/每日/每周摘要：累积命中的内容，按订阅和关键词分组后一次发送
+• 紧急关键词（! 开头）始终即时推送
+• 可在 "按订阅设置" 中为单个订阅指定不同的推送方式，或开启全部推送（无需命中关键词，屏蔽词仍生效）`,
+		describeDeliveryMode(settings, ""), aiOverview)
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// setUserDeliveryMode 设置用户默认推送方式
+func setUserDeliveryMode(userID int64, mode string) error {
+	if !isValidDeliveryMode(mode) {
+		return fmt.Errorf("无效的推送方式: %s", mode)
+	}
+
+	return UpdateUserSettingFields(userID, map[string]interface{}{"delivery_mode": mode})
+}
+
+// handleDeliveryModeCallback 处理推送方式按钮
+func handleDeliveryModeCallback(userID int64, messageID int, mode string) {
+	if err := setUserDeliveryMode(userID, mode); err != nil {
+		logMessage("error", fmt.Sprintf("设置推送方式失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置推送方式失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("用户推送方式已设置为 %s", mode), userID)
+	showDeliveryMenu(userID, messageID)
+}
+
+// setDigestWeekday 设置每周摘要的发送日
+func setDigestWeekday(userID int64, messageID int, weekday int) {
+	if weekday < 0 || weekday > 6 {
+		messageSender.SendError(userID, messageID, "❌ 无效的星期")
+		return
+	}
+
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"digest_weekday": weekday}); err != nil {
+		logMessage("error", fmt.Sprintf("设置摘要发送日失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	showDeliveryMenu(userID, messageID)
+}
+
+// toggleDigestAIOverview 切换摘要AI概览开关
+func toggleDigestAIOverview(userID int64, messageID int) {
+	settings, err := GetUserSettings(userID)
+	if err == nil {
+		err = UpdateUserSettingFields(userID, map[string]interface{}{"digest_ai_overview": !settings.DigestAIOverview})
+	}
+	if err != nil {
+		logMessage("error", fmt.Sprintf("设置摘要AI概览失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	showDeliveryMenu(userID, messageID)
+}
+
+// showDigestTimePrompt 显示摘要时间设置提示
+func showDigestTimePrompt(userID int64, messageID int) {
+	setUserState(userID, "set_digest_time", messageID, nil)
+
+	text := "⏰ 请输入每日/每周摘要的发送时间（按你的时区），格式为 HH:MM\n\n📝 示例：08:00"
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回推送方式", "delivery_menu"),
+		),
+	)
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleDigestTimeInput 处理用户输入的摘要时间
+func handleDigestTimeInput(message *tgbotapi.Message) {
+	userID := message.Chat.ID
+
+	minutes, err := parseClock(message.Text)
+	if err != nil {
+		messageSender.SendError(userID, 0, "❌ "+err.Error()+"，例如：08:00")
+		return
+	}
+
+	digestTime := fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"digest_time": digestTime}); err != nil {
+		logMessage("error", fmt.Sprintf("设置摘要时间失败: %v", err), userID)
+		messageSender.SendError(userID, 0, "设置摘要时间失败，请稍后重试")
+		return
+	}
+
+	clearUserState(userID)
+	showDeliveryMenu(userID, 0)
+}
+
+// showSubscriptionDeliveryList 显示订阅列表，用于单独设置推送方式
+func showSubscriptionDeliveryList(userID int64, messageID int) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户订阅失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取订阅失败，请稍后重试")
+		return
+	}
+	if len(subscriptions) == 0 {
+		messageSender.SendError(userID, messageID, "你还没有添加任何订阅")
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, sub := range subscriptions {
+		mode, _ := getSubscriptionDeliveryMode(userID, sub.Name)
+		label := "跟随默认"
+		if isValidDeliveryMode(mode) {
+			label = deliveryModeNames[mode]
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📰 %s · %s", sub.Name, label),
+				fmt.Sprintf("sub_delivery_%d", sub.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回推送方式", "delivery_menu"),
+	))
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, "📰 请选择要单独设置推送方式的订阅：", &keyboard)
+}
+
+// showSubscriptionDeliveryOptions 显示单个订阅的推送方式选项
+func showSubscriptionDeliveryOptions(userID int64, messageID int, subID int) {
+	sub, err := getSubscriptionInfoByID(userID, subID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 订阅不存在")
+		return
+	}
+
+	current, _ := getSubscriptionDeliveryMode(userID, sub.Name)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	defaultLabel := "跟随默认"
+	if !isValidDeliveryMode(current) {
+		defaultLabel = "✅ " + defaultLabel
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(defaultLabel, fmt.Sprintf("set_sub_delivery_%d_default", subID)),
+	))
+	for _, mode := range deliveryModes {
+		label := deliveryModeNames[mode]
+		if mode == current {
+			label = "✅ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("set_sub_delivery_%d_%s", subID, mode)),
+		))
+	}
+	receiveAll, _ := isReceiveAll(userID, sub.Name)
+	receiveAllLabel, receiveAllValue := "⬜ 推送全部内容（无需命中关键词）", 1
+	if receiveAll {
+		receiveAllLabel, receiveAllValue = "✅ 推送全部内容（无需命中关键词）", 0
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(receiveAllLabel, fmt.Sprintf("sub_recv_%d_%d", subID, receiveAllValue)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回订阅列表", "sub_delivery_list"),
+		),
+	)
+
+	text := fmt.Sprintf("📰 %s 的推送方式：\n📥 推送范围：%s", sub.Name, describeReceiveAll(receiveAll))
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleSubscriptionDeliveryCallback 处理订阅推送方式按钮，value 格式为 "<订阅ID>_<方式>"
+func handleSubscriptionDeliveryCallback(userID int64, messageID int, value string) {
+	parts := strings.SplitN(value, "_", 2)
+	if len(parts) != 2 {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	subID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+
+	mode := parts[1]
+	if mode == "default" {
+		mode = ""
+	} else if !isValidDeliveryMode(mode) {
+		messageSender.SendError(userID, messageID, "❌ 无效的推送方式")
+		return
+	}
+
+	sub, err := getSubscriptionInfoByID(userID, subID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 订阅不存在")
+		return
+	}
+
+	if err := setSubscriptionDeliveryMode(userID, sub.Name, mode); err != nil {
+		logMessage("error", fmt.Sprintf("设置订阅推送方式失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	showSubscriptionDeliveryOptions(userID, messageID, subID)
+}
+
+// getSubscriptionInfoByID 根据ID获取用户已订阅的订阅信息
+func getSubscriptionInfoByID(userID int64, subID int) (*SubscriptionInfo, error) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subscriptions {
+		if sub.ID == subID {
+			return &sub, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupDigestItemsKeepsKeywordsIntact(t *testing.T) {
+	items := []DigestItem{
+		{RSSName: "HN", Keywords: []string{"title:(rust OR go)"}, Title: "a"},
+		{RSSName: "HN", Keywords: []string{"rust NEAR/3 async"}, Title: "b"},
+		{RSSName: "HN", Keywords: []string{"title:(rust OR go)"}, Title: "c"},
+		// 与 "rust NEAR/3 async" 按空格拼接后相同，但属于不同分组
+		{RSSName: "HN", Keywords: []string{"rust", "NEAR/3", "async"}, Title: "d"},
+	}
+
+	groups := groupDigestItems(items)
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3", len(groups))
+	}
+	for _, group := range groups {
+		if strings.Join(group.Keywords, "|") == "title:(rust OR go)" && len(group.Items) != 2 {
+			t.Errorf("group %q has %d items, want 2", group.Keywords, len(group.Items))
+		}
+	}
+}
+
+func TestFormatDigestGroupHeader(t *testing.T) {
+	tests := []struct {
+		keywords []string
+		want     string
+	}{
+		{nil, "📰 <b>HN</b>"},
+		{[]string{"title:(rust OR go)"}, "📰 <b>HN</b>\n🔖 <code>title:(rust OR go)</code>"},
+		{[]string{`"machine learning"`, "rust NEAR/3 async"}, "📰 <b>HN</b>\n🔖 <code>&#34;machine learning&#34;</code> <code>rust NEAR/3 async</code>"},
+	}
+	for _, tt := range tests {
+		got := formatDigestGroupHeader(digestGroup{RSSName: "HN", Keywords: tt.keywords}, false)
+		if got != tt.want {
+			t.Errorf("formatDigestGroupHeader(%q) = %q, want %q", tt.keywords, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDigestMessagesMapsItemsToChunks(t *testing.T) {
+	setupTestDB(t)
+	var items []DigestItem
+	for i := 0; i < 120; i++ {
+		items = append(items, DigestItem{
+			ID:        int64(i + 1),
+			RSSName:   fmt.Sprintf("feed%d", i%3),
+			Title:     strings.Repeat("标题", 20) + fmt.Sprint(i),
+			Link:      fmt.Sprintf("https://example.com/%d", i),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	chunks, chunkItems := buildDigestMessages(1, defaultUserSettings(1), DeliveryDaily, items, "")
+	if len(chunks) < 2 || len(chunks) != len(chunkItems) {
+		t.Fatalf("got %d chunks and %d item lists, want several of each", len(chunks), len(chunkItems))
+	}
+	seen := make(map[int64]bool)
+	for i, chunk := range chunks {
+		for _, item := range chunkItems[i] {
+			if seen[item.ID] {
+				t.Errorf("item %d appears in more than one chunk", item.ID)
+			}
+			seen[item.ID] = true
+			if !strings.Contains(chunk, item.Link+"\"") {
+				t.Errorf("chunk %d does not contain item %d", i, item.ID)
+			}
+		}
+	}
+	if len(seen) != len(items) {
+		t.Errorf("chunks cover %d items, want %d", len(seen), len(items))
+	}
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 话题路由：开启话题（Topics）的超级群组可以按订阅或关键词把推送发到不同话题
+// 选择顺序：命中的关键词 > 订阅 > 默认话题，都没有设置时发到 General
+// 按名称设置的话题不存在时通过 createForumTopic 自动创建（Bot 需要“管理话题”权限），
+// 话题被删除后发送失败会重新创建一次
+
+// 话题路由类型
+const (
+	TopicRouteDefault      = "default" // 默认话题
+	TopicRouteSubscription = "sub"     // 按订阅
+	TopicRouteKeyword      = "kw"      // 按关键词
+)
+
+// DestinationTopic 推送目标的一条话题路由
+type DestinationTopic struct {
+	DestinationID int64
+	Kind          string
+	Key           string // 订阅名称或关键词，默认话题为空
+	Name          string // 话题名称，直接指定话题ID时为空
+	ThreadID      int    // 话题ID，0表示尚未创建
+}
+
+// label 话题的显示名称
+func (t *DestinationTopic) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return fmt.Sprintf("#%d", t.ThreadID)
+}
+
+// 创建话题时加锁，避免多个协程为同一名称重复创建
+var forumTopicMutex sync.Mutex
+
+// topicFor 选择消息要发送到的话题，没有匹配的路由时返回 nil
+func (d *Destination) topicFor(rssName string, matchedKeywords []string) *DestinationTopic {
+	if !d.IsForum || len(d.Topics) == 0 {
+		return nil
+	}
+	for _, keyword := range matchedKeywords {
+		for _, topic := range d.Topics {
+			if topic.Kind == TopicRouteKeyword && strings.EqualFold(topic.Key, keyword) {
+				return topic
+			}
+		}
+	}
+	var fallback *DestinationTopic
+	for _, topic := range d.Topics {
+		switch {
+		case topic.Kind == TopicRouteSubscription && topic.Key == rssName:
+			return topic
+		case topic.Kind == TopicRouteDefault:
+			fallback = topic
+		}
+	}
+	return fallback
+}
+
+// findTopic 查找指定的话题路由
+func (d *Destination) findTopic(kind, key string) *DestinationTopic {
+	for _, topic := range d.Topics {
+		if topic.Kind == kind && topic.Key == key {
+			return topic
+		}
+	}
+	return nil
+}
+
+// loadDestinationTopics 读取推送目标的话题路由
+func loadDestinationTopics(db *sql.DB, dests []*Destination) error {
+	if len(dests) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*Destination, len(dests))
+	for _, dest := range dests {
+		byID[dest.ID] = dest
+	}
+
+	rows, err := db.Query(`
+		SELECT destination_id, kind, route_key, topic_name, thread_id
+		FROM destination_topics ORDER BY kind, route_key`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var topic DestinationTopic
+		if err := rows.Scan(&topic.DestinationID, &topic.Kind, &topic.Key, &topic.Name, &topic.ThreadID); err != nil {
+			return err
+		}
+		if dest, ok := byID[topic.DestinationID]; ok {
+			dest.Topics = append(dest.Topics, &topic)
+		}
+	}
+	return rows.Err()
+}
+
+// saveDestinationTopic 保存话题路由
+func saveDestinationTopic(topic *DestinationTopic) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO destination_topics (destination_id, kind, route_key, topic_name, thread_id)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(destination_id, kind, route_key) DO UPDATE SET
+				topic_name = excluded.topic_name, thread_id = excluded.thread_id`,
+			topic.DestinationID, topic.Kind, topic.Key, topic.Name, topic.ThreadID)
+		return err
+	})
+}
+
+// deleteDestinationTopic 删除话题路由
+func deleteDestinationTopic(destID int64, kind, key string) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec("DELETE FROM destination_topics WHERE destination_id = ? AND kind = ? AND route_key = ?", destID, kind, key)
+		return err
+	})
+}
+
+// setTopicThreadID 更新推送目标中同名话题的ID
+func setTopicThreadID(destID int64, name string, threadID int) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE destination_topics SET thread_id = ? WHERE destination_id = ? AND topic_name = ?", threadID, destID, name)
+		return err
+	})
+}
+
+// isForumChat 检查超级群组是否开启了话题，当前 API 库的 Chat 没有 is_forum 字段，直接读取原始响应
+func isForumChat(chatID int64) bool {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	resp, err := bot.MakeRequest("getChat", params)
+	if err != nil {
+		logMessage("debug", fmt.Sprintf("获取会话 %d 信息失败: %v", chatID, err))
+		return false
+	}
+	var chat struct {
+		IsForum bool `json:"is_forum"`
+	}
+	json.Unmarshal(resp.Result, &chat)
+	return chat.IsForum
+}
+
+// createForumTopic 在超级群组中创建话题，返回话题ID
+func createForumTopic(chatID int64, name string) (int, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params["name"] = name
+	resp, err := bot.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return 0, err
+	}
+	var topic struct {
+		MessageThreadID int `json:"message_thread_id"`
+	}
+	if err := json.Unmarshal(resp.Result, &topic); err != nil {
+		return 0, err
+	}
+	if topic.MessageThreadID == 0 {
+		return 0, fmt.Errorf("创建话题未返回话题ID")
+	}
+	return topic.MessageThreadID, nil
+}
+
+// ensureForumTopic 返回话题ID，按名称设置且尚未创建的话题会自动创建
+// 同一目标中同名的路由共用一个话题
+func ensureForumTopic(dest *Destination, topic *DestinationTopic) (int, error) {
+	if topic.ThreadID != 0 || topic.Name == "" {
+		return topic.ThreadID, nil
+	}
+
+	forumTopicMutex.Lock()
+	defer forumTopicMutex.Unlock()
+
+	// 其他协程可能已经创建了同名话题
+	var threadID int
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow(`
+			SELECT thread_id FROM destination_topics
+			WHERE destination_id = ? AND topic_name = ? AND thread_id != 0 LIMIT 1`,
+			dest.ID, topic.Name).Scan(&threadID)
+	})
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if threadID == 0 {
+		if threadID, err = createForumTopic(dest.ChatID, topic.Name); err != nil {
+			return 0, err
+		}
+		logMessage("info", fmt.Sprintf("已在 %s 中创建话题: %s", dest.label(), topic.Name), dest.OwnerID)
+	}
+	if err := setTopicThreadID(dest.ID, topic.Name, threadID); err != nil {
+		return 0, err
+	}
+	topic.ThreadID = threadID
+	return threadID, nil
+}
+
+// isThreadNotFound 判断是否为话题不存在（已被删除或关闭）的错误
+func isThreadNotFound(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "thread not found") || strings.Contains(message, "topic_deleted") ||
+		strings.Contains(message, "topic_closed")
+}
+
+// sendThreadMessage 向话题发送消息，图片发送失败时改为发送文本
+// 当前 API 库不支持 message_thread_id，直接构造请求
+func sendThreadMessage(chatID int64, threadID int, imageURL, htmlMessage string) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero("message_thread_id", threadID)
+	params["parse_mode"] = "HTML"
+
+	if imageURL != "" {
+		params["photo"] = imageURL
+		params["caption"] = htmlMessage
+		_, err := bot.MakeRequest("sendPhoto", params)
+		if err == nil || isThreadNotFound(err) {
+			return err
+		}
+		logMessage("error", fmt.Sprintf("发送图片消息到话题失败: %v", err))
+		delete(params, "photo")
+		delete(params, "caption")
+		htmlMessage = photoFallbackText(imageURL, htmlMessage)
+	}
+
+	params["text"] = htmlMessage
+	_, err := bot.MakeRequest("sendMessage", params)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("发送话题消息失败: %v", err))
+	}
+	return err
+}
+
+// sendToDestinationTopic 发送到推送目标的话题，话题不存在时按名称重新创建并重试一次
+// 无法创建话题时发到 General
+func sendToDestinationTopic(dest *Destination, topic *DestinationTopic, imageURL, htmlMessage string) error {
+	threadID, err := ensureForumTopic(dest, topic)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("创建话题 %s 失败，改为发送到 General: %v", topic.label(), err), dest.OwnerID)
+		threadID = 0
+	}
+	err = sendThreadMessage(dest.ChatID, threadID, imageURL, htmlMessage)
+	if err == nil || threadID == 0 || !isThreadNotFound(err) {
+		return err
+	}
+
+	logMessage("info", fmt.Sprintf("%s 中的话题 %s 已不存在", dest.label(), topic.label()), dest.OwnerID)
+	if topic.Name == "" {
+		// 直接指定的话题ID无法重建
+		return sendThreadMessage(dest.ChatID, 0, imageURL, htmlMessage)
+	}
+	if err := setTopicThreadID(dest.ID, topic.Name, 0); err != nil {
+		return err
+	}
+	topic.ThreadID = 0
+	if threadID, err = ensureForumTopic(dest, topic); err != nil {
+		logMessage("warn", fmt.Sprintf("重新创建话题 %s 失败，改为发送到 General: %v", topic.label(), err), dest.OwnerID)
+		threadID = 0
+	}
+	return sendThreadMessage(dest.ChatID, threadID, imageURL, htmlMessage)
+}
+
+// parseTopicInput 解析话题输入：话题名称、#话题ID 或话题链接 t.me/c/<会话>/<话题ID>
+func parseTopicInput(text string) (string, int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", 0, fmt.Errorf("请输入话题名称")
+	}
+	if strings.HasPrefix(text, "#") {
+		threadID, err := strconv.Atoi(strings.TrimPrefix(text, "#"))
+		if err != nil || threadID <= 0 {
+			return "", 0, fmt.Errorf("话题ID格式错误")
+		}
+		return "", threadID, nil
+	}
+	link := strings.TrimPrefix(strings.TrimPrefix(text, "https://"), "http://")
+	if strings.HasPrefix(link, "t.me/c/") {
+		parts := strings.Split(strings.TrimPrefix(link, "t.me/c/"), "/")
+		if len(parts) < 2 {
+			return "", 0, fmt.Errorf("话题链接格式错误")
+		}
+		threadID, err := strconv.Atoi(parts[1])
+		if err != nil || threadID <= 0 {
+			return "", 0, fmt.Errorf("话题链接格式错误")
+		}
+		return "", threadID, nil
+	}
+	if len([]rune(text)) > 128 {
+		return "", 0, fmt.Errorf("话题名称不能超过128个字符")
+	}
+	return text, 0, nil
+}
+
+// parseKeywordTopicInput 解析按关键词设置话题的输入，每行格式为 "关键词1,关键词2=话题"
+func parseKeywordTopicInput(text string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		index := strings.LastIndex(line, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("格式错误：%s", line)
+		}
+		topic := strings.TrimSpace(line[index+1:])
+		keywords := strings.FieldsFunc(line[:index], func(r rune) bool {
+			return r == ',' || r == '，' || unicode.IsSpace(r)
+		})
+		for _, keyword := range keywords {
+			body, _ := keywordBody(keyword)
+			result[body] = topic
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("请输入关键词和话题")
+	}
+	return result, nil
+}
+
+// newDestinationTopic 根据输入创建话题路由，按名称设置时复用已创建的同名话题
+func newDestinationTopic(dest *Destination, kind, key, input string) (*DestinationTopic, error) {
+	name, threadID, err := parseTopicInput(input)
+	if err != nil {
+		return nil, err
+	}
+	topic := &DestinationTopic{DestinationID: dest.ID, Kind: kind, Key: key, Name: name, ThreadID: threadID}
+	if name != "" {
+		for _, existing := range dest.Topics {
+			if existing.Name == name && existing.ThreadID != 0 {
+				topic.ThreadID = existing.ThreadID
+				break
+			}
+		}
+	}
+	return topic, nil
+}
+
+// showDestinationTopics 显示推送目标的话题路由
+func showDestinationTopics(userID int64, messageID int, dest *Destination) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取订阅失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取订阅失败，请稍后重试")
+		return
+	}
+
+	var lines []string
+	defaultTopic := "General"
+	if topic := dest.findTopic(TopicRouteDefault, ""); topic != nil {
+		defaultTopic = topic.label()
+	}
+	lines = append(lines, "🏠 默认话题："+defaultTopic)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🏠 设置默认话题", fmt.Sprintf("dest_tpset_%d_d", dest.ID)),
+	))
+
+	routed := make(map[string]bool, len(dest.Routes))
+	for _, route := range dest.Routes {
+		routed[route] = true
+	}
+	for _, sub := range subscriptions {
+		if !routed[sub.Name] {
+			continue
+		}
+		topicName := "跟随默认"
+		if topic := dest.findTopic(TopicRouteSubscription, sub.Name); topic != nil {
+			topicName = topic.label()
+			lines = append(lines, fmt.Sprintf("📰 %s → %s", sub.Name, topicName))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📰 %s：%s", sub.Name, topicName), fmt.Sprintf("dest_tpset_%d_s%d", dest.ID, sub.ID)),
+		))
+	}
+
+	for _, topic := range dest.Topics {
+		if topic.Kind != TopicRouteKeyword {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("🔑 %s → %s", topic.Key, topic.label()))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑️ %s → %s", topic.Key, topic.label()), fmt.Sprintf("dest_tpdel_%d_%s", dest.ID, keywordHashID(topic.Key))),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔑 按关键词设置", fmt.Sprintf("dest_tpset_%d_k", dest.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("dest_view_%d", dest.ID)),
+		),
+	)
+
+	text := fmt.Sprintf(`🧵 %s 的话题路由
+
+%s
+
+命中的关键词优先，其次按订阅，最后发到默认话题。
+按名称设置的话题不存在时会自动创建，需要 @%s 有“管理话题”权限。`, dest.label(), strings.Join(lines, "\n"), bot.Self.UserName)
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showDestinationTopicPrompt 提示输入话题，arg 为 d（默认）、k（按关键词）或 s<订阅ID>
+func showDestinationTopicPrompt(userID int64, messageID int, dest *Destination, arg string) {
+	kind, key := TopicRouteDefault, ""
+	var text string
+	switch {
+	case arg == "d":
+		text = "🏠 请输入默认话题"
+	case arg == "k":
+		kind = TopicRouteKeyword
+		text = `🔑 请按 "关键词=话题" 的格式输入，每行一条，多个关键词用逗号分隔：
+
+📝 示例：
+优惠,折扣=Deals
+漏洞,CVE=Security
+
+已设置的关键词会被覆盖，话题填 - 表示删除`
+	case strings.HasPrefix(arg, "s"):
+		subID, err := strconv.Atoi(strings.TrimPrefix(arg, "s"))
+		if err != nil {
+			messageSender.SendError(userID, messageID, "❌ 参数错误")
+			return
+		}
+		sub, err := getSubscriptionInfoByID(userID, subID)
+		if err != nil {
+			messageSender.SendError(userID, messageID, "❌ 订阅不存在")
+			return
+		}
+		kind, key = TopicRouteSubscription, sub.Name
+		text = fmt.Sprintf("📰 请输入订阅 %s 要发送到的话题", sub.Name)
+	default:
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	if kind != TopicRouteKeyword {
+		text += `：
+
+• 话题名称：不存在时自动创建，例如 Deals
+• #话题ID 或话题链接：使用已有话题
+• 输入 - 取消设置`
+	}
+
+	setUserState(userID, "set_destination_topic", messageID, map[string]interface{}{
+		"destination_id": dest.ID,
+		"kind":           kind,
+		"key":            key,
+	})
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("dest_topics_%d", dest.ID)),
+		),
+	)
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleDestinationTopicInput 处理话题路由输入
+func handleDestinationTopicInput(message *tgbotapi.Message, state *UserState) {
+	userID := message.Chat.ID
+	destID, _ := state.Data["destination_id"].(int64)
+	kind, _ := state.Data["kind"].(string)
+	key, _ := state.Data["key"].(string)
+	dest, err := getDestinationForUser(userID, destID)
+	if err != nil {
+		clearUserState(userID)
+		messageSender.SendError(userID, 0, "❌ 推送目标不存在")
+		return
+	}
+
+	routes := map[string]string{key: message.Text}
+	if kind == TopicRouteKeyword {
+		if routes, err = parseKeywordTopicInput(message.Text); err != nil {
+			messageSender.SendError(userID, 0, "❌ "+err.Error())
+			return
+		}
+	}
+
+	var topics []*DestinationTopic
+	for routeKey, input := range routes {
+		if strings.TrimSpace(input) == "-" {
+			topics = append(topics, &DestinationTopic{DestinationID: dest.ID, Kind: kind, Key: routeKey})
+			continue
+		}
+		topic, err := newDestinationTopic(dest, kind, routeKey, input)
+		if err != nil {
+			messageSender.SendError(userID, 0, "❌ "+err.Error())
+			return
+		}
+		topics = append(topics, topic)
+	}
+
+	for _, topic := range topics {
+		if topic.Name == "" && topic.ThreadID == 0 {
+			err = deleteDestinationTopic(dest.ID, topic.Kind, topic.Key)
+		} else {
+			err = saveDestinationTopic(topic)
+		}
+		if err != nil {
+			logMessage("error", fmt.Sprintf("保存话题路由失败: %v", err), userID)
+			messageSender.SendError(userID, 0, "保存失败，请稍后重试")
+			return
+		}
+	}
+	clearUserState(userID)
+	logMessage("info", fmt.Sprintf("设置推送目标 %s 的话题路由: %d 条", dest.label(), len(topics)), userID)
+
+	// 立即创建新话题，以便及时发现权限问题
+	if dest, err = getDestinationForUser(userID, destID); err != nil {
+		return
+	}
+	var failed []string
+	for _, topic := range dest.Topics {
+		if _, err := ensureForumTopic(dest, topic); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", topic.label(), err))
+		}
+	}
+	if len(failed) > 0 {
+		sendMessage(userID, fmt.Sprintf("⚠️ 以下话题创建失败，推送会发到 General，请确认 Bot 有“管理话题”权限：\n\n%s", strings.Join(failed, "\n")))
+	}
+	showDestinationTopics(userID, state.MessageID, dest)
+}
+
+// deleteDestinationKeywordTopic 根据关键词哈希删除按关键词设置的话题
+func deleteDestinationKeywordTopic(dest *Destination, hashID string) error {
+	for _, topic := range dest.Topics {
+		if topic.Kind == TopicRouteKeyword && keywordHashID(topic.Key) == hashID {
+			return deleteDestinationTopic(dest.ID, topic.Kind, topic.Key)
+		}
+	}
+	return sql.ErrNoRows
+}
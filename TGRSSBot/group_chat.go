@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 群组模式：Bot 加入群组或超级群组后，以群组的会话ID作为设置的归属，
+// 每个群组有独立的订阅、关键词和推送设置，命中的内容直接推送到群组
+// 只有群组的创建者和管理员可以使用命令和菜单，群组中的命令支持 /cmd@botname 形式
+// 群组中新发送的菜单以回复发起消息的方式发出，使其出现在对应的话题中
+
+// groupAdminCacheTTL 群组管理员身份的缓存时间
+const groupAdminCacheTTL = 5 * time.Minute
+
+type groupAdminEntry struct {
+	admin   bool
+	expires time.Time
+}
+
+var (
+	groupAdminCache   = make(map[string]groupAdminEntry) // "会话ID:用户ID" -> 管理员身份
+	groupReplyTargets = make(map[int64]int)              // 群组ID -> 最近一条交互消息ID
+	groupMutex        sync.Mutex
+)
+
+// isGroupChat 判断会话是否为群组或超级群组
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// isGroupID 判断设置归属是否为群组，群组和超级群组的会话ID为负数
+func isGroupID(userID int64) bool {
+	return userID < 0
+}
+
+// isGroupAdmin 检查用户是否为群组的创建者或管理员
+func isGroupAdmin(chatID, userID int64) bool {
+	key := fmt.Sprintf("%d:%d", chatID, userID)
+	groupMutex.Lock()
+	entry, ok := groupAdminCache[key]
+	groupMutex.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.admin
+	}
+
+	member, err := getChatMemberStatus(chatID, userID)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取群组 %d 成员信息失败: %v", chatID, err), userID)
+		return false
+	}
+	admin := member.IsCreator() || member.IsAdministrator()
+
+	groupMutex.Lock()
+	groupAdminCache[key] = groupAdminEntry{admin: admin, expires: time.Now().Add(groupAdminCacheTTL)}
+	groupMutex.Unlock()
+	return admin
+}
+
+// isAnonymousAdmin 判断消息是否由匿名管理员以群组身份发出
+func isAnonymousAdmin(message *tgbotapi.Message) bool {
+	return message.SenderChat != nil && message.SenderChat.ID == message.Chat.ID
+}
+
+// accessCheckID 返回检查权限时使用的ID
+// 匿名管理员以群组身份发言，发送者是 GroupAnonymousBot，改为按群组本身的角色检查
+func accessCheckID(message *tgbotapi.Message) int64 {
+	if isAnonymousAdmin(message) {
+		return message.Chat.ID
+	}
+	return message.From.ID
+}
+
+// rejectsAnonymousAdmin 判断是否拒绝匿名管理员使用该命令
+// 管理命令按发送者本人的角色操作并记录操作者，匿名管理员无法确定本人身份
+func rejectsAnonymousAdmin(message *tgbotapi.Message, command string) bool {
+	if !isAnonymousAdmin(message) {
+		return false
+	}
+	_, adminOnly := commandRoles[command]
+	return adminOnly || command == "role"
+}
+
+// isCommandForBot 判断群组中的命令是否发给本 Bot，没有 @ 后缀的命令视为发给所有 Bot
+func isCommandForBot(message *tgbotapi.Message) bool {
+	command := message.CommandWithAt()
+	index := strings.Index(command, "@")
+	if index < 0 {
+		return true
+	}
+	return strings.EqualFold(command[index+1:], bot.Self.UserName)
+}
+
+// setGroupReplyTarget 记录群组中最近一条交互消息，之后新发送的菜单会回复该消息
+func setGroupReplyTarget(chatID int64, messageID int) {
+	groupMutex.Lock()
+	groupReplyTargets[chatID] = messageID
+	groupMutex.Unlock()
+}
+
+// applyGroupReplyTarget 群组中的新消息回复最近的交互消息，使其发到同一话题
+func applyGroupReplyTarget(base *tgbotapi.BaseChat) {
+	if !isGroupID(base.ChatID) {
+		return
+	}
+	groupMutex.Lock()
+	messageID, ok := groupReplyTargets[base.ChatID]
+	groupMutex.Unlock()
+	if ok {
+		base.ReplyToMessageID = messageID
+		base.AllowSendingWithoutReply = true
+	}
+}
+
+// handleGroupMessage 处理群组中的消息
+// 只处理发给本 Bot 的命令，以及管理员在输入状态下发送的内容，其余聊天内容忽略
+func handleGroupMessage(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.MigrateToChatID != 0 {
+		if err := migrateGroupChat(chatID, message.MigrateToChatID); err != nil {
+			logMessage("error", fmt.Sprintf("迁移群组设置失败: %v", err), chatID)
+		}
+		return
+	}
+
+	if message.IsCommand() {
+		if !isCommandForBot(message) {
+			return
+		}
+	} else if getUserState(chatID) == nil {
+		return
+	}
+
+	if !isAnonymousAdmin(message) && !isGroupAdmin(chatID, message.From.ID) {
+		if message.IsCommand() {
+			setGroupReplyTarget(chatID, message.MessageID)
+			sendMessage(chatID, "只有群组管理员可以管理本群的订阅和设置")
+		}
+		return
+	}
+
+	setGroupReplyTarget(chatID, message.MessageID)
+	handleMessage(message)
+}
+
+// groupSettingTables 按用户ID保存设置和数据的表，群组升级为超级群组时需要迁移
+var groupSettingTables = []string{
+	"user_keywords",
+	"user_settings",
+	"user_keyword_scopes",
+	"user_subscription_settings",
+	"user_ai_preferences",
+	"deferred_pushes",
+	"digest_items",
+	"keyword_hits",
+	"keyword_hit_totals",
+	"push_history",
+	"user_quotas",
+	"user_ai_usage",
+}
+
+// migrateGroupChat 群组升级为超级群组后会话ID改变，把订阅和设置迁移到新的会话ID
+func migrateGroupChat(oldChatID, newChatID int64) error {
+	err := withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, table := range groupSettingTables {
+			if _, err := tx.Exec("UPDATE "+table+" SET user_id = ? WHERE user_id = ?", newChatID, oldChatID); err != nil {
+				return fmt.Errorf("%s: %v", table, err)
+			}
+		}
+		if err := migrateSubscriptionUsers(tx, oldChatID, newChatID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+
+	clearUserState(oldChatID)
+	logMessage("info", fmt.Sprintf("群组已升级为超级群组，设置已迁移到 %d", newChatID), oldChatID)
+	return nil
+}
+
+// migrateSubscriptionUsers 把订阅用户列表中的旧会话ID替换为新会话ID
+func migrateSubscriptionUsers(tx *sql.Tx, oldChatID, newChatID int64) error {
+	rows, err := tx.Query("SELECT subscription_id, users FROM subscriptions")
+	if err != nil {
+		return err
+	}
+	updates := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var usersStr string
+		if err := rows.Scan(&id, &usersStr); err != nil {
+			rows.Close()
+			return err
+		}
+		users := parseUserIDs(usersStr)
+		changed := false
+		for i, userID := range users {
+			if userID == oldChatID {
+				users[i] = newChatID
+				changed = true
+			}
+		}
+		if changed {
+			usersJSON, err := json.Marshal(users)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			updates[id] = string(usersJSON)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, usersJSON := range updates {
+		if _, err := tx.Exec("UPDATE subscriptions SET users = ? WHERE subscription_id = ?", usersJSON, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chatDisplayName 返回菜单中显示的名称，群组显示群组名称
+func chatDisplayName(chat *tgbotapi.Chat, user *tgbotapi.User) string {
+	if isGroupChat(chat) {
+		return chat.Title
+	}
+	if user == nil {
+		return ""
+	}
+	return user.FirstName + " " + user.LastName
+}
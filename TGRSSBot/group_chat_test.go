@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestAccessCheckID(t *testing.T) {
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	anonymousBot := &tgbotapi.User{ID: 1087968824, UserName: "GroupAnonymousBot"}
+
+	tests := []struct {
+		name    string
+		message *tgbotapi.Message
+		want    int64
+	}{
+		{"private", &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 42, Type: "private"}, From: &tgbotapi.User{ID: 42}}, 42},
+		{"group member", &tgbotapi.Message{Chat: group, From: &tgbotapi.User{ID: 7}}, 7},
+		{"anonymous admin", &tgbotapi.Message{Chat: group, From: anonymousBot, SenderChat: group}, -100},
+		{"linked channel", &tgbotapi.Message{Chat: group, From: anonymousBot, SenderChat: &tgbotapi.Chat{ID: -200}}, anonymousBot.ID},
+	}
+	for _, tt := range tests {
+		if got := accessCheckID(tt.message); got != tt.want {
+			t.Errorf("%s: accessCheckID = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRejectsAnonymousAdmin(t *testing.T) {
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	anonymous := &tgbotapi.Message{Chat: group, From: &tgbotapi.User{ID: 1087968824}, SenderChat: group}
+	member := &tgbotapi.Message{Chat: group, From: &tgbotapi.User{ID: 7}}
+
+	tests := []struct {
+		message *tgbotapi.Message
+		command string
+		want    bool
+	}{
+		{anonymous, "broadcast", true},
+		{anonymous, "role", true},
+		{anonymous, "ban", true},
+		{anonymous, "list", false},
+		{member, "broadcast", false},
+		{member, "role", false},
+	}
+	for _, tt := range tests {
+		if got := rejectsAnonymousAdmin(tt.message, tt.command); got != tt.want {
+			t.Errorf("rejectsAnonymousAdmin(from %d, %s) = %v, want %v", tt.message.From.ID, tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 健康检查和自检：HTTP 服务提供 /healthz（存活）和 /readyz（就绪），返回各项检查的 JSON 报告
+// 检查项包括数据库、Telegram 更新获取、最近一轮 RSS 检查距今的时间和 AI 服务最近的调用结果
+// 自检协程每分钟检查一次，RSS 检查停滞或获取更新连续失败时私聊通知管理员，恢复后再通知一次
+
+// 检查状态
+const (
+	HealthOK       = "ok"       // 正常
+	HealthStarting = "starting" // 启动中，尚未有结果
+	HealthDegraded = "degraded" // 部分异常，不影响存活和就绪
+	HealthFail     = "fail"     // 异常
+	HealthDisabled = "disabled" // 未启用
+)
+
+const (
+	watchdogInterval        = time.Minute
+	defaultStalledCycles    = 3               // 默认多少个检查周期没有完成一轮检查时告警
+	defaultPollErrors       = 5               // 默认连续多少次获取更新失败时告警
+	telegramStaleAfter      = 3 * time.Minute // 超过该时间没有成功获取更新视为更新循环已停止
+	healthCheckTimeout      = 5 * time.Second
+	longPollTimeoutSeconds  = 50 // 长轮询的超时时间，需小于 HTTPTimeout，否则空闲时请求会超时
+	watchdogAlertCycle      = "cycle"
+	watchdogAlertTelegram   = "telegram"
+	healthTimeDisplayLayout = "2006-01-02 15:04:05"
+)
+
+// WatchdogConfig 自检配置
+type WatchdogConfig struct {
+	Disabled      bool `json:"disabled"`       // 关闭自检告警，健康检查接口不受影响
+	StalledCycles int  `json:"stalled_cycles"` // 多少个检查周期没有完成一轮检查时告警，默认 3
+	PollErrors    int  `json:"poll_errors"`    // 连续多少次获取更新失败时告警，默认 5
+}
+
+// validateWatchdogConfig 检查自检配置并补全默认值
+func validateWatchdogConfig(cfg *WatchdogConfig) error {
+	if cfg.StalledCycles < 0 || cfg.PollErrors < 0 {
+		return fmt.Errorf("Watchdog 的 stalled_cycles 和 poll_errors 不能为负数")
+	}
+	if cfg.StalledCycles == 0 {
+		cfg.StalledCycles = defaultStalledCycles
+	}
+	if cfg.PollErrors == 0 {
+		cfg.PollErrors = defaultPollErrors
+	}
+	return nil
+}
+
+// healthState 运行状态，由各处在运行中更新
+var healthState = struct {
+	sync.Mutex
+	startedAt     time.Time
+	lastCycleAt   time.Time // 最近一轮 RSS 检查完成的时间
+	lastPollAt    time.Time // 最近一次成功获取更新的时间
+	pollErrors    int       // 连续获取更新失败的次数
+	lastPollError string
+	aiLastOK      time.Time
+	aiLastErrorAt time.Time
+	aiLastError   string
+	webhookErrAt  int // Webhook 模式下已处理的最近一次推送错误时间
+	alerts        map[string]bool
+}{startedAt: time.Now(), alerts: make(map[string]bool)}
+
+// markCycleCompleted 记录一轮 RSS 检查完成
+func markCycleCompleted() {
+	healthState.Lock()
+	healthState.lastCycleAt = time.Now()
+	healthState.Unlock()
+}
+
+// markPollResult 记录一次获取更新的结果，Webhook 模式下为 getWebhookInfo 的结果
+func markPollResult(err error) {
+	healthState.Lock()
+	defer healthState.Unlock()
+	if err == nil {
+		healthState.lastPollAt = time.Now()
+		healthState.pollErrors = 0
+		healthState.lastPollError = ""
+		return
+	}
+	healthState.pollErrors++
+	healthState.lastPollError = err.Error()
+}
+
+// markAIResult 记录一次 AI 服务调用的结果
+func markAIResult(err error) {
+	healthState.Lock()
+	defer healthState.Unlock()
+	if err == nil {
+		healthState.aiLastOK = time.Now()
+		return
+	}
+	healthState.aiLastErrorAt = time.Now()
+	healthState.aiLastError = err.Error()
+}
+
+// cycleInterval RSS 检查周期
+func cycleInterval() time.Duration {
+	return time.Duration(globalConfig.Cycletime) * time.Minute
+}
+
+// HealthCheck 单项检查结果
+type HealthCheck struct {
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	AgeSeconds *int64 `json:"age_seconds,omitempty"` // 距最近一次成功的秒数
+}
+
+// HealthReport 健康检查报告
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Mode   string                 `json:"mode"` // 获取更新的方式 polling/webhook
+	Uptime int64                  `json:"uptime_seconds"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+func ageSeconds(t time.Time, now time.Time) *int64 {
+	age := int64(now.Sub(t).Seconds())
+	return &age
+}
+
+// checkDatabase 检查数据库能否查询
+func checkDatabase(ctx context.Context) HealthCheck {
+	err := withDB(func(db *sql.DB) error {
+		var one int
+		return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+	if err != nil {
+		return HealthCheck{Status: HealthFail, Detail: err.Error()}
+	}
+	return HealthCheck{Status: HealthOK}
+}
+
+// checkRSSCycle 检查最近一轮 RSS 检查是否在允许的时间内完成
+func checkRSSCycle(now time.Time) HealthCheck {
+	healthState.Lock()
+	lastCycleAt, startedAt := healthState.lastCycleAt, healthState.startedAt
+	healthState.Unlock()
+
+	limit := time.Duration(globalConfig.Watchdog.StalledCycles) * cycleInterval()
+	if lastCycleAt.IsZero() {
+		if now.Sub(startedAt) > limit {
+			return HealthCheck{Status: HealthFail, Detail: fmt.Sprintf("启动 %s 后仍未完成首轮检查", formatDuration(now.Sub(startedAt)))}
+		}
+		return HealthCheck{Status: HealthStarting, Detail: "首轮检查进行中"}
+	}
+	check := HealthCheck{Status: HealthOK, AgeSeconds: ageSeconds(lastCycleAt, now)}
+	if age := now.Sub(lastCycleAt); age > limit {
+		check.Status = HealthFail
+		check.Detail = fmt.Sprintf("已有 %s 没有完成检查（周期 %s）", formatDuration(age), formatDuration(cycleInterval()))
+	}
+	return check
+}
+
+// checkTelegram 检查获取更新是否正常
+func checkTelegram(now time.Time) HealthCheck {
+	healthState.Lock()
+	lastPollAt, startedAt := healthState.lastPollAt, healthState.startedAt
+	pollErrors, lastPollError := healthState.pollErrors, healthState.lastPollError
+	healthState.Unlock()
+
+	since := lastPollAt
+	if since.IsZero() {
+		since = startedAt
+	}
+	check := HealthCheck{Status: HealthOK}
+	if !lastPollAt.IsZero() {
+		check.AgeSeconds = ageSeconds(lastPollAt, now)
+	}
+	switch {
+	case pollErrors >= globalConfig.Watchdog.PollErrors:
+		check.Status = HealthFail
+		check.Detail = fmt.Sprintf("连续 %d 次获取更新失败: %s", pollErrors, lastPollError)
+	case now.Sub(since) > telegramStaleAfter:
+		check.Status = HealthFail
+		check.Detail = fmt.Sprintf("已有 %s 没有成功获取更新", formatDuration(now.Sub(since)))
+	case lastPollAt.IsZero():
+		check.Status = HealthStarting
+	case pollErrors > 0:
+		check.Status = HealthDegraded
+		check.Detail = fmt.Sprintf("连续 %d 次获取更新失败: %s", pollErrors, lastPollError)
+	}
+	return check
+}
+
+// checkAI 根据最近一次调用的结果判断 AI 服务状态，不主动调用以免产生费用
+func checkAI() HealthCheck {
+	if globalConfig.AI == nil || !globalConfig.AI.Enabled {
+		return HealthCheck{Status: HealthDisabled}
+	}
+	healthState.Lock()
+	lastOK, lastErrorAt, lastError := healthState.aiLastOK, healthState.aiLastErrorAt, healthState.aiLastError
+	healthState.Unlock()
+
+	switch {
+	case !lastErrorAt.IsZero() && lastErrorAt.After(lastOK):
+		return HealthCheck{Status: HealthDegraded, Detail: "最近一次调用失败: " + lastError}
+	case lastOK.IsZero():
+		return HealthCheck{Status: HealthOK, Detail: "尚未调用"}
+	default:
+		return HealthCheck{Status: HealthOK, AgeSeconds: ageSeconds(lastOK, time.Now())}
+	}
+}
+
+// buildHealthReport 生成健康检查报告，required 中的检查项为 failing 中的状态时整体为 fail
+func buildHealthReport(ctx context.Context, required []string, failing ...string) HealthReport {
+	now := time.Now()
+	mode := "polling"
+	if webhookEnabled() {
+		mode = "webhook"
+	}
+	report := HealthReport{
+		Status: HealthOK,
+		Mode:   mode,
+		Uptime: int64(now.Sub(healthState.startedAt).Seconds()),
+		Checks: map[string]HealthCheck{
+			"database":  checkDatabase(ctx),
+			"telegram":  checkTelegram(now),
+			"rss_cycle": checkRSSCycle(now),
+			"ai":        checkAI(),
+		},
+	}
+	for _, name := range required {
+		for _, status := range failing {
+			if report.Checks[name].Status == status {
+				report.Status = HealthFail
+			}
+		}
+	}
+	return report
+}
+
+// writeHealthReport 返回报告，整体异常时状态码为 503
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if report.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// handleHealthz 存活检查：RSS 检查停滞或更新循环停止时失败，重启可以恢复
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	writeHealthReport(w, buildHealthReport(ctx, []string{"rss_cycle", "telegram"}, HealthFail))
+}
+
+// handleReadyz 就绪检查：数据库和 Telegram 可用且已完成首轮检查时才就绪
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	writeHealthReport(w, buildHealthReport(ctx, []string{"database", "telegram", "rss_cycle"}, HealthFail, HealthStarting))
+}
+
+// seedWebhookErrorDate 记录启动时 Telegram 报告的最近一次推送错误时间，之前遗留的错误不再视为新的失败
+func seedWebhookErrorDate() {
+	info, err := bot.GetWebhookInfo()
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取 Webhook 信息失败: %v", err))
+		return
+	}
+	healthState.Lock()
+	healthState.webhookErrAt = info.LastErrorDate
+	healthState.Unlock()
+}
+
+// probeWebhook Webhook 模式下 Telegram 只在有更新时推送，通过 getWebhookInfo 确认 Telegram 可访问且推送没有出错
+func probeWebhook() {
+	info, err := bot.GetWebhookInfo()
+	if err != nil {
+		markPollResult(err)
+		return
+	}
+	healthState.Lock()
+	newError := info.LastErrorDate > healthState.webhookErrAt
+	healthState.webhookErrAt = info.LastErrorDate
+	healthState.Unlock()
+	if newError {
+		markPollResult(fmt.Errorf("Telegram 推送 Webhook 失败: %s", info.LastErrorMessage))
+		return
+	}
+	markPollResult(nil)
+}
+
+// notifyAdmins 私聊通知所有管理员，返回是否至少有一人收到
+func notifyAdmins(text string) bool {
+	adminIDs, err := getAdminIDs()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取管理员列表失败: %v", err))
+	}
+	if len(adminIDs) == 0 && globalConfig.ADMINIDS != 0 {
+		adminIDs = []int64{globalConfig.ADMINIDS}
+	}
+
+	delivered := false
+	for _, adminID := range adminIDs {
+		if _, err := bot.Send(tgbotapi.NewMessage(adminID, text)); err != nil {
+			logMessage("warn", fmt.Sprintf("发送自检告警失败: %v", err), adminID)
+			continue
+		}
+		delivered = true
+	}
+	return delivered
+}
+
+// updateWatchdogAlert 告警状态变化时通知管理员，告警未送达时下次继续尝试
+func updateWatchdogAlert(key string, failing bool, alert, recovery string) {
+	healthState.Lock()
+	active := healthState.alerts[key]
+	healthState.Unlock()
+
+	switch {
+	case failing && !active:
+		logMessage("error", "自检告警: "+alert)
+		if notifyAdmins("🚨 " + alert) {
+			healthState.Lock()
+			healthState.alerts[key] = true
+			healthState.Unlock()
+		}
+	case !failing && active:
+		logMessage("info", "自检恢复: "+recovery)
+		notifyAdmins("✅ " + recovery)
+		healthState.Lock()
+		healthState.alerts[key] = false
+		healthState.Unlock()
+	}
+}
+
+// runWatchdog 执行一次自检
+func runWatchdog() {
+	if webhookEnabled() {
+		probeWebhook()
+	}
+	if globalConfig.Watchdog.Disabled {
+		return
+	}
+
+	now := time.Now()
+	cycle := checkRSSCycle(now)
+	healthState.Lock()
+	lastCycleAt := healthState.lastCycleAt
+	healthState.Unlock()
+	updateWatchdogAlert(watchdogAlertCycle, cycle.Status == HealthFail,
+		"RSS 检查停滞："+cycle.Detail,
+		fmt.Sprintf("RSS 检查已恢复，最近一轮完成于 %s", lastCycleAt.Format(healthTimeDisplayLayout)))
+
+	telegram := checkTelegram(now)
+	updateWatchdogAlert(watchdogAlertTelegram, telegram.Status == HealthFail,
+		"Telegram 获取更新异常："+telegram.Detail,
+		"Telegram 获取更新已恢复")
+}
+
+// startWatchdog 启动自检协程
+func startWatchdog() {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logMessage("error", fmt.Sprintf("自检发生panic: %v", r))
+				}
+			}()
+			runWatchdog()
+		}()
+	}
+}
+
+// formatDuration 以分钟为单位显示时长
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "不到1分钟"
+	}
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%d分钟", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%d小时", hours)
+	default:
+		return fmt.Sprintf("%d小时%d分钟", hours, minutes)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 可选的 HTTP 服务，为内部工具提供管理 API、Prometheus 指标和健康检查等接口
+// 与 Webhook 模式的服务相互独立，需使用不同的监听地址
+
+const (
+	httpDefaultListen   = "127.0.0.1:8080"
+	httpReadTimeout     = 30 * time.Second
+	httpWriteTimeout    = 60 * time.Second // 添加订阅时需要验证 RSS 源，留出足够时间
+	httpMaxRequestBytes = 1 << 20          // 请求体的最大字节数
+)
+
+// HTTPConfig HTTP 服务配置
+type HTTPConfig struct {
+	Enabled  bool   `json:"enabled"`   // 是否启用 HTTP 服务
+	Listen   string `json:"listen"`    // 监听地址，默认 127.0.0.1:8080
+	API      bool   `json:"api"`       // 是否提供管理 API
+	Metrics  bool   `json:"metrics"`   // 是否提供 /metrics 指标
+	CertFile string `json:"cert_file"` // TLS 证书文件，留空时以 HTTP 监听
+	KeyFile  string `json:"key_file"`  // TLS 私钥文件
+}
+
+// validateHTTPConfig 检查 HTTP 服务配置并补全默认值
+func validateHTTPConfig(cfg *HTTPConfig) error {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = httpDefaultListen
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("HTTP 服务的 cert_file 和 key_file 需同时设置")
+	}
+	return nil
+}
+
+// httpEnabled 是否启用 HTTP 服务
+func httpEnabled() bool {
+	return globalConfig.HTTP != nil && globalConfig.HTTP.Enabled
+}
+
+// newHTTPMux 按配置注册各功能的路由
+func newHTTPMux(cfg *HTTPConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	mux.HandleFunc("GET /readyz", handleReadyz)
+	if cfg.API {
+		registerAPIRoutes(mux)
+	}
+	if cfg.Metrics {
+		mux.HandleFunc("GET /metrics", handleMetrics)
+	}
+	return mux
+}
+
+// startHTTPServer 启动 HTTP 服务，监听失败时只记录日志，不影响 Bot 运行
+func startHTTPServer() {
+	if !httpEnabled() {
+		return
+	}
+	cfg := globalConfig.HTTP
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           newHTTPMux(cfg),
+		ReadHeaderTimeout: httpReadTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+	}
+
+	logMessage("info", fmt.Sprintf("HTTP 服务已启动，监听 %s", cfg.Listen))
+	var err error
+	if cfg.CertFile != "" {
+		err = server.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logMessage("error", fmt.Sprintf("HTTP 服务异常退出: %v", err))
+	}
+}
+
+// writeJSON 以 JSON 格式返回响应
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if value == nil {
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		logMessage("warn", fmt.Sprintf("写入 HTTP 响应失败: %v", err))
+	}
+}
+
+// writeJSONError 返回 {"error": "..."} 格式的错误
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// readJSON 解析请求体，不允许未知字段，避免拼错的字段被静默忽略
+func readJSON(w http.ResponseWriter, r *http.Request, value interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+		return false
+	}
+	return true
+}
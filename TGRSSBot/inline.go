@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 内联查询：在任意聊天中输入 @bot 关键词，搜索自己订阅的 RSS 源最近抓取的内容，
+// 选中后以推送的格式发送到当前聊天
+// 每轮检查抓取到的新内容保存在 recent_items 中，保留 recentItemsKeepDays 天
+// 同一用户相同查询的结果缓存 inlineCacheTTL，翻页时直接使用缓存
+
+const (
+	recentItemsKeepDays   = 7                     // 最近内容的保留天数
+	recentItemsTimeLayout = "2006-01-02 15:04:05" // 数据库中时间的格式（UTC）
+	inlinePageSize        = 20                    // 每页结果数
+	inlineMaxResults      = 200                   // 每次查询最多返回的结果数
+	inlineCacheTTL        = 30 * time.Second      // 查询结果的缓存时间
+	inlineMaxDescription  = 3000                  // 内容的最大长度，避免超出消息长度限制
+)
+
+// RecentItem 最近抓取的内容
+type RecentItem struct {
+	ID      int64
+	RSSName string
+	Channel int
+	Message Message
+}
+
+type inlineCacheEntry struct {
+	items   []RecentItem
+	expires time.Time
+}
+
+var (
+	inlineCache      = make(map[string]inlineCacheEntry) // "用户ID:查询" -> 查询结果
+	inlineCacheMutex sync.Mutex
+
+	recentItemsPrunedDay string
+	recentItemsMutex     sync.Mutex
+)
+
+// saveRecentItems 保存本轮抓取到的新内容，供内联查询搜索
+func saveRecentItems(db *sql.DB, rssName string, messages []Message) {
+	tx, err := db.Begin()
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("保存最近内容失败 %s: %v", rssName, err))
+		return
+	}
+	defer tx.Rollback()
+
+	for _, msg := range messages {
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO recent_items (rss_name, title, link, description, pub_date)
+			VALUES (?, ?, ?, ?, ?)`,
+			rssName, msg.Title, msg.Link, msg.Description, msg.PubDate.UTC().Format(recentItemsTimeLayout))
+		if err != nil {
+			logMessage("warn", fmt.Sprintf("保存最近内容失败 %s: %v", rssName, err))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logMessage("warn", fmt.Sprintf("保存最近内容失败 %s: %v", rssName, err))
+	}
+}
+
+// pruneRecentItems 每天清理一次过期的最近内容
+func pruneRecentItems(db *sql.DB) {
+	today := time.Now().UTC().Format(keywordHitDayLayout)
+
+	recentItemsMutex.Lock()
+	defer recentItemsMutex.Unlock()
+	if recentItemsPrunedDay == today {
+		return
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -recentItemsKeepDays).Format(recentItemsTimeLayout)
+	result, err := db.Exec("DELETE FROM recent_items WHERE fetched_at < ?", cutoff)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("清理最近内容失败: %v", err))
+		return
+	}
+	recentItemsPrunedDay = today
+	if n, _ := result.RowsAffected(); n > 0 {
+		logMessage("debug", fmt.Sprintf("已清理 %d 条过期的最近内容", n))
+	}
+}
+
+// escapeLikePattern 转义 LIKE 中的通配符
+func escapeLikePattern(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
+
+// searchRecentItems 在用户订阅的最近内容中搜索，每个词都需出现在标题或内容中，查询为空时返回最新内容
+func searchRecentItems(userID int64, query string) ([]RecentItem, error) {
+	var items []RecentItem
+	err := withDB(func(db *sql.DB) error {
+		subscriptions, err := getSubscriptions(db)
+		if err != nil {
+			return err
+		}
+		channels := make(map[string]int)
+		for _, sub := range subscriptions {
+			for _, uid := range sub.Users {
+				if uid == userID {
+					channels[sub.Name] = sub.Channel
+					break
+				}
+			}
+		}
+		if len(channels) == 0 {
+			return nil
+		}
+
+		var conditions []string
+		var args []interface{}
+		var placeholders []string
+		for name := range channels {
+			placeholders = append(placeholders, "?")
+			args = append(args, name)
+		}
+		conditions = append(conditions, "rss_name IN ("+strings.Join(placeholders, ", ")+")")
+		for _, word := range strings.Fields(query) {
+			pattern := "%" + escapeLikePattern(word) + "%"
+			conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`)
+			args = append(args, pattern, pattern)
+		}
+		args = append(args, inlineMaxResults)
+
+		rows, err := db.Query(`
+			SELECT id, rss_name, title, link, description, pub_date FROM recent_items
+			WHERE `+strings.Join(conditions, " AND ")+`
+			ORDER BY pub_date DESC, id DESC LIMIT ?`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var item RecentItem
+			var pubDate string
+			if err := rows.Scan(&item.ID, &item.RSSName, &item.Message.Title, &item.Message.Link,
+				&item.Message.Description, &pubDate); err != nil {
+				return err
+			}
+			item.Message.PubDate, _ = time.ParseInLocation(recentItemsTimeLayout, pubDate, time.UTC)
+			item.Channel = channels[item.RSSName]
+			items = append(items, item)
+		}
+		return rows.Err()
+	})
+	return items, err
+}
+
+// cachedSearchRecentItems 带缓存的搜索，翻页时复用第一次查询的结果
+func cachedSearchRecentItems(userID int64, query string) ([]RecentItem, error) {
+	key := fmt.Sprintf("%d:%s", userID, query)
+	now := time.Now()
+
+	inlineCacheMutex.Lock()
+	entry, ok := inlineCache[key]
+	inlineCacheMutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.items, nil
+	}
+
+	items, err := searchRecentItems(userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	inlineCacheMutex.Lock()
+	for k, e := range inlineCache {
+		if now.After(e.expires) {
+			delete(inlineCache, k)
+		}
+	}
+	inlineCache[key] = inlineCacheEntry{items: items, expires: now.Add(inlineCacheTTL)}
+	inlineCacheMutex.Unlock()
+	return items, nil
+}
+
+// buildInlineResult 把最近内容构造为内联结果，消息格式与推送一致
+func buildInlineResult(userID int64, item RecentItem, query string) tgbotapi.InlineQueryResultArticle {
+	msg := item.Message
+	msg.Title = html.EscapeString(msg.Title)
+	msg.Description = truncateText(msg.Description, inlineMaxDescription)
+
+	label := "最新内容"
+	if query != "" {
+		label = query
+	}
+	sub := Subscription{Name: item.RSSName, Channel: item.Channel}
+	text, _ := buildPushMessage(userID, sub, &ProcessedMessage{Original: &msg}, formatKeywordCodes([]string{html.EscapeString(label)}))
+
+	title := item.Message.Title
+	if strings.TrimSpace(title) == "" {
+		title = item.RSSName
+	}
+	result := tgbotapi.NewInlineQueryResultArticleHTML(strconv.FormatInt(item.ID, 10), title, text)
+	result.URL = item.Message.Link
+	result.Description = fmt.Sprintf("%s · %s", item.RSSName, formatTimeForUser(userID, item.Message.PubDate))
+	return result
+}
+
+// handleInlineQuery 处理内联查询，按 offset 分页返回结果
+func handleInlineQuery(inlineQuery *tgbotapi.InlineQuery) {
+	userID := inlineQuery.From.ID
+	query := strings.TrimSpace(inlineQuery.Query)
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: inlineQuery.ID,
+		CacheTime:     int(inlineCacheTTL.Seconds()),
+		IsPersonal:    true,
+		Results:       []interface{}{},
+	}
+
+	if ok, _ := checkAccess(userID, RoleUser); !ok {
+		if _, err := bot.Request(answer); err != nil {
+			logMessage("warn", fmt.Sprintf("回应内联查询失败: %v", err), userID)
+		}
+		return
+	}
+
+	items, err := cachedSearchRecentItems(userID, query)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("搜索最近内容失败: %v", err), userID)
+		return
+	}
+
+	offset, _ := strconv.Atoi(inlineQuery.Offset)
+	if offset < 0 || offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + inlinePageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	for _, item := range items[offset:end] {
+		answer.Results = append(answer.Results, buildInlineResult(userID, item, query))
+	}
+	if end < len(items) {
+		answer.NextOffset = strconv.Itoa(end)
+	}
+	if len(items) == 0 && offset == 0 {
+		answer.SwitchPMText = "没有找到内容，打开 Bot 管理订阅"
+		answer.SwitchPMParameter = "inline"
+	}
+
+	if _, err := bot.Request(answer); err != nil {
+		logMessage("warn", fmt.Sprintf("回应内联查询失败: %v", err), userID)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 关键词详情：查看单个关键词的类型、修饰符和生效范围，并可切换整词匹配、区分大小写和 NEAR 距离
+// 修饰符保存在关键词文本中，修改后关键词文本随之变化，订阅范围和命中统计会一并迁移
+
+// describeKeywordType 描述关键词本体（不含 ! 和 - 前缀）的类型
+func describeKeywordType(body string) string {
+	_, rest := parseKeywordModifiers(body)
+	switch {
+	case isPinyinKeyword(body):
+		return "拼音关键词"
+	case isRegexKeyword(body):
+		return "正则关键词"
+	case isNearKeyword(body):
+		return "NEAR 邻近关键词"
+	case isKeywordExpression(rest):
+		return "关键词表达式"
+	case strings.Contains(rest, "*"):
+		return "通配符关键词"
+	default:
+		return "普通关键词"
+	}
+}
+
+// replaceKeywordForUser 将用户的关键词替换为新的写法，订阅范围和命中统计随之迁移
+func replaceKeywordForUser(userID int64, oldKeyword, newKeyword string) error {
+	if oldKeyword == newKeyword {
+		return nil
+	}
+	if problems := validateKeywordSyntax([]string{newKeyword}); len(problems) > 0 {
+		return fmt.Errorf("关键词无效: %s", newKeyword)
+	}
+
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, kw := range keywords {
+		if kw == newKeyword {
+			return fmt.Errorf("关键词 %s 已存在", newKeyword)
+		}
+		if kw == oldKeyword {
+			keywords[i] = newKeyword
+			found = true
+		}
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+
+	sort.Strings(keywords)
+	keywordsJSON, err := json.Marshal(keywords)
+	if err != nil {
+		return err
+	}
+
+	return withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("UPDATE user_keywords SET keywords = ? WHERE user_id = ?",
+			string(keywordsJSON), userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE user_keyword_scopes SET keyword = ? WHERE user_id = ? AND keyword = ?",
+			newKeyword, userID, oldKeyword); err != nil {
+			return err
+		}
+		if err := renameKeywordHits(tx, userID, oldKeyword, newKeyword); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// showKeywordDetailList 显示关键词详情列表
+func showKeywordDetailList(userID int64, messageID int) {
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户关键词失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词失败，请稍后重试")
+		return
+	}
+	if len(keywords) == 0 {
+		messageSender.SendError(userID, messageID, "你还没有添加任何关键词")
+		return
+	}
+
+	sort.Strings(keywords)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, kw := range keywords {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔑 "+kw, "kw_detail_"+keywordHashID(kw)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "back_to_menu"),
+	))
+
+	text := "🔧 关键词详情\n\n选择关键词查看详情，可设置整词匹配、区分大小写和 NEAR 距离："
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showKeywordDetail 显示单个关键词的详情和修饰符选项
+func showKeywordDetail(userID int64, messageID int, hashID string) {
+	keyword, err := findKeywordByHashID(userID, hashID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 关键词不存在")
+		return
+	}
+
+	scopes, err := getKeywordScopesForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取关键词范围失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词范围失败，请稍后重试")
+		return
+	}
+
+	prefix, body := splitKeywordPrefix(keyword)
+	mods, rest := parseKeywordModifiers(body)
+
+	var lines []string
+	lines = append(lines, "🔑 关键词："+keyword, "📌 类型："+describeKeywordType(body))
+	if strings.Contains(prefix, "-") {
+		lines = append(lines, "🚫 屏蔽词：命中时不推送")
+	}
+	if strings.HasPrefix(prefix, UrgentKeywordPrefix) {
+		lines = append(lines, "🚨 紧急关键词：免打扰时段内也会推送")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if supportsKeywordModifiers(rest) {
+		lines = append(lines,
+			"🔤 整词匹配："+describeSwitch(mods.wholeWord),
+			"🔠 区分大小写："+describeSwitch(mods.caseSensitive))
+
+		wholeLabel, caseLabel := "⬜ 整词匹配", "⬜ 区分大小写"
+		if mods.wholeWord {
+			wholeLabel = "✅ 整词匹配"
+		}
+		if mods.caseSensitive {
+			caseLabel = "✅ 区分大小写"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(wholeLabel, "kw_mod_w_"+hashID),
+			tgbotapi.NewInlineKeyboardButtonData(caseLabel, "kw_mod_c_"+hashID),
+		))
+	} else {
+		lines = append(lines, "🔤 该类型关键词不支持整词匹配和区分大小写")
+	}
+
+	if near, _ := parseNearKeyword(rest); near != nil {
+		lines = append(lines, fmt.Sprintf("📏 NEAR 距离：%s 与 %s 之间最多相隔 %d 个词", near.left, near.right, near.distance))
+		var row []tgbotapi.InlineKeyboardButton
+		for _, distance := range NearDistanceOptions {
+			label := strconv.Itoa(distance)
+			if distance == near.distance {
+				label = "✅ " + label
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("kw_near_%d_%s", distance, hashID)))
+		}
+		rows = append(rows, row)
+	}
+
+	lines = append(lines, "🎯 生效范围："+describeKeywordScope(scopes[keyword]))
+	if stats, err := getKeywordStats(userID, []string{keyword}); err == nil {
+		lines = append(lines, "📊 近7天 / 近30天："+describeKeywordHits(userID, stats[0]))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎯 设置生效范围", "kw_scope_"+hashID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回关键词详情", "kw_detail_list"),
+		),
+	)
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, strings.Join(lines, "\n"), &keyboard)
+}
+
+// handleKeywordModifierCallback 处理修饰符按钮
+// value 格式为 "w_<关键词ID>"、"c_<关键词ID>"（切换修饰符）或 "<距离>_<关键词ID>"（设置 NEAR 距离）
+func handleKeywordModifierCallback(userID int64, messageID int, value string) {
+	parts := strings.SplitN(value, "_", 2)
+	if len(parts) != 2 {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+
+	hashID := parts[1]
+	keyword, err := findKeywordByHashID(userID, hashID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 关键词不存在")
+		return
+	}
+
+	_, body := splitKeywordPrefix(keyword)
+	mods, _ := parseKeywordModifiers(body)
+
+	var updated string
+	switch parts[0] {
+	case "w":
+		mods.wholeWord = !mods.wholeWord
+		updated = withKeywordModifiers(keyword, mods)
+	case "c":
+		mods.caseSensitive = !mods.caseSensitive
+		updated = withKeywordModifiers(keyword, mods)
+	default:
+		distance, convErr := strconv.Atoi(parts[0])
+		if convErr != nil || distance < 0 || distance > MaxNearDistance {
+			messageSender.SendError(userID, messageID, "❌ 参数错误")
+			return
+		}
+		updated = withNearDistance(keyword, distance)
+	}
+
+	if err := replaceKeywordForUser(userID, keyword, updated); err != nil {
+		logMessage("error", fmt.Sprintf("更新关键词失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "更新关键词失败，可能已存在相同的关键词")
+		return
+	}
+	logMessage("info", fmt.Sprintf("用户修改关键词: %s -> %s", keyword, updated), userID)
+	showKeywordDetail(userID, messageID, keywordHashID(updated))
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 关键词表达式：支持 AND/OR/NOT、括号、引号短语以及字段前缀
+// 例如：expr:title:(rust OR go) AND NOT body:招聘
+// 相邻的词之间默认按 AND 处理；只有 expr: 前缀的关键词按表达式解析，其余关键词仍按原有规则匹配
+
+// ExprKeywordPrefix 关键词表达式前缀
+const ExprKeywordPrefix = "expr:"
+
+// 表达式支持的字段，空字段表示匹配标题和内容
+const (
+	ExprFieldTitle    = "title"
+	ExprFieldBody     = "body"
+	ExprFieldAuthor   = "author"
+	ExprFieldCategory = "category"
+	ExprFieldLink     = "link"
+)
+
+var exprFields = map[string]bool{
+	ExprFieldTitle:    true,
+	ExprFieldBody:     true,
+	ExprFieldAuthor:   true,
+	ExprFieldCategory: true,
+	ExprFieldLink:     true,
+}
+
+// exprTokenKind 词法单元类型
+type exprTokenKind int
+
+const (
+	exprTokenTerm exprTokenKind = iota
+	exprTokenField
+	exprTokenAnd
+	exprTokenOr
+	exprTokenNot
+	exprTokenLParen
+	exprTokenRParen
+)
+
+// exprToken 表达式词法单元
+type exprToken struct {
+	kind  exprTokenKind
+	text  string // 词或短语内容
+	field string // 字段前缀
+	pos   int    // 在表达式中的位置（按字符计），用于错误提示
+}
+
+// exprDocument 参与表达式匹配的消息内容，均已转为小写
+type exprDocument struct {
+	fields map[string]string
+}
+
+// KeywordExpr 解析后的关键词表达式
+type KeywordExpr interface {
+	match(doc *exprDocument) bool
+}
+
+type exprAnd struct{ left, right KeywordExpr }
+type exprOr struct{ left, right KeywordExpr }
+type exprNot struct{ inner KeywordExpr }
+
+// exprTerm 单个匹配词，带通配符时按普通通配符关键词的规则匹配
+type exprTerm struct {
+	field    string
+	text     string
+	wildcard *compiledKeyword
+}
+
+func (e *exprAnd) match(doc *exprDocument) bool { return e.left.match(doc) && e.right.match(doc) }
+func (e *exprOr) match(doc *exprDocument) bool  { return e.left.match(doc) || e.right.match(doc) }
+func (e *exprNot) match(doc *exprDocument) bool { return !e.inner.match(doc) }
+
+func (e *exprTerm) match(doc *exprDocument) bool {
+	content := doc.fields[e.field]
+	if e.wildcard != nil {
+		return e.wildcard.matchWildcard(content)
+	}
+	return strings.Contains(content, e.text)
+}
+
+// isKeywordExpression 判断关键词是否为 expr: 前缀的表达式，可带 ! 和 - 前缀
+func isKeywordExpression(keyword string) bool {
+	body := strings.TrimPrefix(strings.TrimPrefix(keyword, UrgentKeywordPrefix), "-")
+	return strings.HasPrefix(strings.ToLower(body), ExprKeywordPrefix)
+}
+
+// keywordExprText 返回表达式关键词本体（不含 ! 和 - 前缀）去掉 expr: 前缀后的内容
+func keywordExprText(body string) string {
+	return strings.TrimSpace(body[len(ExprKeywordPrefix):])
+}
+
+// newExprDocument 根据消息构造表达式匹配内容
+func newExprDocument(msg Message) *exprDocument {
+	title := strings.ToLower(msg.Title)
+	body := strings.ToLower(msg.Description)
+	return &exprDocument{fields: map[string]string{
+		"":                title + " " + body,
+		ExprFieldTitle:    title,
+		ExprFieldBody:     body,
+		ExprFieldAuthor:   strings.ToLower(msg.Author),
+		ExprFieldCategory: strings.ToLower(strings.Join(msg.Categories, "\n")),
+		ExprFieldLink:     strings.ToLower(msg.Link),
+	}}
+}
+
+// tokenizeKeywordExpr 将表达式拆分为词法单元
+func tokenizeKeywordExpr(input string) ([]exprToken, error) {
+	runes := []rune(input)
+	var tokens []exprToken
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			tokens = append(tokens, exprToken{kind: exprTokenLParen, pos: i})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, exprToken{kind: exprTokenRParen, pos: i})
+			i++
+
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("第 %d 个字符处的引号没有闭合", i+1)
+			}
+			phrase := string(runes[i+1 : end])
+			if strings.TrimSpace(phrase) == "" {
+				return nil, fmt.Errorf("第 %d 个字符处的引号内容为空", i+1)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenTerm, text: phrase, pos: i})
+			i = end + 1
+
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+			tokens = append(tokens, classifyExprWord(word, start, i < len(runes) && (runes[i] == '(' || runes[i] == '"')))
+		}
+	}
+	return tokens, nil
+}
+
+// classifyExprWord 识别运算符、字段前缀和普通词
+// groupFollows 表示该词后面紧跟括号或引号
+func classifyExprWord(word string, pos int, groupFollows bool) exprToken {
+	switch word {
+	case "AND":
+		return exprToken{kind: exprTokenAnd, pos: pos}
+	case "OR":
+		return exprToken{kind: exprTokenOr, pos: pos}
+	case "NOT":
+		return exprToken{kind: exprTokenNot, pos: pos}
+	}
+
+	if idx := strings.Index(word, ":"); idx > 0 {
+		field := strings.ToLower(word[:idx])
+		if exprFields[field] {
+			rest := word[idx+1:]
+			if rest == "" && groupFollows {
+				return exprToken{kind: exprTokenField, field: field, pos: pos}
+			}
+			if rest != "" {
+				return exprToken{kind: exprTokenTerm, field: field, text: rest, pos: pos}
+			}
+		}
+	}
+	return exprToken{kind: exprTokenTerm, text: word, pos: pos}
+}
+
+// exprParser 递归下降解析器
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// ParseKeywordExpr 解析关键词表达式，语法错误时返回可读的错误信息
+func ParseKeywordExpr(input string) (KeywordExpr, error) {
+	tokens, err := tokenizeKeywordExpr(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("表达式为空")
+	}
+
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		if tok.kind == exprTokenRParen {
+			return nil, fmt.Errorf("第 %d 个字符处有多余的右括号", tok.pos+1)
+		}
+		return nil, fmt.Errorf("第 %d 个字符处存在无法解析的内容", tok.pos+1)
+	}
+	return expr, nil
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// parseOr or := and ( OR and )*
+func (p *exprParser) parseOr(field string) (KeywordExpr, error) {
+	left, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok != nil && tok.kind == exprTokenOr; tok = p.peek() {
+		p.pos++
+		right, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		left = &exprOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd and := not ( [AND] not )*，相邻的词默认按 AND 连接
+func (p *exprParser) parseAnd(field string) (KeywordExpr, error) {
+	left, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok != nil; tok = p.peek() {
+		if tok.kind == exprTokenAnd {
+			p.pos++
+		} else if tok.kind == exprTokenOr || tok.kind == exprTokenRParen {
+			break
+		}
+		right, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+		left = &exprAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot not := NOT not | primary
+func (p *exprParser) parseNot(field string) (KeywordExpr, error) {
+	if tok := p.peek(); tok != nil && tok.kind == exprTokenNot {
+		p.pos++
+		inner, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+		return &exprNot{inner: inner}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+// parsePrimary primary := '(' or ')' | field: primary | term
+func (p *exprParser) parsePrimary(field string) (KeywordExpr, error) {
+	tok := p.peek()
+	if tok == nil {
+		if len(p.tokens) == 0 {
+			return nil, fmt.Errorf("表达式为空")
+		}
+		return nil, fmt.Errorf("表达式在结尾处不完整")
+	}
+
+	switch tok.kind {
+	case exprTokenLParen:
+		p.pos++
+		inner, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next == nil || next.kind != exprTokenRParen {
+			return nil, fmt.Errorf("第 %d 个字符处的左括号缺少对应的右括号", tok.pos+1)
+		}
+		p.pos++
+		return inner, nil
+
+	case exprTokenField:
+		p.pos++
+		return p.parsePrimary(tok.field)
+
+	case exprTokenTerm:
+		p.pos++
+		termField := field
+		if tok.field != "" {
+			termField = tok.field
+		}
+		return newExprTerm(termField, tok.text), nil
+
+	case exprTokenRParen:
+		return nil, fmt.Errorf("第 %d 个字符处的右括号前缺少内容", tok.pos+1)
+
+	default:
+		names := map[exprTokenKind]string{exprTokenAnd: "AND", exprTokenOr: "OR", exprTokenNot: "NOT"}
+		return nil, fmt.Errorf("第 %d 个字符处的 %s 前后缺少关键词", tok.pos+1, names[tok.kind])
+	}
+}
+
+// newExprTerm 创建匹配词，通配符 * 的处理与普通关键词一致
+func newExprTerm(field, text string) KeywordExpr {
+	lower := strings.ToLower(text)
+	term := &exprTerm{field: field, text: lower}
+	if strings.Contains(lower, "*") {
+		term.wildcard = compileWildcardKeyword(lower)
+	}
+	return term
+}
+
+// validateKeywordSyntax 校验关键词中的表达式、正则、修饰符和拼音关键词，返回每个错误关键词的提示
+func validateKeywordSyntax(keywords []string) []string {
+	var problems []string
+	for _, kw := range keywords {
+		body := strings.TrimPrefix(strings.TrimPrefix(kw, UrgentKeywordPrefix), "-")
+		var err error
+		switch {
+		case isPinyinKeyword(body):
+			_, err = pinyinKeywordText(body)
+		case isRegexKeyword(body):
+			_, err = compileRegexKeyword(body)
+		case hasKeywordModifiers(body) || isNearKeyword(body):
+			_, err = compileModifiedKeyword(body)
+		case isKeywordExpression(body):
+			_, err = ParseKeywordExpr(keywordExprText(body))
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("● %s\n   ⚠️ %v", kw, err))
+		}
+	}
+	return problems
+}
+
+// isWholeKeyword 判断关键词是否需要整体保留，不按空格或逗号拆分
+func isWholeKeyword(keyword string) bool {
+	body := strings.TrimPrefix(strings.TrimPrefix(keyword, UrgentKeywordPrefix), "-")
+	return isRegexKeyword(body) || isNearKeyword(body) || isKeywordExpression(keyword)
+}
+
+// splitKeywordInput 拆分用户输入的关键词
+// 每行如果是表达式、正则或 NEAR 关键词则整行作为一个关键词，否则按空白拆分
+func splitKeywordInput(text string) []string {
+	var keywords []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if isWholeKeyword(line) {
+			keywords = append(keywords, line)
+			continue
+		}
+		keywords = append(keywords, strings.Fields(line)...)
+	}
+	return keywords
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeywordExprMatch(t *testing.T) {
+	rustJob := Message{Title: "Rust 开发招聘", Description: "远程，招聘 Rust 工程师"}
+	rustRelease := Message{
+		Title:       "Rust 1.80 released",
+		Description: "async closures and machine learning crates",
+		Author:      "Alice",
+		Categories:  []string{"Security", "Release"},
+		Link:        "https://github.com/rust-lang/rust",
+	}
+	goRelease := Message{Title: "Go 1.23 发布", Description: "iterators"}
+
+	tests := []struct {
+		expr string
+		msg  Message
+		want bool
+	}{
+		{`title:(rust OR go) AND NOT body:招聘`, rustRelease, true},
+		{`title:(rust OR go) AND NOT body:招聘`, goRelease, true},
+		{`title:(rust OR go) AND NOT body:招聘`, rustJob, false},
+		// 相邻的词默认按 AND 连接
+		{`rust async`, rustRelease, true},
+		{`rust iterators`, rustRelease, false},
+		{`rust OR iterators`, goRelease, true},
+		// OR 的优先级低于 AND
+		{`go released OR iterators`, goRelease, true},
+		{`(go OR rust) released`, goRelease, false},
+		{`NOT NOT rust`, rustRelease, true},
+		{`NOT rust`, goRelease, true},
+		// 引号短语和字段前缀
+		{`"machine learning"`, rustRelease, true},
+		{`"learning machine"`, rustRelease, false},
+		{`body:"machine learning"`, rustRelease, true},
+		{`title:"machine learning"`, rustRelease, false},
+		{`TITLE:rust`, rustRelease, true},
+		{`author:alice`, rustRelease, true},
+		{`category:security`, rustRelease, true},
+		{`category:(release AND security)`, rustRelease, true},
+		{`link:github.com`, rustRelease, true},
+		{`link:gitlab`, rustRelease, false},
+		// 字段只作用于紧随的单元
+		{`title:rust closures`, rustRelease, true},
+		{`title:closures`, rustRelease, false},
+		// 通配符
+		{`title:rust*released`, rustRelease, true},
+		{`title:released*rust`, rustRelease, false},
+		// 未知字段按普通词处理
+		{`foo:bar OR rust`, rustRelease, true},
+	}
+	for _, tt := range tests {
+		expr, err := ParseKeywordExpr(tt.expr)
+		if err != nil {
+			t.Errorf("ParseKeywordExpr(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got := expr.match(newExprDocument(tt.msg)); got != tt.want {
+			t.Errorf("%q on %q = %v, want %v", tt.expr, tt.msg.Title, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeywordExprErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{``, "表达式为空"},
+		{`   `, "表达式为空"},
+		{`"rust`, "第 1 个字符处的引号没有闭合"},
+		{`rust ""`, "第 6 个字符处的引号内容为空"},
+		{`(rust`, "第 1 个字符处的左括号缺少对应的右括号"},
+		{`rust)`, "第 5 个字符处有多余的右括号"},
+		{`()`, "第 2 个字符处的右括号前缺少内容"},
+		{`rust AND`, "表达式在结尾处不完整"},
+		{`NOT`, "表达式在结尾处不完整"},
+		{`OR rust`, "第 1 个字符处的 OR 前后缺少关键词"},
+		{`rust AND OR go`, "第 10 个字符处的 OR 前后缺少关键词"},
+		{`title:`, ""},
+	}
+	for _, tt := range tests {
+		_, err := ParseKeywordExpr(tt.expr)
+		if tt.wantErr == "" {
+			// 后面没有内容的字段前缀按普通词处理
+			if err != nil {
+				t.Errorf("ParseKeywordExpr(%q) error: %v", tt.expr, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseKeywordExpr(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIsKeywordExpression(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    bool
+	}{
+		{"rust", false},
+		{"rust go", false},
+		{"rust*go", false},
+		// 没有 expr: 前缀时，含运算符、字段或引号的关键词仍是普通关键词
+		{"rust AND go", false},
+		{"title:rust", false},
+		{`"machine learning"`, false},
+		{"https://example.com", false},
+		{"/rust OR go/i", false},
+		{"expr:rust AND go", true},
+		{"EXPR:title:rust", true},
+		{"-expr:body:招聘", true},
+		{"!expr:title:rust", true},
+		{"!-expr:title:rust", true},
+	}
+	for _, tt := range tests {
+		if got := isKeywordExpression(tt.keyword); got != tt.want {
+			t.Errorf("isKeywordExpression(%q) = %v, want %v", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKeywordInput(t *testing.T) {
+	input := "rust go\n  expr:title:(rust OR go) AND NOT body:招聘  \ntitle:rust OR go\n\n/rust\\s+\\d+/i\nasync NEAR/3 await\n显卡 手机"
+	want := []string{
+		"rust", "go",
+		"expr:title:(rust OR go) AND NOT body:招聘",
+		"title:rust", "OR", "go",
+		`/rust\s+\d+/i`,
+		"async NEAR/3 await",
+		"显卡", "手机",
+	}
+	if got := splitKeywordInput(input); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitKeywordInput = %q, want %q", got, want)
+	}
+}
+
+func TestLegacyKeywordMatchesLiterally(t *testing.T) {
+	// 没有 expr: 前缀的关键词即使含引号、AND/OR/NOT 或字段前缀，也按普通关键词匹配
+	keywords := []string{`27"显示器`, `AND`, `rust AND go`, `title:rust`, `"支架"`}
+	msg := Message{Title: `Dell 27"显示器 AND 支架特价`, Description: "rust AND go, title:rust"}
+	want := []string{`27"显示器`, `AND`, `rust AND go`, `title:rust`}
+	if got := matchesKeywords(msg, keywords, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("matchesKeywords = %q, want %q", got, want)
+	}
+	engine := BuildKeywordEngine(map[int64][]string{1: keywords})
+	if got := engine.NewMessageMatcher(msg).Match(keywords, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("engine Match = %q, want %q", got, want)
+	}
+}
+
+func TestExprWildcardMatchesLikeLegacy(t *testing.T) {
+	// 表达式中的通配符与普通通配符关键词一致：. 不跨行，未命中时退回包含匹配
+	tests := []struct {
+		msg  Message
+		want bool
+	}{
+		{Message{Title: "rust 1.80 released"}, true},
+		{Message{Title: "rust 1.80", Description: "line\nreleased"}, false},
+		{Message{Title: "rust*released"}, true},
+	}
+	for _, tt := range tests {
+		legacy := len(matchesKeywords(tt.msg, []string{"rust*released"}, false)) > 0
+		expr := len(matchesKeywords(tt.msg, []string{"expr:rust*released"}, false)) > 0
+		if legacy != tt.want || expr != tt.want {
+			t.Errorf("%+v: legacy = %v, expr = %v, want %v", tt.msg, legacy, expr, tt.want)
+		}
+	}
+}
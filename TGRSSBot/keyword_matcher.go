@@ -0,0 +1,518 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 预编译关键词匹配引擎
+// 所有用户的关键词在变化时编译一次：普通关键词合并为一个 Aho-Corasick 自动机，
+// 每条消息只扫描一遍内容；通配符、正则和表达式预先编译并在用户间共享，
+// 同一条消息中相同关键词的结果也只计算一次。
+// 开启中文归一化的用户使用另一套按归一化规则编译的关键词，匹配归一化后的内容
+
+// keywordKind 关键词类型
+type keywordKind int
+
+const (
+	keywordLiteral keywordKind = iota
+	keywordWildcard
+	keywordRegex
+	keywordExpression
+	keywordPinyin
+	keywordModified
+	keywordInvalid
+)
+
+// compiledKeyword 编译后的单个关键词（已去除 ! 和 - 前缀）
+type compiledKeyword struct {
+	kind      keywordKind
+	literalID int            // 普通关键词在自动机中的编号
+	wildcard  *regexp.Regexp // 通配符关键词对应的正则，编译失败时为空
+	parts     []string       // 通配符各段均为普通文本时，按顺序查找各段代替正则
+	lower     string         // 小写后的关键词，拼音关键词为拼音串
+	regex     *regexp.Regexp
+	expr      KeywordExpr
+	modified  *modifiedKeyword
+}
+
+// keywordSet 一套编译好的关键词，key 为原始关键词本体
+type keywordSet struct {
+	patterns  map[string]*compiledKeyword
+	automaton *ahoCorasick
+	literals  int
+}
+
+// KeywordEngine 关键词匹配引擎，构建后只读，可并发使用
+type KeywordEngine struct {
+	signature uint64
+	plain     *keywordSet // 原样匹配
+	folded    *keywordSet // 中文归一化后匹配
+}
+
+var (
+	keywordEngineMutex sync.Mutex
+	keywordEngineCache *KeywordEngine
+)
+
+// keywordBody 去除紧急和屏蔽前缀，返回关键词本体及是否为屏蔽词
+func keywordBody(keyword string) (string, bool) {
+	keyword = strings.TrimPrefix(keyword, UrgentKeywordPrefix)
+	if strings.HasPrefix(keyword, "-") {
+		return strings.TrimPrefix(keyword, "-"), true
+	}
+	return keyword, false
+}
+
+// keywordSignature 计算全部关键词的签名，用于判断关键词是否变化
+func keywordSignature(userKeywords map[int64][]string) uint64 {
+	var all []string
+	for _, keywords := range userKeywords {
+		all = append(all, keywords...)
+	}
+	sort.Strings(all)
+
+	h := fnv.New64a()
+	for _, kw := range all {
+		h.Write([]byte(kw))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// getKeywordEngine 获取匹配引擎，关键词未变化时复用已编译的引擎
+func getKeywordEngine(userKeywords map[int64][]string) *KeywordEngine {
+	signature := keywordSignature(userKeywords)
+
+	keywordEngineMutex.Lock()
+	defer keywordEngineMutex.Unlock()
+
+	if keywordEngineCache != nil && keywordEngineCache.signature == signature {
+		return keywordEngineCache
+	}
+	engine := BuildKeywordEngine(userKeywords)
+	engine.signature = signature
+	keywordEngineCache = engine
+	logMessage("debug", fmt.Sprintf("关键词引擎已重建：%d 个关键词，其中普通关键词 %d 个", len(engine.plain.patterns), engine.plain.literals))
+	return engine
+}
+
+// BuildKeywordEngine 编译所有用户的关键词
+func BuildKeywordEngine(userKeywords map[int64][]string) *KeywordEngine {
+	seen := make(map[string]bool)
+	var bodies []string
+	for _, keywords := range userKeywords {
+		for _, keyword := range keywords {
+			keyword = strings.TrimSpace(keyword)
+			if keyword == "" {
+				continue
+			}
+			body, _ := keywordBody(keyword)
+			if !seen[body] {
+				seen[body] = true
+				bodies = append(bodies, body)
+			}
+		}
+	}
+
+	return &KeywordEngine{
+		plain:  buildKeywordSet(bodies, false),
+		folded: buildKeywordSet(bodies, true),
+	}
+}
+
+// buildKeywordSet 编译一套关键词，fold 为真时关键词先做中文归一化
+// 小写或归一化后相同的普通关键词（如 Rust 和 rust、显卡和顯卡）共用自动机中的同一个模式
+func buildKeywordSet(bodies []string, fold bool) *keywordSet {
+	set := &keywordSet{patterns: make(map[string]*compiledKeyword, len(bodies))}
+	var literals []string
+	literalIDs := make(map[string]int)
+	for _, body := range bodies {
+		compiled := compileKeyword(body, fold)
+		if compiled.kind == keywordLiteral {
+			id, ok := literalIDs[compiled.lower]
+			if !ok {
+				id = len(literals)
+				literalIDs[compiled.lower] = id
+				literals = append(literals, compiled.lower)
+			}
+			compiled.literalID = id
+		}
+		set.patterns[body] = compiled
+	}
+	set.literals = len(literals)
+	set.automaton = newAhoCorasick(literals)
+	return set
+}
+
+// compileKeyword 按 matchesKeywords 的规则编译单个关键词
+func compileKeyword(body string, fold bool) *compiledKeyword {
+	if isPinyinKeyword(body) {
+		text, err := pinyinKeywordText(body)
+		if err != nil {
+			return &compiledKeyword{kind: keywordInvalid}
+		}
+		return &compiledKeyword{kind: keywordPinyin, lower: text}
+	}
+	if fold {
+		body = foldChineseText(body)
+	}
+
+	if isRegexKeyword(body) {
+		re, err := compileRegexKeyword(body)
+		if err != nil {
+			return &compiledKeyword{kind: keywordInvalid}
+		}
+		return &compiledKeyword{kind: keywordRegex, regex: re}
+	}
+
+	if hasKeywordModifiers(body) || isNearKeyword(body) {
+		modified, err := compileModifiedKeyword(body)
+		if err != nil {
+			return &compiledKeyword{kind: keywordInvalid}
+		}
+		return &compiledKeyword{kind: keywordModified, modified: modified}
+	}
+
+	if isKeywordExpression(body) {
+		expr, err := ParseKeywordExpr(keywordExprText(body))
+		if err != nil {
+			return &compiledKeyword{kind: keywordInvalid}
+		}
+		return &compiledKeyword{kind: keywordExpression, expr: expr}
+	}
+
+	lower := strings.ToLower(body)
+	if strings.Contains(lower, "*") {
+		return compileWildcardKeyword(lower)
+	}
+	return &compiledKeyword{kind: keywordLiteral, lower: lower}
+}
+
+// compileWildcardKeyword 编译小写的通配符关键词，表达式中的通配符词也使用同一规则
+func compileWildcardKeyword(lower string) *compiledKeyword {
+	// 与原有规则一致：通配符正则未命中时退回普通包含匹配
+	compiled := &compiledKeyword{kind: keywordWildcard, lower: lower}
+	parts := strings.Split(lower, "*")
+	literal := true
+	for _, part := range parts {
+		if regexp.QuoteMeta(part) != part {
+			literal = false
+			break
+		}
+	}
+	if literal {
+		compiled.parts = parts
+		return compiled
+	}
+	pattern := "^.*" + strings.ReplaceAll(lower, "*", ".*") + ".*$"
+	if re, err := regexp.Compile(pattern); err == nil {
+		compiled.wildcard = re
+	}
+	return compiled
+}
+
+// matchWildcard 按原有通配符规则匹配小写内容
+func (c *compiledKeyword) matchWildcard(content string) bool {
+	var result bool
+	if c.parts != nil {
+		result = matchWildcardParts(content, c.parts)
+	} else {
+		result = c.wildcard != nil && c.wildcard.MatchString(content)
+	}
+	return result || strings.Contains(content, c.lower)
+}
+
+// matchWildcardParts 等价于正则 ^.*a.*b.*$：. 不匹配换行，因此内容不能含换行，且各段按顺序出现
+func matchWildcardParts(content string, parts []string) bool {
+	if strings.Contains(content, "\n") {
+		return false
+	}
+	for _, part := range parts {
+		idx := strings.Index(content, part)
+		if idx < 0 {
+			return false
+		}
+		content = content[idx+len(part):]
+	}
+	return true
+}
+
+// matchState 一条消息在一套关键词下的匹配状态
+type matchState struct {
+	set      *keywordSet
+	msg      Message
+	raw      string // 标题和正文，供正则关键词使用
+	content  string // 小写后的标题和正文
+	literals []bool // 自动机命中的普通关键词
+	exprDoc  *exprDocument
+	pinyin   *string
+	// 修饰符和 NEAR 关键词共用的分词索引
+	rawIndex   *termIndex
+	lowerIndex *termIndex
+	results    map[*compiledKeyword]bool
+}
+
+// MessageMatcher 单条消息的匹配上下文，在同一条消息的所有用户间复用
+type MessageMatcher struct {
+	engine *KeywordEngine
+	msg    Message
+	plain  *matchState
+	folded *matchState
+	mutex  sync.Mutex
+}
+
+// NewMessageMatcher 为一条消息创建匹配上下文，各套关键词在首次使用时扫描一次内容
+func (e *KeywordEngine) NewMessageMatcher(msg Message) *MessageMatcher {
+	return &MessageMatcher{engine: e, msg: msg}
+}
+
+// newMatchState 扫描内容，记录普通关键词的命中情况
+func newMatchState(set *keywordSet, msg Message) *matchState {
+	raw := msg.Title + " " + msg.Description
+	content := strings.ToLower(raw)
+	return &matchState{
+		set:      set,
+		msg:      msg,
+		raw:      raw,
+		content:  content,
+		literals: set.automaton.search(content),
+		results:  make(map[*compiledKeyword]bool),
+	}
+}
+
+// state 获取对应的匹配状态，不存在时创建
+func (m *MessageMatcher) state(fold bool) *matchState {
+	if fold {
+		if m.folded == nil {
+			m.folded = newMatchState(m.engine.folded, foldMessage(m.msg))
+		}
+		return m.folded
+	}
+	if m.plain == nil {
+		m.plain = newMatchState(m.engine.plain, m.msg)
+	}
+	return m.plain
+}
+
+// matches 判断单个已编译关键词是否命中，非普通关键词的结果会被缓存
+func (s *matchState) matches(compiled *compiledKeyword) bool {
+	switch compiled.kind {
+	case keywordLiteral:
+		return s.literals[compiled.literalID]
+	case keywordInvalid:
+		return false
+	}
+
+	if result, ok := s.results[compiled]; ok {
+		return result
+	}
+
+	var result bool
+	switch compiled.kind {
+	case keywordWildcard:
+		result = compiled.matchWildcard(s.content)
+	case keywordRegex:
+		result = compiled.regex.MatchString(s.raw)
+	case keywordExpression:
+		if s.exprDoc == nil {
+			s.exprDoc = newExprDocument(s.msg)
+		}
+		result = compiled.expr.match(s.exprDoc)
+	case keywordModified:
+		if s.rawIndex == nil {
+			s.rawIndex, s.lowerIndex = newTermIndex(s.raw), newTermIndex(s.content)
+		}
+		result = compiled.modified.matchIndex(s.rawIndex, s.lowerIndex)
+	case keywordPinyin:
+		if s.pinyin == nil {
+			pinyin := toPinyinText(s.raw)
+			s.pinyin = &pinyin
+		}
+		result = strings.Contains(*s.pinyin, compiled.lower)
+	}
+	s.results[compiled] = result
+	return result
+}
+
+// KeywordHit 单个关键词的命中结果
+type KeywordHit struct {
+	Keyword string // 用户保存的关键词原文
+	Body    string // 去除紧急和屏蔽前缀后的关键词
+	Blocked bool   // 是否为屏蔽词
+}
+
+// Match 返回命中的关键词列表，规则与 matchesKeywords 相同：命中任何屏蔽词时返回空
+// fold 为真时使用中文归一化匹配
+func (m *MessageMatcher) Match(keywords []string, fold bool) []string {
+	return matchedKeywordsFromHits(m.MatchHits(keywords, fold), m.msg.Title)
+}
+
+// MatchHits 返回所有命中的关键词，包括命中的屏蔽词
+func (m *MessageMatcher) MatchHits(keywords []string, fold bool) []KeywordHit {
+	if len(keywords) == 0 {
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	state := m.state(fold)
+
+	var hits []KeywordHit
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			continue
+		}
+		body, isBlockKeyword := keywordBody(keyword)
+
+		compiled, ok := state.set.patterns[body]
+		if !ok {
+			// 引擎构建后新增的关键词，临时编译
+			compiled = compileKeyword(body, fold)
+			if compiled.kind == keywordLiteral {
+				compiled.kind = keywordWildcard
+			}
+		}
+		if state.matches(compiled) {
+			hits = append(hits, KeywordHit{Keyword: keyword, Body: body, Blocked: isBlockKeyword})
+		}
+	}
+	return hits
+}
+
+// matchedKeywordsFromHits 返回用于推送的关键词列表，命中任何屏蔽词时返回空
+func matchedKeywordsFromHits(hits []KeywordHit, title string) []string {
+	var matchedKeywords []string
+	var blockedKeywords []string
+	for _, hit := range hits {
+		if hit.Blocked {
+			blockedKeywords = append(blockedKeywords, hit.Body)
+		} else {
+			matchedKeywords = append(matchedKeywords, hit.Body)
+		}
+	}
+
+	if len(blockedKeywords) > 0 {
+		logMessage("debug", fmt.Sprintf("消息被屏蔽词[%s]过滤: %s",
+			strings.Join(blockedKeywords, ", "), title))
+		return nil
+	}
+	return matchedKeywords
+}
+
+// ahoCorasick 多模式字符串匹配自动机，按字节匹配（UTF-8 自同步，不会出现错位命中）
+type ahoCorasick struct {
+	next     []map[byte]int32
+	fail     []int32
+	output   []int32 // 节点对应的模式编号，-1 表示无
+	dictLink []int32 // 沿失败链最近的有输出的节点，-1 表示无
+	empty    []int   // 空模式，任何内容都命中
+	patterns int
+}
+
+// newAhoCorasick 构建自动机
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{
+		next:     []map[byte]int32{{}},
+		fail:     []int32{0},
+		output:   []int32{-1},
+		dictLink: []int32{-1},
+		patterns: len(patterns),
+	}
+
+	for id, pattern := range patterns {
+		if pattern == "" {
+			ac.empty = append(ac.empty, id)
+			continue
+		}
+		node := int32(0)
+		for i := 0; i < len(pattern); i++ {
+			child, ok := ac.next[node][pattern[i]]
+			if !ok {
+				child = int32(len(ac.next))
+				ac.next = append(ac.next, map[byte]int32{})
+				ac.fail = append(ac.fail, 0)
+				ac.output = append(ac.output, -1)
+				ac.dictLink = append(ac.dictLink, -1)
+				ac.next[node][pattern[i]] = child
+			}
+			node = child
+		}
+		ac.output[node] = int32(id)
+	}
+
+	// 广度优先计算失败链接
+	queue := make([]int32, 0, len(ac.next))
+	for _, child := range ac.next[0] {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.next[node] {
+			f := ac.fail[node]
+			for f != 0 {
+				if _, ok := ac.next[f][b]; ok {
+					break
+				}
+				f = ac.fail[f]
+			}
+			if target, ok := ac.next[f][b]; ok && target != child {
+				ac.fail[child] = target
+			}
+			if fc := ac.fail[child]; ac.output[fc] >= 0 {
+				ac.dictLink[child] = fc
+			} else {
+				ac.dictLink[child] = ac.dictLink[fc]
+			}
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// search 扫描内容，返回每个模式是否出现
+func (ac *ahoCorasick) search(content string) []bool {
+	found := make([]bool, ac.patterns)
+	for _, id := range ac.empty {
+		found[id] = true
+	}
+	if len(ac.next) == 1 {
+		return found
+	}
+
+	node := int32(0)
+	for i := 0; i < len(content); i++ {
+		b := content[i]
+		for {
+			if child, ok := ac.next[node][b]; ok {
+				node = child
+				break
+			}
+			if node == 0 {
+				break
+			}
+			node = ac.fail[node]
+		}
+
+		// 沿输出链记录命中；已记录的模式之后的链也已记录过，可提前结束
+		out := node
+		if ac.output[out] < 0 {
+			out = ac.dictLink[out]
+		}
+		for out > 0 {
+			id := ac.output[out]
+			if found[id] {
+				break
+			}
+			found[id] = true
+			out = ac.dictLink[out]
+		}
+	}
+	return found
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 预编译引擎与逐条匹配的 matchesKeywords 的一致性测试和基准测试：
+//   go test -bench Match -run Parity
+
+// benchmarkScenario 测试数据规模
+type benchmarkScenario struct {
+	name            string
+	users           int
+	keywordsPerUser int
+	messages        int
+}
+
+var benchmarkScenarios = []benchmarkScenario{
+	{name: "small", users: 10, keywordsPerUser: 20, messages: 50},
+	{name: "medium", users: 200, keywordsPerUser: 50, messages: 100},
+	{name: "large", users: 500, keywordsPerUser: 100, messages: 200},
+}
+
+var benchmarkWords = []string{
+	"rust", "golang", "python", "kubernetes", "docker", "linux", "安全", "漏洞",
+	"发布", "更新", "优惠", "折扣", "招聘", "开源", "数据库", "人工智能", "模型",
+	"显卡", "手机", "笔记本", "服务器", "云计算", "区块链", "前端", "后端",
+	"deal", "release", "security", "advisory", "benchmark", "compiler", "kernel",
+	"Rust", "RUST", "顯卡", "數據庫",
+}
+
+// benchmarkPinyin 拼音关键词样本，对应 benchmarkWords 中的部分中文词
+var benchmarkPinyin = []string{"anquan", "loudong", "xianka", "shouji", "fuwuqi", "kaiyuan"}
+
+// benchmarkTraditional 繁体和全角写法，部分消息使用以覆盖中文归一化
+var benchmarkTraditional = strings.NewReplacer("显卡", "顯卡", "数据库", "數據庫", "发布", "發佈", "手机", "手機", "rust", "ＲＵＳＴ")
+
+// generateBenchmarkData 生成固定随机种子的用户关键词和消息
+func generateBenchmarkData(scenario benchmarkScenario) (map[int64][]string, []Message) {
+	rng := rand.New(rand.NewSource(42))
+	word := func() string { return benchmarkWords[rng.Intn(len(benchmarkWords))] }
+
+	userKeywords := make(map[int64][]string, scenario.users)
+	for u := 0; u < scenario.users; u++ {
+		keywords := make([]string, 0, scenario.keywordsPerUser)
+		for k := 0; k < scenario.keywordsPerUser; k++ {
+			var kw string
+			switch n := rng.Intn(20); {
+			case n < 11:
+				kw = fmt.Sprintf("%s%d", word(), rng.Intn(50))
+			case n < 12 && k%2 == 0:
+				kw = fmt.Sprintf("[w]%s%d", word(), rng.Intn(200))
+			case n < 12:
+				kw = fmt.Sprintf("%s NEAR/%d %s", word(), rng.Intn(10), word())
+			case n < 14:
+				kw = word()
+			case n < 16:
+				kw = word() + "*" + word()
+			case n < 17:
+				kw = "-" + word() + fmt.Sprint(rng.Intn(50))
+			case n < 18:
+				kw = fmt.Sprintf("/%s\\s*\\d+/i", word())
+			case n < 19:
+				kw = fmt.Sprintf("expr:title:(%s OR %s) AND NOT body:%s", word(), word(), word())
+			case u%2 == 0:
+				kw = PinyinKeywordPrefix + benchmarkPinyin[rng.Intn(len(benchmarkPinyin))]
+			default:
+				kw = UrgentKeywordPrefix + word()
+			}
+			keywords = append(keywords, kw)
+		}
+		userKeywords[int64(u+1)] = keywords
+	}
+
+	messages := make([]Message, scenario.messages)
+	for i := range messages {
+		var title, body []string
+		for j := 0; j < 8; j++ {
+			title = append(title, word())
+		}
+		for j := 0; j < 120; j++ {
+			body = append(body, fmt.Sprintf("%s%d", word(), rng.Intn(200)))
+		}
+		// 部分消息正文带换行，覆盖通配符不跨行的规则
+		separator := " "
+		if i%3 == 0 {
+			separator = "\n"
+		}
+		messages[i] = Message{
+			Title:       strings.Join(title, " "),
+			Description: strings.Join(body, separator),
+			Link:        fmt.Sprintf("https://example.com/post/%d", i),
+		}
+		if i%4 == 1 {
+			messages[i].Title = benchmarkTraditional.Replace(messages[i].Title)
+			messages[i].Description = benchmarkTraditional.Replace(messages[i].Description)
+		}
+	}
+	return userKeywords, messages
+}
+
+// assertMatchParity 校验引擎与 matchesKeywords 对每个用户、每条消息的结果一致
+func assertMatchParity(t *testing.T, userKeywords map[int64][]string, messages []Message) {
+	t.Helper()
+	engine := BuildKeywordEngine(userKeywords)
+	for _, msg := range messages {
+		matcher := engine.NewMessageMatcher(msg)
+		for userID, keywords := range userKeywords {
+			for _, fold := range []bool{false, true} {
+				want := matchesKeywords(msg, keywords, fold)
+				got := matcher.Match(keywords, fold)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("user %d fold=%v title %q: Match = %q, matchesKeywords = %q",
+						userID, fold, msg.Title, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestMatchParity(t *testing.T) {
+	// 大规模数据逐条匹配耗时较长，只用于基准测试
+	for _, scenario := range benchmarkScenarios[:2] {
+		t.Run(scenario.name, func(t *testing.T) {
+			userKeywords, messages := generateBenchmarkData(scenario)
+			assertMatchParity(t, userKeywords, messages)
+		})
+	}
+}
+
+func TestMatchParityCaseAndFoldVariants(t *testing.T) {
+	// 小写或归一化后相同的普通关键词分属不同用户，每个用户都要命中
+	userKeywords := map[int64][]string{
+		1: {"Rust"},
+		2: {"rust"},
+		3: {"RUST", "-Rust"},
+		4: {"显卡"},
+		5: {"顯卡"},
+		6: {"ＲＴＸ"},
+		7: {"rtx", "!顯卡"},
+	}
+	messages := []Message{
+		{Title: "Rust 1.80 released"},
+		{Title: "新款显卡 RTX 5090 发布"},
+		{Title: "新款顯卡 ＲＴＸ 5090 發佈"},
+		{Title: "nothing here"},
+	}
+	assertMatchParity(t, userKeywords, messages)
+
+	engine := BuildKeywordEngine(userKeywords)
+	matcher := engine.NewMessageMatcher(messages[0])
+	for _, userID := range []int64{1, 2} {
+		if got := matcher.Match(userKeywords[userID], false); len(got) != 1 {
+			t.Errorf("user %d: Match = %q, want one hit", userID, got)
+		}
+	}
+	matcher = engine.NewMessageMatcher(messages[2])
+	for _, userID := range []int64{4, 5, 6, 7} {
+		if got := matcher.Match(userKeywords[userID], true); len(got) == 0 {
+			t.Errorf("user %d fold: Match = %q, want a hit", userID, got)
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	for _, scenario := range benchmarkScenarios {
+		userKeywords, messages := generateBenchmarkData(scenario)
+		engine := BuildKeywordEngine(userKeywords)
+
+		b.Run(scenario.name+"/legacy", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, msg := range messages {
+					for _, keywords := range userKeywords {
+						matchesKeywords(msg, keywords, false)
+					}
+				}
+			}
+		})
+		b.Run(scenario.name+"/engine", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, msg := range messages {
+					matcher := engine.NewMessageMatcher(msg)
+					for _, keywords := range userKeywords {
+						matcher.Match(keywords, false)
+					}
+				}
+			}
+		})
+		b.Run(scenario.name+"/build", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				BuildKeywordEngine(userKeywords)
+			}
+		})
+	}
+}
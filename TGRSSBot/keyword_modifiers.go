@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 关键词修饰符：在关键词本体前加 [w] 表示整词匹配，[c] 表示区分大小写，可组合为 [wc]
+// 修饰符写在 ! 和 - 前缀之后，例如 -[w]go、![wc]AI
+// 邻近匹配：A NEAR/n B 表示两个词之间最多相隔 n 个词，顺序不限，省略 /n 时默认为 5
+// 整词边界按 Unicode 字母数字判断，中日文不以空格分词，每个字视为一个词
+
+const (
+	DefaultNearDistance = 5  // NEAR 默认距离
+	MaxNearDistance     = 50 // NEAR 最大距离
+)
+
+// NearDistanceOptions 关键词详情中可选的 NEAR 距离
+var NearDistanceOptions = []int{1, 3, 5, 10, 20}
+
+var (
+	keywordModifierPattern = regexp.MustCompile(`^\[([wc]{1,2})\](.+)$`)
+	nearKeywordPattern     = regexp.MustCompile(`^(\S+)\s+NEAR(?:/(\d+))?\s+(\S+)$`)
+)
+
+// keywordModifiers 关键词修饰符
+type keywordModifiers struct {
+	wholeWord     bool
+	caseSensitive bool
+}
+
+// String 返回修饰符的书写形式，没有修饰符时返回空
+func (m keywordModifiers) String() string {
+	var flags string
+	if m.wholeWord {
+		flags += "w"
+	}
+	if m.caseSensitive {
+		flags += "c"
+	}
+	if flags == "" {
+		return ""
+	}
+	return "[" + flags + "]"
+}
+
+// nearKeyword 邻近关键词
+type nearKeyword struct {
+	left     string
+	right    string
+	distance int
+}
+
+// String 返回邻近关键词的书写形式
+func (n *nearKeyword) String() string {
+	return fmt.Sprintf("%s NEAR/%d %s", n.left, n.distance, n.right)
+}
+
+// modifiedKeyword 带修饰符的普通关键词或邻近关键词
+type modifiedKeyword struct {
+	mods keywordModifiers
+	term string       // 普通关键词，不区分大小写时已转为小写
+	near *nearKeyword // 邻近关键词，不区分大小写时两个词已转为小写
+}
+
+// parseKeywordModifiers 拆分关键词本体前的修饰符
+func parseKeywordModifiers(body string) (keywordModifiers, string) {
+	parts := keywordModifierPattern.FindStringSubmatch(body)
+	if parts == nil {
+		return keywordModifiers{}, body
+	}
+	return keywordModifiers{
+		wholeWord:     strings.Contains(parts[1], "w"),
+		caseSensitive: strings.Contains(parts[1], "c"),
+	}, parts[2]
+}
+
+// hasKeywordModifiers 判断关键词本体是否带修饰符
+func hasKeywordModifiers(body string) bool {
+	return keywordModifierPattern.MatchString(body)
+}
+
+// isNearKeyword 判断关键词本体（可带修饰符）是否为 A NEAR/n B 形式
+func isNearKeyword(body string) bool {
+	_, rest := parseKeywordModifiers(body)
+	return nearKeywordPattern.MatchString(rest)
+}
+
+// parseNearKeyword 解析邻近关键词，不是邻近关键词时返回空
+func parseNearKeyword(text string) (*nearKeyword, error) {
+	parts := nearKeywordPattern.FindStringSubmatch(text)
+	if parts == nil {
+		return nil, nil
+	}
+	near := &nearKeyword{left: parts[1], right: parts[3], distance: DefaultNearDistance}
+	if parts[2] != "" {
+		distance, err := strconv.Atoi(parts[2])
+		if err != nil || distance > MaxNearDistance {
+			return nil, fmt.Errorf("NEAR 距离应为 0 到 %d 之间的整数", MaxNearDistance)
+		}
+		near.distance = distance
+	}
+	return near, nil
+}
+
+// supportsKeywordModifiers 判断关键词本体（不含修饰符）能否使用修饰符
+func supportsKeywordModifiers(rest string) bool {
+	if isRegexKeyword(rest) || isPinyinKeyword(rest) {
+		return false
+	}
+	if nearKeywordPattern.MatchString(rest) {
+		return true
+	}
+	return !isKeywordExpression(rest) && !strings.Contains(rest, "*")
+}
+
+// compileModifiedKeyword 编译带修饰符的关键词或邻近关键词
+func compileModifiedKeyword(body string) (*modifiedKeyword, error) {
+	mods, rest := parseKeywordModifiers(body)
+	if !supportsKeywordModifiers(rest) {
+		return nil, fmt.Errorf("修饰符只能用于普通关键词和 NEAR 关键词")
+	}
+
+	lower := func(s string) string {
+		if mods.caseSensitive {
+			return s
+		}
+		return strings.ToLower(s)
+	}
+
+	near, err := parseNearKeyword(rest)
+	if err != nil {
+		return nil, err
+	}
+	if near != nil {
+		near.left, near.right = lower(near.left), lower(near.right)
+		return &modifiedKeyword{mods: mods, near: near}, nil
+	}
+	return &modifiedKeyword{mods: mods, term: lower(rest)}, nil
+}
+
+// termIndex 缓存一段内容的分词结果和词的出现位置，同一条消息的多个关键词共享
+type termIndex struct {
+	subject     string
+	spans       [][2]int
+	occurrences map[termIndexKey][][2]int
+}
+
+type termIndexKey struct {
+	term      string
+	wholeWord bool
+}
+
+// newTermIndex 创建内容索引，分词和查找在首次使用时进行
+func newTermIndex(subject string) *termIndex {
+	return &termIndex{subject: subject, occurrences: make(map[termIndexKey][][2]int)}
+}
+
+// find 返回词的全部出现位置
+func (idx *termIndex) find(term string, wholeWord bool) [][2]int {
+	key := termIndexKey{term: term, wholeWord: wholeWord}
+	occurrences, ok := idx.occurrences[key]
+	if !ok {
+		occurrences = findTermOccurrences(idx.subject, term, wholeWord)
+		idx.occurrences[key] = occurrences
+	}
+	return occurrences
+}
+
+// wordSpans 返回内容的分词结果
+func (idx *termIndex) wordSpans() [][2]int {
+	if idx.spans == nil {
+		idx.spans = wordSpans(idx.subject)
+	}
+	return idx.spans
+}
+
+// match 判断是否命中，raw 为原始内容，lower 为小写后的内容
+func (k *modifiedKeyword) match(raw, lower string) bool {
+	return k.matchIndex(newTermIndex(raw), newTermIndex(lower))
+}
+
+// matchIndex 使用内容索引判断是否命中
+func (k *modifiedKeyword) matchIndex(raw, lower *termIndex) bool {
+	idx := lower
+	if k.mods.caseSensitive {
+		idx = raw
+	}
+	if k.near != nil {
+		return k.near.match(idx, k.mods.wholeWord)
+	}
+	if !k.mods.wholeWord {
+		return strings.Contains(idx.subject, k.term)
+	}
+	return len(idx.find(k.term, true)) > 0
+}
+
+// isWordRune 判断是否为组成单词的字符
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isCJKRune 判断是否为不以空格分词的中日文字符
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// isWordBoundary 判断 subject 的 pos 处是否为词边界
+func isWordBoundary(subject string, pos int) bool {
+	if pos <= 0 || pos >= len(subject) {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(subject[:pos])
+	after, _ := utf8.DecodeRuneInString(subject[pos:])
+	return !isWordRune(before) || !isWordRune(after) || isCJKRune(before) || isCJKRune(after)
+}
+
+// findTermOccurrences 查找词在内容中的出现位置，wholeWord 为真时只保留两端都在词边界的位置
+func findTermOccurrences(subject, term string, wholeWord bool) [][2]int {
+	if term == "" {
+		return nil
+	}
+	var occurrences [][2]int
+	for offset := 0; offset < len(subject); {
+		idx := strings.Index(subject[offset:], term)
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		end := start + len(term)
+		if !wholeWord || (isWordBoundary(subject, start) && isWordBoundary(subject, end)) {
+			occurrences = append(occurrences, [2]int{start, end})
+		}
+		_, size := utf8.DecodeRuneInString(subject[start:])
+		offset = start + size
+	}
+	return occurrences
+}
+
+// wordSpans 按词切分内容，返回每个词的起止位置，中日文每个字算一个词
+func wordSpans(subject string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range subject {
+		switch {
+		case isCJKRune(r):
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+			spans = append(spans, [2]int{i, i + utf8.RuneLen(r)})
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(subject)})
+	}
+	return spans
+}
+
+// match 判断两个词是否在 distance 个词以内同时出现，顺序不限
+func (n *nearKeyword) match(idx *termIndex, wholeWord bool) bool {
+	lefts := idx.find(n.left, wholeWord)
+	if len(lefts) == 0 {
+		return false
+	}
+	rights := idx.find(n.right, wholeWord)
+	if len(rights) == 0 {
+		return false
+	}
+
+	spans := idx.wordSpans()
+	// wordRange 返回出现位置覆盖的第一个和最后一个词的序号
+	wordRange := func(occurrence [2]int) (int, int) {
+		first := sort.Search(len(spans), func(i int) bool { return spans[i][1] > occurrence[0] })
+		last := sort.Search(len(spans), func(i int) bool { return spans[i][0] >= occurrence[1] }) - 1
+		if last < first {
+			last = first
+		}
+		return first, last
+	}
+
+	for _, a := range lefts {
+		aFirst, aLast := wordRange(a)
+		for _, b := range rights {
+			bFirst, bLast := wordRange(b)
+			var gap int
+			switch {
+			case a[1] <= b[0]:
+				gap = bFirst - aLast - 1
+			case b[1] <= a[0]:
+				gap = aFirst - bLast - 1
+			default:
+				continue // 两个词重叠，不算作同时出现
+			}
+			if gap <= n.distance {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitKeywordPrefix 拆分关键词的紧急和屏蔽前缀
+func splitKeywordPrefix(keyword string) (string, string) {
+	body := strings.TrimPrefix(keyword, UrgentKeywordPrefix)
+	body = strings.TrimPrefix(body, "-")
+	return keyword[:len(keyword)-len(body)], body
+}
+
+// withKeywordModifiers 返回替换修饰符后的关键词，保留紧急和屏蔽前缀
+func withKeywordModifiers(keyword string, mods keywordModifiers) string {
+	prefix, body := splitKeywordPrefix(keyword)
+	_, rest := parseKeywordModifiers(body)
+	return prefix + mods.String() + rest
+}
+
+// withNearDistance 返回修改 NEAR 距离后的关键词，不是邻近关键词时原样返回
+func withNearDistance(keyword string, distance int) string {
+	prefix, body := splitKeywordPrefix(keyword)
+	mods, rest := parseKeywordModifiers(body)
+	near, err := parseNearKeyword(rest)
+	if near == nil || err != nil {
+		return keyword
+	}
+	near.distance = distance
+	return prefix + mods.String() + near.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// 正则关键词：使用 /pattern/flags 形式，例如 /rust\s*1\.\d+/i
+// 支持的标志：i 忽略大小写，s 让 . 匹配换行，m 多行模式，U 非贪婪
+// 不带 i 标志时区分大小写，匹配内容为标题和正文
+
+const (
+	MaxRegexKeywordLength = 200  // 正则表达式最大长度（字符）
+	MaxRegexProgramSize   = 2000 // 编译后的指令数上限，限制嵌套重复等复杂表达式
+)
+
+var regexKeywordPattern = regexp.MustCompile(`^/(.+)/([A-Za-z]*)$`)
+
+// isRegexKeyword 判断关键词是否为 /pattern/flags 形式的正则关键词
+func isRegexKeyword(keyword string) bool {
+	return regexKeywordPattern.MatchString(keyword)
+}
+
+// compileRegexKeyword 编译并校验正则关键词，超出长度或复杂度限制时返回错误
+func compileRegexKeyword(keyword string) (*regexp.Regexp, error) {
+	parts := regexKeywordPattern.FindStringSubmatch(keyword)
+	if parts == nil {
+		return nil, fmt.Errorf("格式应为 /正则/标志")
+	}
+	pattern, flags := parts[1], parts[2]
+
+	if length := len([]rune(pattern)); length > MaxRegexKeywordLength {
+		return nil, fmt.Errorf("正则长度 %d 超过上限 %d", length, MaxRegexKeywordLength)
+	}
+
+	seen := make(map[rune]bool)
+	for _, flag := range flags {
+		if !strings.ContainsRune("imsU", flag) {
+			return nil, fmt.Errorf("不支持的标志 %c，可用标志：i s m U", flag)
+		}
+		seen[flag] = true
+	}
+	if len(seen) > 0 {
+		var prefix []rune
+		for _, flag := range "imsU" {
+			if seen[flag] {
+				prefix = append(prefix, flag)
+			}
+		}
+		pattern = "(?" + string(prefix) + ")" + pattern
+	}
+
+	// 先检查复杂度，避免编译过大的表达式
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("语法错误: %v", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("语法错误: %v", err)
+	}
+	if len(prog.Inst) > MaxRegexProgramSize {
+		return nil, fmt.Errorf("表达式过于复杂（%d 条指令，上限 %d），请减少重复次数或分支", len(prog.Inst), MaxRegexProgramSize)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("语法错误: %v", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsRegexKeyword(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    bool
+	}{
+		{`/rust/`, true},
+		{`/rust\s*1\.\d+/i`, true},
+		{`/a/b/`, true},
+		{`/rust/x`, true}, // 标志在编译时校验
+		{`//`, false},
+		{`/rust`, false},
+		{`rust/`, false},
+		{`rust`, false},
+		{`/rust/i1`, false},
+		{`https://example.com/`, false},
+	}
+	for _, tt := range tests {
+		if got := isRegexKeyword(tt.keyword); got != tt.want {
+			t.Errorf("isRegexKeyword(%q) = %v, want %v", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestCompileRegexKeywordMatch(t *testing.T) {
+	tests := []struct {
+		keyword string
+		content string
+		want    bool
+	}{
+		{`/rust\s*1\.\d+/`, "Rust 1.80", false}, // 不带 i 时区分大小写
+		{`/rust\s*1\.\d+/i`, "Rust 1.80", true},
+		{`/rust\s*1\.\d+/i`, "Rust 2.0", false},
+		{`/^Rust$/`, "Rust\nGo", false},
+		{`/^Go$/m`, "Rust\nGo", true},
+		{`/rust.go/`, "rust\ngo", false},
+		{`/rust.go/s`, "rust\ngo", true},
+		{`/a+/U`, "aaa", true},
+		{`/显卡|顯卡/`, "新款顯卡发布", true},
+		{`/a/b/`, "xa/by", true},
+		{`/rust/smiU`, "RUST", true},
+	}
+	for _, tt := range tests {
+		re, err := compileRegexKeyword(tt.keyword)
+		if err != nil {
+			t.Errorf("compileRegexKeyword(%q) error: %v", tt.keyword, err)
+			continue
+		}
+		if got := re.MatchString(tt.content); got != tt.want {
+			t.Errorf("%s on %q = %v, want %v", tt.keyword, tt.content, got, tt.want)
+		}
+	}
+
+	// U 标志使重复变为非贪婪
+	re, err := compileRegexKeyword(`/a+/U`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := re.FindString("aaa"); got != "a" {
+		t.Errorf("/a+/U FindString = %q, want %q", got, "a")
+	}
+}
+
+func TestCompileRegexKeywordErrors(t *testing.T) {
+	tests := []struct {
+		keyword string
+		wantErr string
+	}{
+		{`rust`, "格式应为 /正则/标志"},
+		{`/rust/x`, "不支持的标志 x"},
+		{`/rust/iI`, "不支持的标志 I"},
+		{`/(rust/`, "语法错误"},
+		{`/a{2,1}/`, "语法错误"},
+		{`/rust(?=1)/`, "语法错误"}, // 不支持环视
+		{"/" + strings.Repeat("a", MaxRegexKeywordLength+1) + "/", "超过上限"},
+		{`/((a{1,100}){1,100}){1,100}/`, "语法错误"}, // 重复次数超过 regexp 的上限
+		{`/(a{1,50}b{1,50}){1,20}/`, "表达式过于复杂"},
+	}
+	for _, tt := range tests {
+		_, err := compileRegexKeyword(tt.keyword)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("compileRegexKeyword(%.40q) error = %v, want %q", tt.keyword, err, tt.wantErr)
+		}
+	}
+
+	// 长度按字符计算，中文不会被按字节误判
+	if _, err := compileRegexKeyword("/" + strings.Repeat("显", MaxRegexKeywordLength) + "/"); err != nil {
+		t.Errorf("compileRegexKeyword(%d 个中文字符) error: %v", MaxRegexKeywordLength, err)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 关键词范围：关键词默认对用户的全部订阅生效（全局）
+// 在 user_keyword_scopes 中存在记录时，仅对记录中的订阅生效，屏蔽词同理
+// 取消最后一个订阅时写入 rss_name 为空的记录，表示不对任何订阅生效，避免意外恢复为全局
+// 读取后的范围中，没有记录的关键词不在 map 中，不对任何订阅生效的关键词对应空列表
+
+// keywordScopeNone 表示关键词不对任何订阅生效的范围记录
+const keywordScopeNone = ""
+
+// keywordHashID 生成关键词的短ID，用于回调数据（回调数据长度有限，不能直接放关键词）
+func keywordHashID(keyword string) string {
+	h := fnv.New32a()
+	h.Write([]byte(keyword))
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// findKeywordByHashID 根据短ID查找用户的关键词
+func findKeywordByHashID(userID int64, hashID string) (string, error) {
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		return "", err
+	}
+	for _, kw := range keywords {
+		if keywordHashID(kw) == hashID {
+			return kw, nil
+		}
+	}
+	return "", sql.ErrNoRows
+}
+
+// getAllKeywordScopes 获取所有用户的关键词范围，返回 用户ID -> 关键词 -> 订阅名称列表
+func getAllKeywordScopes(db *sql.DB) (map[int64]map[string][]string, error) {
+	rows, err := db.Query("SELECT user_id, keyword, rss_name FROM user_keyword_scopes")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scopes := make(map[int64]map[string][]string)
+	for rows.Next() {
+		var userID int64
+		var keyword, rssName string
+		if err := rows.Scan(&userID, &keyword, &rssName); err != nil {
+			continue
+		}
+		if scopes[userID] == nil {
+			scopes[userID] = make(map[string][]string)
+		}
+		addKeywordScope(scopes[userID], keyword, rssName)
+	}
+	return scopes, rows.Err()
+}
+
+// addKeywordScope 把一条范围记录加入 关键词 -> 订阅名称列表
+func addKeywordScope(scopes map[string][]string, keyword, rssName string) {
+	if rssName == keywordScopeNone {
+		if _, ok := scopes[keyword]; !ok {
+			scopes[keyword] = []string{}
+		}
+		return
+	}
+	scopes[keyword] = append(scopes[keyword], rssName)
+}
+
+// getKeywordScopesForUser 获取单个用户的关键词范围，返回 关键词 -> 订阅名称列表
+func getKeywordScopesForUser(userID int64) (map[string][]string, error) {
+	scopes := make(map[string][]string)
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT keyword, rss_name FROM user_keyword_scopes WHERE user_id = ? ORDER BY rss_name", userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var keyword, rssName string
+			if err := rows.Scan(&keyword, &rssName); err != nil {
+				return err
+			}
+			addKeywordScope(scopes, keyword, rssName)
+		}
+		return rows.Err()
+	})
+	return scopes, err
+}
+
+// toggleKeywordScope 切换关键词在某个订阅上的生效状态
+// 取消最后一个订阅后关键词不对任何订阅生效，而不是恢复为全局
+func toggleKeywordScope(userID int64, keyword, rssName string) error {
+	return withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec("DELETE FROM user_keyword_scopes WHERE user_id = ? AND keyword = ? AND rss_name = ?",
+			userID, keyword, rssName)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			if _, err := tx.Exec(`
+				INSERT INTO user_keyword_scopes (user_id, keyword, rss_name)
+				SELECT ?, ?, ? WHERE NOT EXISTS (
+					SELECT 1 FROM user_keyword_scopes WHERE user_id = ? AND keyword = ?)`,
+				userID, keyword, keywordScopeNone, userID, keyword); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+
+		if _, err := tx.Exec("DELETE FROM user_keyword_scopes WHERE user_id = ? AND keyword = ? AND rss_name = ?",
+			userID, keyword, keywordScopeNone); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO user_keyword_scopes (user_id, keyword, rss_name) VALUES (?, ?, ?)",
+			userID, keyword, rssName); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// removeSubscriptionKeywordScopes 删除用户某个订阅的关键词范围记录
+// 只对该订阅生效的关键词改为不对任何订阅生效
+func removeSubscriptionKeywordScopes(tx *sql.Tx, userID int64, rssName string) error {
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO user_keyword_scopes (user_id, keyword, rss_name)
+		SELECT user_id, keyword, ? FROM user_keyword_scopes s
+		WHERE user_id = ? AND rss_name = ? AND NOT EXISTS (
+			SELECT 1 FROM user_keyword_scopes o
+			WHERE o.user_id = s.user_id AND o.keyword = s.keyword AND o.rss_name != s.rss_name)`,
+		keywordScopeNone, userID, rssName); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM user_keyword_scopes WHERE user_id = ? AND rss_name = ?", userID, rssName)
+	return err
+}
+
+// deleteKeywordScopes 删除关键词的全部范围记录，使其恢复为全局生效
+func deleteKeywordScopes(userID int64, keyword string) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec("DELETE FROM user_keyword_scopes WHERE user_id = ? AND keyword = ?", userID, keyword)
+		return err
+	})
+}
+
+// keywordsForSubscription 过滤出对指定订阅生效的关键词
+func keywordsForSubscription(keywords []string, scopes map[string][]string, rssName string) []string {
+	if len(scopes) == 0 {
+		return keywords
+	}
+
+	var result []string
+	for _, kw := range keywords {
+		names, scoped := scopes[kw]
+		if !scoped {
+			result = append(result, kw)
+			continue
+		}
+		for _, name := range names {
+			if name == rssName {
+				result = append(result, kw)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// describeKeywordScope 描述关键词的生效范围，names 为 nil 表示全局，空列表表示不对任何订阅生效
+func describeKeywordScope(names []string) string {
+	if names == nil {
+		return "🌐 全部订阅"
+	}
+	if len(names) == 0 {
+		return "🚫 不对任何订阅生效"
+	}
+	return "📰 " + strings.Join(names, "、")
+}
+
+// formatKeywordScopeSummary 生成限定了订阅范围的关键词说明，没有限定时返回空
+func formatKeywordScopeSummary(keywords []string, scopes map[string][]string) string {
+	var lines []string
+	for _, kw := range keywords {
+		if names, ok := scopes[kw]; ok {
+			lines = append(lines, fmt.Sprintf("● %s → %s", kw, describeKeywordScope(names)))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n🎯 限定订阅的关键词：\n" + strings.Join(lines, "\n")
+}
+
+// showKeywordScopeList 显示关键词范围设置列表
+func showKeywordScopeList(userID int64, messageID int) {
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户关键词失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词失败，请稍后重试")
+		return
+	}
+	if len(keywords) == 0 {
+		messageSender.SendError(userID, messageID, "你还没有添加任何关键词")
+		return
+	}
+
+	scopes, err := getKeywordScopesForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取关键词范围失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词范围失败，请稍后重试")
+		return
+	}
+
+	sort.Strings(keywords)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, kw := range keywords {
+		label := "全部订阅"
+		if names, ok := scopes[kw]; ok {
+			label = fmt.Sprintf("%d 个订阅", len(names))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔑 %s · %s", kw, label),
+				"kw_scope_"+keywordHashID(kw)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "back_to_menu"),
+	))
+
+	text := "🎯 关键词范围\n\n关键词默认对全部订阅生效，选择关键词后可限定只在部分订阅中生效（屏蔽词同样适用）："
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showKeywordScopeOptions 显示单个关键词的订阅范围选项
+func showKeywordScopeOptions(userID int64, messageID int, hashID string) {
+	keyword, err := findKeywordByHashID(userID, hashID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 关键词不存在")
+		return
+	}
+
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户订阅失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取订阅失败，请稍后重试")
+		return
+	}
+
+	scopes, err := getKeywordScopesForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取关键词范围失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词范围失败，请稍后重试")
+		return
+	}
+	selected := make(map[string]bool)
+	for _, name := range scopes[keyword] {
+		selected[name] = true
+	}
+	_, scoped := scopes[keyword]
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	globalLabel := "🌐 全部订阅"
+	if !scoped {
+		globalLabel = "✅ " + globalLabel
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(globalLabel, "kw_scope_g_"+hashID),
+	))
+	for _, sub := range subscriptions {
+		label := "⬜ " + sub.Name
+		if selected[sub.Name] {
+			label = "✅ " + sub.Name
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("kw_scope_t_%s_%d", hashID, sub.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回关键词范围", "kw_scope_list"),
+	))
+
+	text := fmt.Sprintf("🔑 关键词：%s\n🎯 当前范围：%s\n\n点击订阅切换是否生效，选择 \"全部订阅\" 恢复全局：",
+		keyword, describeKeywordScope(scopes[keyword]))
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleKeywordScopeCallback 处理关键词范围按钮
+// value 格式为 "g_<关键词ID>"（恢复全局）或 "t_<关键词ID>_<订阅ID>"（切换订阅）
+func handleKeywordScopeCallback(userID int64, messageID int, value string) {
+	parts := strings.Split(value, "_")
+	if len(parts) < 2 {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+
+	hashID := parts[1]
+	keyword, err := findKeywordByHashID(userID, hashID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 关键词不存在")
+		return
+	}
+
+	switch {
+	case parts[0] == "g":
+		err = deleteKeywordScopes(userID, keyword)
+
+	case parts[0] == "t" && len(parts) == 3:
+		subID, convErr := strconv.Atoi(parts[2])
+		if convErr != nil {
+			messageSender.SendError(userID, messageID, "❌ 参数错误")
+			return
+		}
+		sub, subErr := getSubscriptionInfoByID(userID, subID)
+		if subErr != nil {
+			messageSender.SendError(userID, messageID, "❌ 订阅不存在")
+			return
+		}
+		err = toggleKeywordScope(userID, keyword, sub.Name)
+
+	default:
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+
+	if err != nil {
+		logMessage("error", fmt.Sprintf("更新关键词范围失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "更新关键词范围失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("用户更新关键词范围: %s", keyword), userID)
+	showKeywordScopeOptions(userID, messageID, hashID)
+}
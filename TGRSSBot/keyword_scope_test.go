@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestToggleLastKeywordScopeKeepsKeywordScoped(t *testing.T) {
+	setupTestDB(t)
+	const userID = 1
+	keywords := []string{"rust", "go"}
+
+	if err := toggleKeywordScope(userID, "rust", "HN"); err != nil {
+		t.Fatal(err)
+	}
+	if err := toggleKeywordScope(userID, "rust", "HN"); err != nil {
+		t.Fatal(err)
+	}
+	scopes, err := getKeywordScopesForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keywordsForSubscription(keywords, scopes, "HN"); !reflect.DeepEqual(got, []string{"go"}) {
+		t.Errorf("keywordsForSubscription after unticking last scope = %q, want [go]", got)
+	}
+	if got := describeKeywordScope(scopes["rust"]); got != "🚫 不对任何订阅生效" {
+		t.Errorf("describeKeywordScope = %q", got)
+	}
+
+	// 重新勾选订阅后只对该订阅生效
+	if err := toggleKeywordScope(userID, "rust", "Lobsters"); err != nil {
+		t.Fatal(err)
+	}
+	scopes, err = getKeywordScopesForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scopes["rust"]; !reflect.DeepEqual(got, []string{"Lobsters"}) {
+		t.Errorf("scopes[rust] = %q, want [Lobsters]", got)
+	}
+}
+
+func TestRemoveSubscriptionKeywordScopes(t *testing.T) {
+	setupTestDB(t)
+	const userID = 1
+	for _, scope := range [][2]string{{"rust", "HN"}, {"go", "HN"}, {"go", "Lobsters"}} {
+		if err := toggleKeywordScope(userID, scope[0], scope[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := removeSubscriptionKeywordScopes(tx, userID, "HN"); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scopes, err := getKeywordScopesForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"rust": {}, "go": {"Lobsters"}}
+	if !reflect.DeepEqual(scopes, want) {
+		t.Errorf("scopes = %q, want %q", scopes, want)
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 关键词命中统计：processSubscription 按 用户/关键词/订阅/日期（UTC）汇总命中次数，
+// 普通关键词记录命中次数，屏蔽词记录拦截次数；按日明细只保留一段时间，
+// 累计次数和最后命中时间单独保存，用于找出从未命中的关键词
+// 关键词添加或首次进入统计时记录 tracked_since，统计满 DeadKeywordMinDays 天仍未命中才视为未命中关键词，
+// 避免升级后或刚添加的关键词被误删
+
+const (
+	KeywordHitRetentionDays = 35 // 按日命中明细保留天数
+	DeadKeywordMinDays      = 30 // 统计满多少天仍未命中才视为未命中关键词
+	keywordHitDayLayout     = "2006-01-02"
+)
+
+var (
+	keywordHitPruneMutex sync.Mutex
+	keywordHitPrunedDay  string
+)
+
+// keywordHitKey 命中统计的汇总键
+type keywordHitKey struct {
+	userID  int64
+	keyword string
+}
+
+// keywordHitCount 命中和拦截次数
+type keywordHitCount struct {
+	matched int
+	blocked int
+}
+
+// keywordHitCounter 一次订阅检查中的命中计数，检查结束后一次性写入数据库
+type keywordHitCounter struct {
+	rssName string
+	counts  map[keywordHitKey]*keywordHitCount
+}
+
+// keywordStat 单个关键词的命中统计
+type keywordStat struct {
+	Keyword   string
+	Matched7  int
+	Blocked7  int
+	Matched30 int
+	Blocked30 int
+	LastHit      time.Time // 最后命中时间，零值表示从未命中
+	TrackedSince time.Time // 开始统计的时间
+}
+
+// trackedDays 返回关键词已统计的天数
+func (s keywordStat) trackedDays(now time.Time) int {
+	return int(now.Sub(s.TrackedSince).Hours() / 24)
+}
+
+// isDead 判断关键词是否统计满 DeadKeywordMinDays 天仍从未命中
+func (s keywordStat) isDead(now time.Time) bool {
+	return s.LastHit.IsZero() && !s.TrackedSince.IsZero() && s.trackedDays(now) >= DeadKeywordMinDays
+}
+
+// newKeywordHitCounter 创建订阅的命中计数器
+func newKeywordHitCounter(rssName string) *keywordHitCounter {
+	return &keywordHitCounter{rssName: rssName, counts: make(map[keywordHitKey]*keywordHitCount)}
+}
+
+// add 记录用户对一条消息的命中结果
+// 命中屏蔽词时只记录屏蔽词的拦截次数，普通关键词不计为命中
+func (c *keywordHitCounter) add(userID int64, hits []KeywordHit) {
+	blocked := false
+	for _, hit := range hits {
+		if hit.Blocked {
+			blocked = true
+			break
+		}
+	}
+
+	for _, hit := range hits {
+		if !hit.Blocked && blocked {
+			continue
+		}
+		key := keywordHitKey{userID: userID, keyword: hit.Keyword}
+		count := c.counts[key]
+		if count == nil {
+			count = &keywordHitCount{}
+			c.counts[key] = count
+		}
+		if hit.Blocked {
+			count.blocked++
+		} else {
+			count.matched++
+		}
+	}
+}
+
+// flush 将计数写入数据库
+func (c *keywordHitCounter) flush(db *sql.DB) error {
+	if len(c.counts) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	day := now.Format(keywordHitDayLayout)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, count := range c.counts {
+		if _, err := tx.Exec(`
+			INSERT INTO keyword_hits (user_id, keyword, rss_name, day, matched, blocked, last_hit_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, keyword, rss_name, day) DO UPDATE SET
+				matched = matched + excluded.matched,
+				blocked = blocked + excluded.blocked,
+				last_hit_at = excluded.last_hit_at`,
+			key.userID, key.keyword, c.rssName, day, count.matched, count.blocked, now); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO keyword_hit_totals (user_id, keyword, matched, blocked, last_hit_at, tracked_since)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, keyword) DO UPDATE SET
+				matched = matched + excluded.matched,
+				blocked = blocked + excluded.blocked,
+				last_hit_at = excluded.last_hit_at`,
+			key.userID, key.keyword, count.matched, count.blocked, now, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// trackKeywords 记录关键词开始统计的时间，已有记录的保持不变
+func trackKeywords(db *sql.DB, userID int64, keywords []string, now time.Time) error {
+	for _, kw := range keywords {
+		if _, err := db.Exec(`
+			INSERT INTO keyword_hit_totals (user_id, keyword, tracked_since)
+			VALUES (?, ?, ?)
+			ON CONFLICT(user_id, keyword) DO UPDATE SET
+				tracked_since = COALESCE(tracked_since, excluded.tracked_since)`,
+			userID, kw, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneKeywordHits 清理过期的按日命中明细，每天最多执行一次
+func pruneKeywordHits(db *sql.DB) {
+	today := time.Now().UTC().Format(keywordHitDayLayout)
+
+	keywordHitPruneMutex.Lock()
+	defer keywordHitPruneMutex.Unlock()
+	if keywordHitPrunedDay == today {
+		return
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -KeywordHitRetentionDays).Format(keywordHitDayLayout)
+	result, err := db.Exec("DELETE FROM keyword_hits WHERE day < ?", cutoff)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("清理关键词命中明细失败: %v", err))
+		return
+	}
+	keywordHitPrunedDay = today
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		logMessage("debug", fmt.Sprintf("已清理 %d 条过期的关键词命中明细", affected))
+	}
+}
+
+// getKeywordStats 获取用户关键词近7天、近30天的命中统计，按传入的关键词顺序返回
+func getKeywordStats(userID int64, keywords []string) ([]keywordStat, error) {
+	now := time.Now().UTC()
+	day7 := now.AddDate(0, 0, -6).Format(keywordHitDayLayout)
+	day30 := now.AddDate(0, 0, -29).Format(keywordHitDayLayout)
+
+	stats := make(map[string]*keywordStat, len(keywords))
+	for _, kw := range keywords {
+		stats[kw] = &keywordStat{Keyword: kw}
+	}
+
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT keyword,
+				   SUM(CASE WHEN day >= ? THEN matched ELSE 0 END),
+				   SUM(CASE WHEN day >= ? THEN blocked ELSE 0 END),
+				   SUM(matched), SUM(blocked)
+			FROM keyword_hits
+			WHERE user_id = ? AND day >= ?
+			GROUP BY keyword`, day7, day7, userID, day30)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var keyword string
+			var matched7, blocked7, matched30, blocked30 int
+			if err := rows.Scan(&keyword, &matched7, &blocked7, &matched30, &blocked30); err != nil {
+				return err
+			}
+			if stat, ok := stats[keyword]; ok {
+				stat.Matched7, stat.Blocked7 = matched7, blocked7
+				stat.Matched30, stat.Blocked30 = matched30, blocked30
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		totals, err := db.Query("SELECT keyword, last_hit_at, tracked_since FROM keyword_hit_totals WHERE user_id = ?", userID)
+		if err != nil {
+			return err
+		}
+		defer totals.Close()
+
+		for totals.Next() {
+			var keyword string
+			var lastHit, trackedSince sql.NullTime
+			if err := totals.Scan(&keyword, &lastHit, &trackedSince); err != nil {
+				return err
+			}
+			stat, ok := stats[keyword]
+			if !ok {
+				continue
+			}
+			if lastHit.Valid {
+				stat.LastHit = lastHit.Time
+			}
+			if trackedSince.Valid {
+				stat.TrackedSince = trackedSince.Time
+			}
+		}
+		if err := totals.Err(); err != nil {
+			return err
+		}
+		totals.Close()
+
+		// 升级前已有的关键词从现在开始统计
+		var untracked []string
+		for _, kw := range keywords {
+			if stats[kw].TrackedSince.IsZero() {
+				stats[kw].TrackedSince = now
+				untracked = append(untracked, kw)
+			}
+		}
+		return trackKeywords(db, userID, untracked, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]keywordStat, 0, len(keywords))
+	for _, kw := range keywords {
+		result = append(result, *stats[kw])
+	}
+	return result, nil
+}
+
+// renameKeywordHits 关键词改写后迁移命中统计
+func renameKeywordHits(tx *sql.Tx, userID int64, oldKeyword, newKeyword string) error {
+	if _, err := tx.Exec("UPDATE keyword_hits SET keyword = ? WHERE user_id = ? AND keyword = ?",
+		newKeyword, userID, oldKeyword); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE keyword_hit_totals SET keyword = ? WHERE user_id = ? AND keyword = ?",
+		newKeyword, userID, oldKeyword)
+	return err
+}
+
+// deleteKeywordHits 删除关键词的命中统计
+func deleteKeywordHits(userID int64, keyword string) error {
+	return withDB(func(db *sql.DB) error {
+		if _, err := db.Exec("DELETE FROM keyword_hits WHERE user_id = ? AND keyword = ?", userID, keyword); err != nil {
+			return err
+		}
+		_, err := db.Exec("DELETE FROM keyword_hit_totals WHERE user_id = ? AND keyword = ?", userID, keyword)
+		return err
+	})
+}
+
+// describeKeywordHits 描述单个关键词的命中情况
+func describeKeywordHits(userID int64, stat keywordStat) string {
+	_, isBlock := keywordBody(stat.Keyword)
+
+	var text string
+	if isBlock {
+		text = fmt.Sprintf("拦截 %d / %d 次", stat.Blocked7, stat.Blocked30)
+	} else {
+		text = fmt.Sprintf("命中 %d / %d 次", stat.Matched7, stat.Matched30)
+	}
+	if stat.LastHit.IsZero() {
+		return text + " · 从未命中"
+	}
+	return text + " · 最后 " + formatTimeForUser(userID, stat.LastHit)
+}
+
+// getDeadKeywords 获取用户统计满 DeadKeywordMinDays 天仍从未命中的关键词
+func getDeadKeywords(userID int64) ([]string, error) {
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := getKeywordStats(userID, keywords)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var dead []string
+	for _, stat := range stats {
+		if stat.isDead(now) {
+			dead = append(dead, stat.Keyword)
+		}
+	}
+	sort.Strings(dead)
+	return dead, nil
+}
+
+// showKeywordStats 显示关键词命中统计和从未命中的关键词
+func showKeywordStats(userID int64, messageID int) {
+	keywords, err := getKeywordsForUser(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户关键词失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词失败，请稍后重试")
+		return
+	}
+	if len(keywords) == 0 {
+		messageSender.SendError(userID, messageID, "你还没有添加任何关键词")
+		return
+	}
+
+	stats, err := getKeywordStats(userID, keywords)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取关键词统计失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词统计失败，请稍后重试")
+		return
+	}
+
+	// 命中过的关键词按近30天次数排序，未命中的按是否统计满 DeadKeywordMinDays 天区分
+	now := time.Now()
+	var active []keywordStat
+	var dead []keywordStat
+	var young []string
+	for _, stat := range stats {
+		switch {
+		case !stat.LastHit.IsZero():
+			active = append(active, stat)
+		case stat.isDead(now):
+			dead = append(dead, stat)
+		default:
+			young = append(young, stat.Keyword)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		a, b := active[i].Matched30+active[i].Blocked30, active[j].Matched30+active[j].Blocked30
+		if a != b {
+			return a > b
+		}
+		return active[i].Keyword < active[j].Keyword
+	})
+	sort.Slice(dead, func(i, j int) bool { return dead[i].Keyword < dead[j].Keyword })
+	sort.Strings(young)
+
+	var b strings.Builder
+	b.WriteString("📊 关键词统计（近7天 / 近30天）\n")
+	for i, stat := range active {
+		line := fmt.Sprintf("\n● %s：%s", stat.Keyword, describeKeywordHits(userID, stat))
+		// 预留从未命中列表和按钮说明的长度
+		if b.Len()+len(line) > MaxMessageLength-1000 {
+			b.WriteString(fmt.Sprintf("\n…… 另有 %d 个关键词未显示", len(active)-i))
+			break
+		}
+		b.WriteString(line)
+	}
+	if len(active) == 0 {
+		b.WriteString("\n暂无命中记录")
+	}
+
+	if len(young) > 0 {
+		b.WriteString(fmt.Sprintf("\n\n⏳ 统计未满 %d 天、暂未命中（%d 个）：\n%s",
+			DeadKeywordMinDays, len(young), truncateText(strings.Join(young, "、"), 300)))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(dead) > 0 {
+		var names []string
+		for _, stat := range dead {
+			names = append(names, fmt.Sprintf("%s（%d 天）", stat.Keyword, stat.trackedDays(now)))
+		}
+		b.WriteString(fmt.Sprintf("\n\n💤 统计 %d 天以上从未命中的关键词（%d 个）：\n%s",
+			DeadKeywordMinDays, len(dead), truncateText(strings.Join(names, "、"), 600)))
+		b.WriteString("\n\n点击关键词单独删除，或一键删除全部未命中的关键词")
+
+		var row []tgbotapi.InlineKeyboardButton
+		for i, stat := range dead {
+			if i >= 30 {
+				break // 按钮过多时只显示前30个
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData("❌ "+stat.Keyword, "kw_dead_"+keywordHashID(stat.Keyword)))
+			if len(row) == 3 {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 删除全部未命中关键词（%d）", len(dead)), "kw_dead_all"),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "back_to_menu"),
+	))
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, b.String(), &keyboard)
+}
+
+// handleDeadKeywordCallback 删除从未命中的关键词，value 为 "all" 或关键词ID
+func handleDeadKeywordCallback(userID int64, messageID int, value string) {
+	dead, err := getDeadKeywords(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取未命中关键词失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取关键词统计失败，请稍后重试")
+		return
+	}
+
+	var targets []string
+	for _, kw := range dead {
+		if value == "all" || keywordHashID(kw) == value {
+			targets = append(targets, kw)
+		}
+	}
+	if len(targets) == 0 {
+		messageSender.SendError(userID, messageID, "❌ 没有可删除的关键词")
+		return
+	}
+
+	for _, kw := range targets {
+		if _, err := userErrorResult(removeKeywordForUser(userID, kw)); err != nil {
+			logMessage("error", fmt.Sprintf("删除关键词失败: %v", err), userID)
+			messageSender.SendError(userID, messageID, "删除关键词失败，请稍后重试")
+			return
+		}
+	}
+	logMessage("info", fmt.Sprintf("用户删除 %d 个未命中关键词: %s", len(targets), strings.Join(targets, ", ")), userID)
+	showKeywordStats(userID, messageID)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeadKeywordsRequireMinimumAge(t *testing.T) {
+	setupTestDB(t)
+	const userID = 1
+	if _, err := addKeywordsForUser(userID, []string{"rust", "golang", "python"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 刚添加的关键词不算未命中
+	if dead, err := getDeadKeywords(userID); err != nil || len(dead) != 0 {
+		t.Fatalf("getDeadKeywords = %q, %v; want none", dead, err)
+	}
+
+	counter := newKeywordHitCounter("feed")
+	counter.add(userID, []KeywordHit{{Keyword: "rust"}})
+	if err := counter.flush(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// 统计满 DeadKeywordMinDays 天后，从未命中的关键词才算未命中
+	old := time.Now().UTC().AddDate(0, 0, -DeadKeywordMinDays-1)
+	if err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE keyword_hit_totals SET tracked_since = ? WHERE user_id = ? AND keyword != ?", old, userID, "python")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := getDeadKeywords(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"golang"}; !reflect.DeepEqual(dead, want) {
+		t.Errorf("getDeadKeywords = %q, want %q", dead, want)
+	}
+}
+
+func TestKeywordStatsTracksExistingKeywords(t *testing.T) {
+	setupTestDB(t)
+	const userID = 2
+	// 模拟升级前保存的关键词，没有统计记录
+	if err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec("INSERT INTO user_keywords (user_id, keywords) VALUES (?, ?)", userID, `["legacy"]`)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := getKeywordStats(userID, []string{"legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].TrackedSince.IsZero() || stats[0].isDead(time.Now()) {
+		t.Errorf("legacy keyword stat = %+v, want tracked from now and not dead", stats[0])
+	}
+	if dead, err := getDeadKeywords(userID); err != nil || len(dead) != 0 {
+		t.Errorf("getDeadKeywords = %q, %v; want none", dead, err)
+	}
+}
@@ -24,12 +24,25 @@ import (
 // 从config.json文件中加载配置信息
 type Config struct {
 	BotToken  string    `json:"BotToken"`  // Telegram Bot API令牌
-	ADMINIDS  int64     `json:"ADMINIDS"`  // 管理员ID，逗号分隔
+	ADMINIDS  int64     `json:"ADMINIDS"`  // 所有者ID，0表示不设置（兼容旧版单管理员配置）
 	Cycletime int       `json:"Cycletime"` // RSS检查周期(秒)
 	Debug     bool      `json:"Debug"`     // 是否开启调试模式
 	ProxyURL  string    `json:"ProxyURL"`  // 代理服务器URL
 	Pushinfo  string    `json:"Pushinfo"`  // 推送信息配置
 	AI        *AIConfig `json:"AI"`        // AI功能配置
+
+	Timezone   string `json:"Timezone"`   // 默认时区(IANA名称)，如 Asia/Shanghai
+	DateFormat string `json:"DateFormat"` // 默认时间格式(Go时间布局)
+
+	Roles      map[string][]int64 `json:"Roles"`      // 角色 -> 用户ID列表，启动时写入数据库
+	AccessMode string             `json:"AccessMode"` // 访问模式 open/allowlist/approval，默认在设置了ADMINIDS时为allowlist
+
+	Quotas UserQuota `json:"Quotas"` // 默认用户配额，0表示不限制
+
+	Webhook *WebhookConfig `json:"Webhook"` // Webhook模式配置，未启用时使用长轮询
+	HTTP    *HTTPConfig    `json:"HTTP"`    // HTTP服务配置，提供管理API等接口
+
+	Watchdog WatchdogConfig `json:"Watchdog"` // 自检配置，异常时通知管理员
 }
 
 // AIConfig AI功能配置结构体
@@ -74,6 +87,8 @@ type Message struct {
 	Description string    // 消息描述/内容
 	Link        string    // 原文链接
 	PubDate     time.Time // 发布时间
+	Author      string    // 作者
+	Categories  []string  // 分类/标签
 }
 
 // Subscription RSS订阅结构体
@@ -110,6 +125,7 @@ type UserStats struct {
 }
 
 type SubscriptionInfo struct {
+	ID         int
 	Name       string
 	URL        string
 	LastUpdate string
@@ -126,6 +142,9 @@ const (
 	DBFile           = "tgbot.db"       // 数据库文件路径
 	ConfigFile       = "config.json"    // 配置文件路径
 	DefaultCycleTime = 300              // 默认RSS检查周期(秒)
+
+	DefaultTimezone   = "Asia/Shanghai"       // 默认时区
+	DefaultDateFormat = "2006-01-02 15:04:05" // 默认时间格式
 )
 
 // BotError 自定义错误类型
@@ -136,13 +155,15 @@ type PushStats struct {
 	Date      string         // 日期，格式为 YYYY-MM-DD
 	TotalPush int            // 总推送次数
 	ByRSS     map[string]int // 每个RSS源的推送次数
+	StartedAt time.Time      // 本轮统计开始时间
 	mutex     sync.Mutex     // 互斥锁，保护统计数据
 }
 
 // 全局变量，存储当日推送统计
 var DailyPushStats = &PushStats{
-	Date:  time.Now().Format("2006-01-02"),
-	ByRSS: make(map[string]int),
+	Date:      time.Now().Format("2006-01-02"),
+	ByRSS:     make(map[string]int),
+	StartedAt: time.Now(),
 }
 
 type DatabaseOperator struct {
@@ -165,6 +186,7 @@ func resetPushStatsIfNeeded() {
 		DailyPushStats.Date = currentDate
 		DailyPushStats.TotalPush = 0
 		DailyPushStats.ByRSS = make(map[string]int)
+		DailyPushStats.StartedAt = time.Now()
 	}
 }
 
@@ -180,6 +202,7 @@ func recordPush(rssName string) {
 		DailyPushStats.Date = currentDate
 		DailyPushStats.TotalPush = 0
 		DailyPushStats.ByRSS = make(map[string]int)
+		DailyPushStats.StartedAt = time.Now()
 	}
 
 	// 更新统计
@@ -188,13 +211,14 @@ func recordPush(rssName string) {
 }
 
 // 获取推送统计信息
-func GetPushStatsInfo() string {
+// 统计起始时间按用户的时区和时间格式显示
+func GetPushStatsInfo(userID int64) string {
 	DailyPushStats.mutex.Lock()
 	defer DailyPushStats.mutex.Unlock()
 
 	// 构建统计信息
-	info := fmt.Sprintf("📊 今日(%s)推送总计：%d 次",
-		DailyPushStats.Date, DailyPushStats.TotalPush)
+	info := fmt.Sprintf("📊 今日推送总计：%d 次（自 %s 起）",
+		DailyPushStats.TotalPush, formatTimeForUser(userID, DailyPushStats.StartedAt))
 
 	// 按RSS源统计
 	if len(DailyPushStats.ByRSS) > 0 {
@@ -230,6 +254,46 @@ func loadConfig() (*Config, error) {
 	if config.Cycletime <= 0 {
 		config.Cycletime = DefaultCycleTime
 	}
+	if config.Timezone == "" {
+		config.Timezone = DefaultTimezone
+	}
+	if _, err := time.LoadLocation(config.Timezone); err != nil {
+		return nil, fmt.Errorf("无效的时区 %s: %v", config.Timezone, err)
+	}
+	if config.DateFormat == "" {
+		config.DateFormat = DefaultDateFormat
+	}
+	if config.AccessMode == "" {
+		// 旧版配置中设置了管理员时只有管理员可用
+		config.AccessMode = AccessModeOpen
+		if config.ADMINIDS != 0 {
+			config.AccessMode = AccessModeAllowlist
+		}
+	}
+	switch config.AccessMode {
+	case AccessModeOpen, AccessModeAllowlist, AccessModeApproval:
+	default:
+		return nil, fmt.Errorf("无效的访问模式 %s，可选 open/allowlist/approval", config.AccessMode)
+	}
+	for role := range config.Roles {
+		if role == RoleNone || roleNames[role] == "" {
+			return nil, fmt.Errorf("无效的角色 %s，可选 owner/admin/user/banned", role)
+		}
+	}
+	for _, key := range quotaFieldOrder {
+		if *quotaFields[key].get(&config.Quotas) < 0 {
+			return nil, fmt.Errorf("配额 %s 不能为负数", quotaFields[key].column)
+		}
+	}
+	if err := validateWebhookConfig(config.Webhook); err != nil {
+		return nil, err
+	}
+	if err := validateHTTPConfig(config.HTTP); err != nil {
+		return nil, err
+	}
+	if err := validateWatchdogConfig(&config.Watchdog); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
@@ -404,6 +468,7 @@ func (m *MessageSender) SendResponse(userID int64, messageID int, text string, k
 	} else {
 		// 发送新消息
 		msg := tgbotapi.NewMessage(userID, text)
+		applyGroupReplyTarget(&msg.BaseChat)
 		if keyboard != nil {
 			msg.ReplyMarkup = *keyboard
 		}
@@ -427,6 +492,7 @@ func (m *MessageSender) SendHTMLResponse(userID int64, messageID int, text strin
 		// 发送新消息
 		msg := tgbotapi.NewMessage(userID, text)
 		msg.ParseMode = "HTML"
+		applyGroupReplyTarget(&msg.BaseChat)
 		if keyboard != nil {
 			msg.ReplyMarkup = *keyboard
 		}
@@ -484,15 +550,20 @@ func CreateBackButton() tgbotapi.InlineKeyboardMarkup {
 	)
 }
 
-func CreateDeleteKeyboard(items []string, prefix string) tgbotapi.InlineKeyboardMarkup {
+// CreateDeleteKeyboard 创建删除按钮键盘，idOf 不为空时用其返回值代替条目本身作为回调数据
+func CreateDeleteKeyboard(items []string, prefix string, idOf func(string) string) tgbotapi.InlineKeyboardMarkup {
 	const buttonsPerRow = 3
 	var keyboardRows [][]tgbotapi.InlineKeyboardButton
 	var currentRow []tgbotapi.InlineKeyboardButton
 
 	for i, item := range items {
+		id := item
+		if idOf != nil {
+			id = idOf(item)
+		}
 		currentRow = append(currentRow, tgbotapi.NewInlineKeyboardButtonData(
 			fmt.Sprintf("❌ %s", item),
-			fmt.Sprintf("%s_%s", prefix, item),
+			fmt.Sprintf("%s_%s", prefix, id),
 		))
 
 		if len(currentRow) == buttonsPerRow || i == len(items)-1 {
@@ -570,7 +641,7 @@ func (h *UserActionHandler) handleKeywordAction(userID int64, messageID int, act
 	switch action {
 	case "add_prompt":
 		setUserState(userID, "add_keyword", messageID, nil)
-		text := "请输入要添加的关键词，多个关键词可用空格、逗号(,)或中文逗号(，)分隔：\n\n💡 提示：关键词将用于过滤RSS内容"
+		text := "请输入要添加的关键词，多个关键词可用空格、逗号(,)或中文逗号(，)分隔，expr: 表达式每行一个：\n\n💡 提示：关键词将用于过滤RSS内容，默认对全部订阅生效，可在 🎯 关键词范围 中限定订阅\n🔤 [w]go 整词匹配，[c]AI 区分大小写，rust NEAR/3 async 表示两个词相隔不超过3个词"
 		keyboard := CreateBackButton()
 		h.sender.SendResponse(userID, messageID, text, &keyboard)
 
@@ -580,7 +651,7 @@ func (h *UserActionHandler) handleKeywordAction(userID int64, messageID int, act
 			return
 		}
 
-		result, err := h.addKeywords(userID, data)
+		result, err := userErrorResult(h.addKeywords(userID, data))
 		if err != nil {
 			logMessage("error", fmt.Sprintf("添加关键词失败: %v", err), userID)
 			h.sender.SendError(userID, messageID, "添加关键词失败，请稍后重试")
@@ -672,6 +743,9 @@ func (h *UserActionHandler) viewKeywords(userID int64, messageID int) {
 
 	sort.Strings(keywords)
 	text := h.formatKeywordsList(keywords)
+	if scopes, err := getKeywordScopesForUser(userID); err == nil {
+		text += formatKeywordScopeSummary(keywords, scopes)
+	}
 	h.sender.HandleLongText(userID, messageID, text, true)
 }
 
@@ -689,12 +763,12 @@ func (h *UserActionHandler) showDeleteKeywords(userID int64, messageID int) {
 	}
 
 	sort.Strings(keywords)
-	keyboard := CreateDeleteKeyboard(keywords, "del_kw")
+	keyboard := CreateDeleteKeyboard(keywords, "del_kw", keywordHashID)
 	h.sender.SendResponse(userID, messageID, "请选择要删除的关键词：", &keyboard)
 }
 
 func (h *UserActionHandler) deleteKeyword(userID int64, messageID int, keyword string) {
-	result, err := removeKeywordForUser(userID, keyword)
+	result, err := userErrorResult(removeKeywordForUser(userID, keyword))
 	if err != nil {
 		logMessage("error", fmt.Sprintf("删除关键词失败: %v", err), userID)
 		h.sender.SendError(userID, messageID, "删除关键词失败，请稍后重试")
@@ -733,6 +807,10 @@ func (h *UserActionHandler) addSubscription(userID int64, messageID int, feedURL
 	clearUserState(userID)
 	keyboard := CreateBackButton()
 	text := fmt.Sprintf("✅ 成功添加订阅：\n📰 %s\n🔗 %s", name, feedURL)
+	if subID, ok := findSubscriptionIDByName(userID, name); ok {
+		keyboard = createReceiveAllChoiceKeyboard(subID)
+		text += "\n\n请选择此订阅的推送范围："
+	}
 	logMessage("info", fmt.Sprintf("✅ 成功添加订阅：📰 %s  🔗 %s", name, feedURL))
 	h.sender.SendResponse(userID, messageID, text, &keyboard)
 }
@@ -772,12 +850,12 @@ func (h *UserActionHandler) showDeleteSubscriptions(userID int64, messageID int)
 		names = append(names, sub.Name)
 	}
 
-	keyboard := CreateDeleteKeyboard(names, "del_sub")
+	keyboard := CreateDeleteKeyboard(names, "del_sub", nil)
 	h.sender.SendResponse(userID, messageID, "请选择要删除的订阅：", &keyboard)
 }
 
 func (h *UserActionHandler) deleteSubscription(userID int64, messageID int, subscriptionName string) {
-	result, err := removeSubscriptionForUser(userID, subscriptionName)
+	result, err := userErrorResult(removeSubscriptionForUser(userID, subscriptionName))
 	if err != nil {
 		logMessage("error", fmt.Sprintf("删除订阅失败: %v", err), userID)
 		h.sender.SendError(userID, messageID, "删除订阅失败，请稍后重试")
@@ -815,7 +893,11 @@ func (h *UserActionHandler) formatKeywordsList(keywords []string) string {
 func (h *UserActionHandler) formatSubscriptionsList(subscriptions []SubscriptionInfo) string {
 	var subList []string
 	for i, sub := range subscriptions {
-		subList = append(subList, fmt.Sprintf("%d. 📰 %s\n   🔗 %s", i+1, sub.Name, sub.URL))
+		item := fmt.Sprintf("%d. 📰 %s\n   🔗 %s", i+1, sub.Name, sub.URL)
+		if sub.LastUpdate != "" {
+			item += fmt.Sprintf("\n   🕒 最后更新：%s", sub.LastUpdate)
+		}
+		subList = append(subList, item)
 	}
 	return fmt.Sprintf("📰 你的订阅列表（共 %d 个）：\n\n%s", len(subscriptions), strings.Join(subList, "\n"))
 }
@@ -852,7 +934,7 @@ func main() {
 源码仓库: https://github.com/IonRh/TGBot_RSS
 简介: TGBot_RSS 是一个灵活的利用TGBot信息推送订阅RSS的工具。
 探索更多：https://github.com/IonRh`, asciiArt)
-	logMessage("info", fmt.Sprintf(intro+"\n"))
+	logMessage("info", intro+"\n")
 	// 初始化日志系统
 	logMessage("info", "RSS Bot 启动中...")
 
@@ -873,8 +955,14 @@ func main() {
 		log.Fatal("初始化数据库失败:", err)
 	}
 
-	// 创建带代理的 HTTP 客户端
+	// 写入配置文件中的用户角色
+	if err := seedRoles(globalConfig); err != nil {
+		log.Fatal("写入用户角色失败:", err)
+	}
+
+	// 创建带代理的 HTTP 客户端，并统计发送失败的次数
 	client := createHTTPClient(globalConfig.ProxyURL)
+	client.Transport = newTelegramMetricsTransport(client.Transport)
 
 	// 使用自定义客户端创建 Telegram Bot API 客户端
 	bot, err = tgbotapi.NewBotAPIWithClient(globalConfig.BotToken, tgbotapi.APIEndpoint, client)
@@ -891,12 +979,38 @@ func main() {
 	databaseOperator = NewDatabaseOperator(db)
 	actionHandler = NewUserActionHandler(messageSender, databaseOperator)
 
+	// 注册命令补全
+	go registerBotCommands()
+
 	// 启动RSS监控协程
 	go startRSSMonitor()
 
+	// 启动免打扰补发协程
+	go startDeferredDelivery()
+
+	// 启动摘要定时发送协程
+	go startDigestScheduler()
+
+	// 启动HTTP服务（管理API等）
+	go startHTTPServer()
+
+	// 启动自检协程
+	go startWatchdog()
+
+	// Webhook 模式下由内置服务接收更新
+	if webhookEnabled() {
+		if err := runWebhook(globalConfig.Webhook); err != nil {
+			log.Fatal("Webhook 模式运行失败:", err)
+		}
+		return
+	}
+
+	// 长轮询与 Webhook 不能同时使用，清除上次遗留的 Webhook
+	clearStaleWebhook()
+
 	// 配置更新获取参数
 	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	u.Timeout = longPollTimeoutSeconds
 
 	// 获取更新通道
 	updates := bot.GetUpdatesChan(u)
@@ -904,27 +1018,42 @@ func main() {
 	// 处理消息更新
 	//logMessage("info", "开始处理消息...")
 	for update := range updates {
-		go func(update tgbotapi.Update) {
-			// 异常恢复处理
-			defer func() {
-				if r := recover(); r != nil {
-					logMessage("error", fmt.Sprintf("处理更新时发生panic: %v", r))
-				}
-			}()
+		go dispatchUpdate(update)
+	}
+}
 
-			// 根据更新类型分发处理
-			if update.Message != nil {
-				handleMessage(update.Message)
-			} else if update.CallbackQuery != nil {
-				handleCallbackQuery(update.CallbackQuery)
-			}
-		}(update)
+// dispatchUpdate 根据更新类型分发处理，长轮询和 Webhook 共用
+func dispatchUpdate(update tgbotapi.Update) {
+	// 异常恢复处理
+	defer func() {
+		if r := recover(); r != nil {
+			logMessage("error", fmt.Sprintf("处理更新时发生panic: %v", r))
+		}
+	}()
+
+	// 根据更新类型分发处理
+	if update.Message != nil {
+		recordUserActivity(update.Message.From)
+		// 频道中只接收推送，不处理消息
+		if update.Message.Chat.IsPrivate() {
+			handleMessage(update.Message)
+		} else if isGroupChat(update.Message.Chat) {
+			handleGroupMessage(update.Message)
+		}
+	} else if update.CallbackQuery != nil {
+		recordUserActivity(update.CallbackQuery.From)
+		handleCallbackQuery(update.CallbackQuery)
+	} else if update.InlineQuery != nil {
+		recordUserActivity(update.InlineQuery.From)
+		handleInlineQuery(update.InlineQuery)
+	} else if update.MyChatMember != nil {
+		handleMyChatMember(update.MyChatMember)
 	}
 }
 
-// 处理普通消息
+// 处理普通消息，群组中的设置归属于群组，以会话ID作为用户ID
 func handleMessage(message *tgbotapi.Message) {
-	userID := message.From.ID
+	userID := message.Chat.ID
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -939,6 +1068,11 @@ func handleMessage(message *tgbotapi.Message) {
 		return
 	}
 
+	if ok, reason := checkAccess(accessCheckID(message), RoleUser); !ok {
+		sendMessage(userID, reason)
+		return
+	}
+
 	// 检查用户状态
 	state := getUserState(userID)
 	if state != nil {
@@ -973,13 +1107,25 @@ func handleMessage(message *tgbotapi.Message) {
 
 // 处理状态消息
 func handleStateMessage(message *tgbotapi.Message, state *UserState) {
-	userID := message.From.ID
+	userID := message.Chat.ID
 
 	switch state.Action {
 	case "add_keyword":
 		handleKeywordInput(message)
 	case "add_subscription":
 		handleSubscriptionInput(message)
+	case "set_timezone":
+		handleTimezoneInput(message)
+	case "set_quiet_hours":
+		handleQuietHoursInput(message)
+	case "set_digest_time":
+		handleDigestTimeInput(message)
+	case "add_destination":
+		handleDestinationInput(message)
+	case "set_destination_keywords":
+		handleDestinationKeywordInput(message, state)
+	case "set_destination_topic":
+		handleDestinationTopicInput(message, state)
 	default:
 		logMessage("warn", fmt.Sprintf("未知的用户状态: %s", state.Action), userID)
 		clearUserState(userID)
@@ -989,14 +1135,14 @@ func handleStateMessage(message *tgbotapi.Message, state *UserState) {
 
 // 处理关键词输入
 func handleKeywordInput(message *tgbotapi.Message) {
-	userID := message.From.ID
+	userID := message.Chat.ID
 	text := strings.TrimSpace(message.Text)
 	if text == "" {
 		messageSender.SendError(userID, 0, "❌ 请输入有效的关键词")
 		return
 	}
 
-	keywords := strings.Fields(text)
+	keywords := splitKeywordInput(text)
 	if len(keywords) == 0 {
 		messageSender.SendError(userID, 0, "❌ 请输入有效的关键词")
 		return
@@ -1007,7 +1153,7 @@ func handleKeywordInput(message *tgbotapi.Message) {
 
 // 处理订阅输入
 func handleSubscriptionInput(message *tgbotapi.Message) {
-	userID := message.From.ID
+	userID := message.Chat.ID
 	parts := strings.SplitN(strings.TrimSpace(message.Text), " ", 3)
 
 	if len(parts) != 3 {
@@ -1026,18 +1172,20 @@ func showMainMenu(userID int64, from string, messageID int) {
 		logMessage("error", fmt.Sprintf("获取用户统计失败: %v", err), userID)
 		stats = &UserStats{}
 	}
-	pushstats := GetPushStatsInfo()
+	pushstats := GetPushStatsInfo(userID)
 	menuText := fmt.Sprintf(`👋 欢迎使用 TGBot_RSS 订阅机器人！
 
 👥 %s(<code>%d</code>)：
 📰 订阅数：%d    🔍关键词数：%d
+%s
 
 %s
 1️⃣ 订阅管理：增加/删除/查看 RSS 源
 2️⃣ 关键词管理：增加/删除/查看 关键词
 
 请选择以下操作：`,
-		from, userID, stats.SubscriptionCount, stats.KeywordCount, pushstats)
+		from, userID, stats.SubscriptionCount, stats.KeywordCount,
+		formatQuotaUsage(userID, stats.SubscriptionCount, stats.KeywordCount), pushstats)
 
 	keyboard := createMainMenuKeyboard()
 	messageSender.SendHTMLResponse(userID, messageID, menuText, &keyboard)
@@ -1050,10 +1198,26 @@ func showHelp(userID int64, messageID int) {
 📰 TGBot_RSS 当前下载：%d 次
 📝 使用技巧：
 ● 关键词支持中英文，可用中、英逗号(,)分隔多个关键词
-● 可使用正则表达式进行高级匹配
+● /正则/标志 表示正则关键词，如 /rust\s*1\.\d+/i（i 忽略大小写）
 ● *可匹配任意字符，-关键词 表示屏蔽关键词
 ● 示例：你*帅*   可匹配 "你好帅呀！" 等
 ● 示例：-不喜欢  可屏蔽包含 "不喜欢" 的内容
+● !关键词 表示紧急关键词，免打扰时段内也会立即推送
+● 🎯 关键词范围 可限定关键词只对部分订阅生效
+● expr:表达式 支持 AND/OR/NOT、括号、"短语" 和 title:/body:/author:/category:/link: 字段
+● 示例：expr:title:(rust OR go) AND NOT body:招聘
+● [w]关键词 整词匹配，[c]关键词 区分大小写，可组合为 [wc]AI
+● A NEAR/n B 表示两个词之间最多相隔 n 个词，如 rust NEAR/3 async
+● 🔧 关键词详情 中可随时切换整词、大小写和 NEAR 距离
+● 📊 关键词统计 查看近7天/30天命中次数，可一键删除从未命中的关键词
+● py:拼音 表示拼音关键词，如 py:xianka 可匹配 "显卡"、"顯卡"
+● ⚙️ 个人设置 中开启简繁/全角归一后，显卡 可匹配 顯卡，RTX 可匹配 ＲＴＸ
+● ⚙️ 个人设置 → 🔁 跨订阅去重：同一新闻在多个订阅出现时只推送一次
+● ⚙️ 个人设置 → 📢 群组/频道推送：把订阅转发到你管理的群组或频道，开启话题的群组可按订阅或关键词发到不同话题
+● /snooze 2h 暂停推送2小时，/snooze off 恢复推送
+● 命令：/sub URL [名称] [full|link]、/unsub 名称、/subs、/kw add|del|list、/mode、/pause、/resume，参数含空格时用引号括起来
+● /apikey new 生成管理 API 的密钥，可在内部工具中管理订阅和关键词
+● 把 Bot 拉进群组后，群组管理员可在群里使用 /start 为群组单独管理订阅
 
 📦 源码仓库: github.com/IonRh/TGBot_RSS
 🔧 问题反馈: https://t.me/IonMagic`, count)
@@ -1065,19 +1229,31 @@ func showHelp(userID int64, messageID int) {
 // handleCommand 处理命令消息
 // 根据命令类型执行相应操作
 func handleCommand(message *tgbotapi.Message) {
-	userID := message.From.ID
-	//fmt.Println(globalConfig.ADMINIDS)
-	if userID == globalConfig.ADMINIDS {
-		logMessage("debug", fmt.Sprintf("管理员用户使用命令: %s", message.Command()), userID)
-	} else if globalConfig.ADMINIDS == 0 {
-		logMessage("debug", fmt.Sprintf("全用户可用，用户尝试使用命令: %s", message.Command()), userID)
-	} else {
-		logMessage("warn", fmt.Sprintf("非管理员用户尝试使用命令: %s", message.Command()), userID)
-		sendMessage(userID, "你没有权限使用此命令")
+	userID := message.Chat.ID
+	command := message.Command()
+
+	// 没有权限的新用户可以通过 /start 兑换邀请码或提交申请
+	if command == "start" && handleRegistration(message) {
 		return
 	}
-	from := message.From.FirstName + " " + message.From.LastName
-	command := message.Command()
+
+	if rejectsAnonymousAdmin(message, command) {
+		sendMessage(userID, "❌ 匿名管理员无法使用管理命令，请关闭匿名身份后重试")
+		return
+	}
+
+	// 按发送者本人的角色检查权限，匿名管理员按群组的角色检查
+	required, ok := commandRoles[command]
+	if !ok {
+		required = RoleUser
+	}
+	accessID := accessCheckID(message)
+	if ok, reason := checkAccess(accessID, required); !ok {
+		logMessage("warn", fmt.Sprintf("用户 %d 无权使用命令: %s", accessID, command), userID)
+		sendMessage(userID, reason)
+		return
+	}
+	from := chatDisplayName(message.Chat, message.From)
 
 	logMessage("debug", fmt.Sprintf("收到命令: %s", command), userID)
 
@@ -1085,6 +1261,8 @@ func handleCommand(message *tgbotapi.Message) {
 	case "start":
 		// 清除可能的旧状态
 		clearUserState(userID)
+		// 首次使用时初始化时区等设置
+		initUserSettingsIfNeeded(userID, message.From.LanguageCode)
 		// 发送欢迎消息和主菜单
 		showMainMenu(userID, from, 0)
 
@@ -1092,6 +1270,78 @@ func handleCommand(message *tgbotapi.Message) {
 		// 发送帮助信息
 		showHelp(userID, 0)
 
+	case "snooze":
+		// 暂停推送
+		handleSnoozeCommand(userID, message.CommandArguments())
+
+	case "sub":
+		// 添加订阅
+		handleSubCommand(userID, message)
+
+	case "unsub":
+		// 取消订阅
+		handleUnsubCommand(userID, message)
+
+	case "subs":
+		// 查看订阅
+		actionHandler.viewSubscriptions(userID, 0)
+
+	case "kw":
+		// 管理关键词
+		handleKeywordCommand(userID, message)
+
+	case "mode":
+		// 设置推送方式
+		handleModeCommand(userID, message)
+
+	case "pause":
+		// 暂停推送，不指定时长时直到手动恢复
+		handlePauseCommand(userID, message.CommandArguments())
+
+	case "resume":
+		// 恢复推送
+		handleResumeCommand(userID)
+
+	case "apikey":
+		// 管理API密钥
+		handleAPIKeyCommand(userID, message)
+
+	case "role":
+		// 查看或修改用户角色
+		handleRoleCommand(userID, message.From.ID, message.CommandArguments())
+
+	case "invite":
+		// 管理邀请码
+		handleInviteCommand(userID, message.From.ID, message.CommandArguments())
+
+	case "pending":
+		// 查看等待审核的申请
+		handlePendingCommand(userID)
+
+	case "quota":
+		// 查看或设置用户配额
+		handleQuotaCommand(userID, message.From.ID, message.CommandArguments())
+
+	case "users":
+		// 查看用户列表
+		handleUsersCommand(userID)
+
+	case "broadcast":
+		// 向所有活跃用户群发通知
+		handleBroadcastCommand(userID, message.From.ID, message.CommandArguments())
+
+	case "ban", "unban":
+		// 封禁或解封用户
+		handleBanCommand(userID, message.From.ID, message.CommandArguments(), command == "ban")
+
+	case "feeds":
+		// 查看所有订阅源的状态
+		handleFeedsCommand(userID)
+
+	case "aistats":
+		// 查看AI使用统计
+		handleAIStatsCommand(userID, message.CommandArguments())
+
 	// 可添加更多命令处理
 	default:
 		// 未知命令
@@ -1103,10 +1353,22 @@ func handleCommand(message *tgbotapi.Message) {
 // 处理来自内联键盘按钮的点击
 func handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	userID := callbackQuery.From.ID
-	from := callbackQuery.From.FirstName + " " + callbackQuery.From.LastName
+	from := chatDisplayName(callbackQuery.Message.Chat, callbackQuery.From)
 	data := callbackQuery.Data
 	messageID := callbackQuery.Message.MessageID
 
+	// 群组中的菜单只允许群组管理员操作，设置归属于群组
+	if chat := callbackQuery.Message.Chat; isGroupChat(chat) {
+		if !isGroupAdmin(chat.ID, callbackQuery.From.ID) {
+			alert := tgbotapi.NewCallbackWithAlert(callbackQuery.ID, "只有群组管理员可以修改本群的设置")
+			if _, err := bot.Request(alert); err != nil {
+				logMessage("error", fmt.Sprintf("回应回调查询失败: %v", err), userID)
+			}
+			return
+		}
+		userID = chat.ID
+	}
+
 	// 异常恢复处理
 	defer func() {
 		if r := recover(); r != nil {
@@ -1114,6 +1376,16 @@ func handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 		}
 	}()
 
+	// 按点击者本人的角色检查权限
+	if ok, reason := checkAccess(callbackQuery.From.ID, callbackRequiredRole(data)); !ok {
+		logMessage("warn", fmt.Sprintf("用户 %d 无权执行操作: %s", callbackQuery.From.ID, data), userID)
+		alert := tgbotapi.NewCallbackWithAlert(callbackQuery.ID, reason)
+		if _, err := bot.Request(alert); err != nil {
+			logMessage("error", fmt.Sprintf("回应回调查询失败: %v", err), userID)
+		}
+		return
+	}
+
 	// 回应回调查询以停止按钮加载动画
 	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
 	if _, err := bot.Request(callback); err != nil {
@@ -1121,7 +1393,7 @@ func handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	}
 
 	// 清除用户状态（除非是需要输入的操作）
-	if data != "add_keyword" && data != "add_subscription" {
+	if !inputPromptCallbacks[data] {
 		clearUserState(userID)
 	}
 
@@ -1151,10 +1423,116 @@ func handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	case data == "help":
 		showHelp(userID, messageID)
 
+	case data == "settings":
+		showSettingsMenu(userID, messageID)
+
+	case data == "set_timezone":
+		showTimezonePrompt(userID, messageID)
+
+	case data == "set_datefmt":
+		showDateFormatOptions(userID, messageID)
+
+	case strings.HasPrefix(data, "set_tz_"):
+		setUserTimezone(userID, messageID, strings.TrimPrefix(data, "set_tz_"))
+
+	case strings.HasPrefix(data, "set_datefmt_"):
+		index, _ := strconv.Atoi(strings.TrimPrefix(data, "set_datefmt_"))
+		setUserDateFormat(userID, messageID, index)
+
+	case data == "set_quiet_hours":
+		showQuietHoursPrompt(userID, messageID)
+
+	case data == "quiet_off":
+		setQuietHours(userID, messageID, "off")
+
+	case data == "snooze_menu":
+		showSnoozeMenu(userID, messageID)
+
+	case strings.HasPrefix(data, "snooze_"):
+		handleSnoozeCallback(userID, messageID, strings.TrimPrefix(data, "snooze_"))
+
+	case data == "delivery_menu":
+		showDeliveryMenu(userID, messageID)
+
+	case strings.HasPrefix(data, "set_delivery_"):
+		handleDeliveryModeCallback(userID, messageID, strings.TrimPrefix(data, "set_delivery_"))
+
+	case data == "set_digest_time":
+		showDigestTimePrompt(userID, messageID)
+
+	case strings.HasPrefix(data, "set_digest_wd_"):
+		weekday, _ := strconv.Atoi(strings.TrimPrefix(data, "set_digest_wd_"))
+		setDigestWeekday(userID, messageID, weekday)
+
+	case data == "toggle_digest_ai":
+		toggleDigestAIOverview(userID, messageID)
+
+	case strings.HasPrefix(data, "dest_"):
+		handleDestinationCallback(userID, messageID, strings.TrimPrefix(data, "dest_"))
+	case data == "dedup_menu":
+		showDedupMenu(userID, messageID)
+	case strings.HasPrefix(data, "set_dedup_"):
+		handleDedupCallback(userID, messageID, strings.TrimPrefix(data, "set_dedup_"))
+	case data == "toggle_text_folding":
+		toggleTextFolding(userID, messageID)
+
+	case data == "sub_delivery_list":
+		showSubscriptionDeliveryList(userID, messageID)
+
+	case strings.HasPrefix(data, "sub_delivery_"):
+		subID, _ := strconv.Atoi(strings.TrimPrefix(data, "sub_delivery_"))
+		showSubscriptionDeliveryOptions(userID, messageID, subID)
+
+	case strings.HasPrefix(data, "sub_recv_"):
+		handleReceiveAllCallback(userID, messageID, strings.TrimPrefix(data, "sub_recv_"))
+	case strings.HasPrefix(data, "set_sub_delivery_"):
+		handleSubscriptionDeliveryCallback(userID, messageID, strings.TrimPrefix(data, "set_sub_delivery_"))
+
+	case data == "kw_scope_list":
+		showKeywordScopeList(userID, messageID)
+
+	case strings.HasPrefix(data, "kw_scope_t_"), strings.HasPrefix(data, "kw_scope_g_"):
+		handleKeywordScopeCallback(userID, messageID, strings.TrimPrefix(data, "kw_scope_"))
+
+	case strings.HasPrefix(data, "kw_scope_"):
+		showKeywordScopeOptions(userID, messageID, strings.TrimPrefix(data, "kw_scope_"))
+
+	case data == "kw_detail_list":
+		showKeywordDetailList(userID, messageID)
+
+	case strings.HasPrefix(data, "kw_detail_"):
+		showKeywordDetail(userID, messageID, strings.TrimPrefix(data, "kw_detail_"))
+
+	case strings.HasPrefix(data, "kw_mod_"):
+		handleKeywordModifierCallback(userID, messageID, strings.TrimPrefix(data, "kw_mod_"))
+
+	case strings.HasPrefix(data, "kw_near_"):
+		handleKeywordModifierCallback(userID, messageID, strings.TrimPrefix(data, "kw_near_"))
+
+	case data == "kw_stats":
+		showKeywordStats(userID, messageID)
+
+	case strings.HasPrefix(data, "kw_dead_"):
+		handleDeadKeywordCallback(userID, messageID, strings.TrimPrefix(data, "kw_dead_"))
+
 	case strings.HasPrefix(data, "del_kw_"):
-		keyword := strings.TrimPrefix(data, "del_kw_")
+		// 关键词可能超过回调数据的长度限制，按钮中使用短ID
+		keyword, err := findKeywordByHashID(userID, strings.TrimPrefix(data, "del_kw_"))
+		if err != nil {
+			messageSender.SendError(userID, messageID, "❌ 关键词不存在")
+			return
+		}
 		actionHandler.HandleAction(userID, messageID, "keyword", "delete", keyword)
 
+	case strings.HasPrefix(data, "reg_"):
+		handleRegistrationCallback(userID, messageID, callbackQuery.From.ID, strings.TrimPrefix(data, "reg_"))
+
+	case strings.HasPrefix(data, "role_"):
+		handleRoleCallback(userID, messageID, callbackQuery.From.ID, strings.TrimPrefix(data, "role_"))
+
+	case strings.HasPrefix(data, "bc_"):
+		handleBroadcastCallback(userID, messageID, callbackQuery.From.ID, strings.TrimPrefix(data, "bc_"))
+
 	case strings.HasPrefix(data, "del_sub_"):
 		subscription := strings.TrimPrefix(data, "del_sub_")
 		actionHandler.HandleAction(userID, messageID, "subscription", "delete", subscription)
@@ -1165,6 +1543,16 @@ func handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	}
 }
 
+// inputPromptCallbacks 需要等待用户输入的回调，点击时不清除用户状态
+var inputPromptCallbacks = map[string]bool{
+	"add_keyword":      true,
+	"add_subscription": true,
+	"set_timezone":     true,
+	"set_quiet_hours":  true,
+	"set_digest_time":  true,
+	"dest_add":         true,
+}
+
 // createMainMenuKeyboard 创建主菜单键盘
 // 返回带有所有功能按钮的内联键盘
 func createMainMenuKeyboard() tgbotapi.InlineKeyboardMarkup {
@@ -1176,6 +1564,11 @@ func createMainMenuKeyboard() tgbotapi.InlineKeyboardMarkup {
 		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🗑️ 删除关键词", "delete_keyword"),
+			tgbotapi.NewInlineKeyboardButtonData("🎯 关键词范围", "kw_scope_list"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔧 关键词详情", "kw_detail_list"),
+			tgbotapi.NewInlineKeyboardButtonData("📊 关键词统计", "kw_stats"),
 		),
 		// 订阅管理行
 		tgbotapi.NewInlineKeyboardRow(
@@ -1186,6 +1579,9 @@ func createMainMenuKeyboard() tgbotapi.InlineKeyboardMarkup {
 			tgbotapi.NewInlineKeyboardButtonData("🗑️ 删除订阅", "delete_subscription"),
 			tgbotapi.NewInlineKeyboardButtonData("ℹ️ 关于", "help"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⚙️ 个人设置", "settings"),
+		),
 	)
 }
 
@@ -1194,31 +1590,41 @@ func createMainMenuKeyboard() tgbotapi.InlineKeyboardMarkup {
 // sendMessage 发送普通文本消息
 func sendMessage(userID int64, text string) {
 	msg := tgbotapi.NewMessage(userID, text)
+	applyGroupReplyTarget(&msg.BaseChat)
 	if _, err := bot.Send(msg); err != nil {
 		logMessage("error", fmt.Sprintf("发送消息失败: %v", err), userID)
 	}
 }
 
-// sendHTMLMessage 发送HTML格式的消息
-func sendHTMLMessage(userID int64, text string) {
+// sendHTMLMessage 发送HTML格式的消息，返回已发送的消息
+func sendHTMLMessage(userID int64, text string) (tgbotapi.Message, error) {
 	msg := tgbotapi.NewMessage(userID, text)
 	msg.ParseMode = "HTML" // 设置解析模式为HTML
-	if _, err := bot.Send(msg); err != nil {
+	sent, err := bot.Send(msg)
+	if err != nil {
 		logMessage("error", fmt.Sprintf("发送HTML消息失败: %v", err), userID)
 	}
+	return sent, err
 }
 
-func sendPhotoMessage(userID int64, photoURL, caption string) {
+// sendPhotoMessage 发送图片消息，失败时改为发送文本，返回已发送的消息
+func sendPhotoMessage(userID int64, photoURL, caption string) (tgbotapi.Message, error) {
 	msg := tgbotapi.NewPhoto(userID, tgbotapi.FileURL(photoURL))
 	msg.Caption = caption
 	msg.ParseMode = "HTML" // 支持在说明文字中使用HTML格式
 
-	if _, err := bot.Send(msg); err != nil {
+	sent, err := bot.Send(msg)
+	if err != nil {
 		logMessage("error", fmt.Sprintf("发送图片消息失败: %v", err), userID)
 		// 如果发送图片失败，尝试发送纯文本消息
-		fallbackMsg := fmt.Sprintf("图片: %s\n\n%s", photoURL, caption)
-		sendHTMLMessage(userID, fallbackMsg)
+		return sendHTMLMessage(userID, photoFallbackText(photoURL, caption))
 	}
+	return sent, nil
+}
+
+// photoFallbackText 图片发送失败时改发的文本
+func photoFallbackText(photoURL, caption string) string {
+	return fmt.Sprintf("图片: %s\n\n%s", photoURL, caption)
 }
 
 // 数据库操作函数
@@ -1239,7 +1645,182 @@ func initDatabase() error {
 		"feed_data": `CREATE TABLE IF NOT EXISTS feed_data (
 			rss_name TEXT PRIMARY KEY,                         -- 订阅名称
 			last_update_time TEXT, -- 最后更新时间
-			latest_title TEXT DEFAULT ''                      -- 最新文章标题
+			latest_title TEXT DEFAULT '',                     -- 最新文章标题
+			last_check_at TEXT DEFAULT '',                    -- 最近一次检查时间（UTC）
+			last_error TEXT DEFAULT '',                       -- 最近一次检查的错误
+			fail_count INTEGER DEFAULT 0                      -- 连续失败次数
+		)`,
+		"user_settings": `CREATE TABLE IF NOT EXISTS user_settings (
+			user_id INTEGER PRIMARY KEY,                      -- 用户ID
+			timezone TEXT DEFAULT '',                         -- IANA时区名称，空表示使用默认
+			date_format TEXT DEFAULT '',                      -- 时间格式，空表示使用默认
+			quiet_start TEXT DEFAULT '',                      -- 免打扰开始时间 HH:MM
+			quiet_end TEXT DEFAULT '',                        -- 免打扰结束时间 HH:MM
+			snooze_until TIMESTAMP,                           -- 暂停推送截止时间
+			delivery_mode TEXT DEFAULT 'instant',             -- 推送方式 instant/hourly/daily/weekly
+			digest_time TEXT DEFAULT '08:00',                 -- 摘要发送时间 HH:MM
+			digest_weekday INTEGER DEFAULT 1,                 -- 每周摘要发送日(0=周日)
+			digest_ai_overview BOOLEAN DEFAULT FALSE,         -- 摘要是否附带AI概览
+			text_folding BOOLEAN DEFAULT FALSE,               -- 关键词匹配是否做简繁/全角归一
+			dedup_window INTEGER DEFAULT 0,                   -- 跨订阅去重窗口（小时），0表示关闭
+			dedup_mode TEXT DEFAULT 'fold',                   -- 去重方式 fold/drop
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,   -- 创建时间
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 更新时间
+		)`,
+		"deferred_pushes": `CREATE TABLE IF NOT EXISTS deferred_pushes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,             -- 记录ID
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			rss_name TEXT NOT NULL,                           -- 订阅名称
+			content TEXT NOT NULL,                            -- 已格式化的推送内容
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 暂存时间
+		)`,
+		"user_keyword_scopes": `CREATE TABLE IF NOT EXISTS user_keyword_scopes (
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			keyword TEXT NOT NULL,                            -- 关键词（含屏蔽词）
+			rss_name TEXT NOT NULL,                           -- 生效的订阅名称，无记录表示全局生效，空字符串表示不对任何订阅生效
+			PRIMARY KEY (user_id, keyword, rss_name)
+		)`,
+		"keyword_hits": `CREATE TABLE IF NOT EXISTS keyword_hits (
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			keyword TEXT NOT NULL,                            -- 关键词原文（含前缀）
+			rss_name TEXT NOT NULL,                           -- 订阅名称
+			day TEXT NOT NULL,                                -- 日期 YYYY-MM-DD（UTC）
+			matched INTEGER DEFAULT 0,                        -- 命中次数
+			blocked INTEGER DEFAULT 0,                        -- 屏蔽词拦截次数
+			last_hit_at TIMESTAMP,                            -- 当天最后命中时间
+			PRIMARY KEY (user_id, keyword, rss_name, day)
+		)`,
+		"keyword_hit_totals": `CREATE TABLE IF NOT EXISTS keyword_hit_totals (
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			keyword TEXT NOT NULL,                            -- 关键词原文（含前缀）
+			matched INTEGER DEFAULT 0,                        -- 累计命中次数
+			blocked INTEGER DEFAULT 0,                        -- 累计拦截次数
+			last_hit_at TIMESTAMP,                            -- 最后命中时间
+			tracked_since TIMESTAMP,                          -- 开始统计的时间
+			PRIMARY KEY (user_id, keyword)
+		)`,
+		"push_history": `CREATE TABLE IF NOT EXISTS push_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,             -- 记录ID
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			rss_name TEXT NOT NULL,                           -- 首次推送的订阅名称
+			link_key TEXT DEFAULT '',                         -- 规范化后的原文链接
+			canonical_key TEXT DEFAULT '',                    -- 规范化后的canonical地址
+			title_norm TEXT DEFAULT '',                       -- 归一化后的标题
+			message_id INTEGER DEFAULT 0,                     -- 已发送的消息ID，0表示未即时发送
+			is_photo BOOLEAN DEFAULT FALSE,                   -- 是否为图片消息
+			content TEXT DEFAULT '',                          -- 已发送的消息内容
+			also_seen TEXT DEFAULT '[]',                      -- 重复出现的其他订阅，JSON格式
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 推送时间（UTC）
+		)`,
+		"destinations": `CREATE TABLE IF NOT EXISTS destinations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,             -- 推送目标ID
+			owner_id INTEGER NOT NULL,                        -- 所有者用户ID
+			chat_id INTEGER NOT NULL,                         -- 群组/频道ID
+			chat_type TEXT DEFAULT '',                        -- 会话类型 group/supergroup/channel
+			title TEXT DEFAULT '',                            -- 会话名称
+			active BOOLEAN DEFAULT TRUE,                      -- 是否启用，Bot被移出时停用
+			format TEXT DEFAULT 'follow',                     -- 推送格式 follow/full/link
+			keyword_mode TEXT DEFAULT 'owner',                -- 关键词方式 owner/custom/all
+			keywords TEXT DEFAULT '[]',                       -- 单独的关键词，JSON格式
+			is_forum BOOLEAN DEFAULT FALSE,                   -- 是否为开启话题的超级群组
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,   -- 添加时间
+			UNIQUE (owner_id, chat_id)
+		)`,
+		"destination_routes": `CREATE TABLE IF NOT EXISTS destination_routes (
+			destination_id INTEGER NOT NULL,                  -- 推送目标ID
+			rss_name TEXT NOT NULL,                           -- 转发的订阅名称
+			PRIMARY KEY (destination_id, rss_name)
+		)`,
+		"user_roles": `CREATE TABLE IF NOT EXISTS user_roles (
+			user_id INTEGER PRIMARY KEY,                      -- 用户ID
+			role TEXT NOT NULL,                               -- 角色 owner/admin/user/banned
+			updated_by INTEGER DEFAULT 0,                     -- 设置者用户ID，0表示配置文件
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 更新时间
+		)`,
+		"user_quotas": `CREATE TABLE IF NOT EXISTS user_quotas (
+			user_id INTEGER PRIMARY KEY,                      -- 用户ID
+			subscriptions INTEGER,                            -- 订阅数量上限，NULL表示使用默认配额
+			keywords INTEGER,                                 -- 关键词数量上限
+			ai_translate_daily INTEGER,                       -- 每日AI翻译次数上限
+			ai_summarize_daily INTEGER,                       -- 每日AI摘要次数上限
+			min_poll_minutes INTEGER,                         -- 订阅最小轮询间隔(分钟)
+			updated_by INTEGER DEFAULT 0,                     -- 设置者用户ID
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 更新时间
+		)`,
+		"user_ai_usage": `CREATE TABLE IF NOT EXISTS user_ai_usage (
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			date TEXT NOT NULL,                               -- 日期 YYYY-MM-DD
+			translate_count INTEGER DEFAULT 0,                -- 翻译次数
+			summarize_count INTEGER DEFAULT 0,                -- 摘要次数
+			PRIMARY KEY (user_id, date)
+		)`,
+		"recent_items": `CREATE TABLE IF NOT EXISTS recent_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,             -- 记录ID
+			rss_name TEXT NOT NULL,                           -- 订阅名称
+			title TEXT DEFAULT '',                            -- 标题
+			link TEXT DEFAULT '',                             -- 原文链接
+			description TEXT DEFAULT '',                      -- 内容
+			pub_date TEXT DEFAULT '',                         -- 发布时间（UTC）
+			fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,   -- 抓取时间（UTC）
+			UNIQUE (rss_name, link)
+		)`,
+		"api_keys": `CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,             -- 密钥ID
+			user_id INTEGER NOT NULL,                         -- 所属用户ID
+			name TEXT DEFAULT '',                             -- 密钥名称
+			key_hash TEXT NOT NULL UNIQUE,                    -- 密钥的SHA-256
+			hint TEXT DEFAULT '',                             -- 密钥末尾几位，用于识别
+			created_at TEXT DEFAULT '',                       -- 创建时间（UTC）
+			last_used_at TEXT DEFAULT ''                      -- 最近使用时间（UTC）
+		)`,
+		"user_activity": `CREATE TABLE IF NOT EXISTS user_activity (
+			user_id INTEGER PRIMARY KEY,                      -- 用户ID
+			username TEXT DEFAULT '',                         -- 用户名
+			name TEXT DEFAULT '',                             -- 名称
+			last_active_at TEXT DEFAULT ''                    -- 最近活跃时间（UTC）
+		)`,
+		"invite_codes": `CREATE TABLE IF NOT EXISTS invite_codes (
+			code TEXT PRIMARY KEY,                            -- 邀请码
+			created_by INTEGER NOT NULL,                      -- 创建者用户ID
+			max_uses INTEGER DEFAULT 1,                       -- 可使用次数
+			used_count INTEGER DEFAULT 0,                     -- 已使用次数
+			expires_at TEXT DEFAULT '',                       -- 过期时间（UTC），空表示永久有效
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 创建时间
+		)`,
+		"user_applications": `CREATE TABLE IF NOT EXISTS user_applications (
+			user_id INTEGER PRIMARY KEY,                      -- 申请人用户ID
+			username TEXT DEFAULT '',                         -- 申请人用户名
+			name TEXT DEFAULT '',                             -- 申请人名称
+			status TEXT DEFAULT 'pending',                    -- 状态 pending/approved/denied
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,   -- 申请时间
+			handled_by INTEGER DEFAULT 0,                     -- 审核人用户ID
+			handled_at TIMESTAMP                              -- 审核时间
+		)`,
+		"destination_topics": `CREATE TABLE IF NOT EXISTS destination_topics (
+			destination_id INTEGER NOT NULL,                  -- 推送目标ID
+			kind TEXT NOT NULL,                               -- 路由类型 default/sub/kw
+			route_key TEXT NOT NULL DEFAULT '',               -- 订阅名称或关键词，默认话题为空
+			topic_name TEXT DEFAULT '',                       -- 话题名称，用于自动创建
+			thread_id INTEGER DEFAULT 0,                      -- 话题ID，0表示尚未创建
+			PRIMARY KEY (destination_id, kind, route_key)
+		)`,
+		"user_subscription_settings": `CREATE TABLE IF NOT EXISTS user_subscription_settings (
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			rss_name TEXT NOT NULL,                           -- 订阅名称
+			delivery_mode TEXT DEFAULT '',                    -- 推送方式，空表示跟随用户默认
+			receive_all BOOLEAN DEFAULT FALSE,                -- 是否全量推送，不需要命中关键词
+			PRIMARY KEY (user_id, rss_name)
+		)`,
+		"digest_items": `CREATE TABLE IF NOT EXISTS digest_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,             -- 记录ID
+			user_id INTEGER NOT NULL,                         -- 用户ID
+			mode TEXT NOT NULL,                               -- 推送方式 hourly/daily/weekly
+			rss_name TEXT NOT NULL,                           -- 订阅名称
+			keywords TEXT DEFAULT '[]',                       -- 匹配到的关键词，JSON格式
+			title TEXT DEFAULT '',                            -- 文章标题
+			link TEXT DEFAULT '',                             -- 文章链接
+			pub_date TIMESTAMP,                               -- 发布时间
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP    -- 入队时间
 		)`,
 		"user_ai_preferences": `CREATE TABLE IF NOT EXISTS user_ai_preferences (
 			user_id INTEGER PRIMARY KEY,                      -- 用户ID
@@ -1285,11 +1866,49 @@ func initDatabase() error {
 		logMessage("debug", fmt.Sprintf("数据库表 %s 已创建或已存在", name))
 	}
 
+	// 补充旧版本数据库缺少的列
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{table: "user_settings", column: "quiet_start", definition: "TEXT DEFAULT ''"},
+		{table: "user_settings", column: "quiet_end", definition: "TEXT DEFAULT ''"},
+		{table: "user_settings", column: "snooze_until", definition: "TIMESTAMP"},
+		{table: "user_settings", column: "delivery_mode", definition: "TEXT DEFAULT 'instant'"},
+		{table: "user_settings", column: "digest_time", definition: "TEXT DEFAULT '08:00'"},
+		{table: "user_settings", column: "digest_weekday", definition: "INTEGER DEFAULT 1"},
+		{table: "user_settings", column: "digest_ai_overview", definition: "BOOLEAN DEFAULT FALSE"},
+		{table: "user_settings", column: "text_folding", definition: "BOOLEAN DEFAULT FALSE"},
+		{table: "user_subscription_settings", column: "receive_all", definition: "BOOLEAN DEFAULT FALSE"},
+		{table: "user_settings", column: "dedup_window", definition: "INTEGER DEFAULT 0"},
+		{table: "user_settings", column: "dedup_mode", definition: "TEXT DEFAULT 'fold'"},
+		{table: "destinations", column: "is_forum", definition: "BOOLEAN DEFAULT FALSE"},
+		{table: "feed_data", column: "last_check_at", definition: "TEXT DEFAULT ''"},
+		{table: "feed_data", column: "last_error", definition: "TEXT DEFAULT ''"},
+		{table: "feed_data", column: "fail_count", definition: "INTEGER DEFAULT 0"},
+		{table: "keyword_hit_totals", column: "tracked_since", definition: "TIMESTAMP"},
+	}
+
+	for _, col := range columns {
+		if err := ensureColumn(col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("添加列 %s.%s 失败: %v", col.table, col.column, err)
+		}
+	}
+
 	// 索引定义
 	indexes := []struct {
 		name string
 		sql  string
 	}{
+		{
+			name: "idx_destinations_chat",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_destinations_chat ON destinations(chat_id)",
+		},
+		{
+			name: "idx_push_history_user_time",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_push_history_user_time ON push_history(user_id, created_at)",
+		},
 		{
 			name: "idx_subscriptions_users",
 			sql:  "CREATE INDEX IF NOT EXISTS idx_subscriptions_users ON subscriptions(users)",
@@ -1310,10 +1929,30 @@ func initDatabase() error {
 			name: "idx_ai_processing_records_created",
 			sql:  "CREATE INDEX IF NOT EXISTS idx_ai_processing_records_created ON ai_processing_records(created_at)",
 		},
+		{
+			name: "idx_deferred_pushes_user",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_deferred_pushes_user ON deferred_pushes(user_id)",
+		},
+		{
+			name: "idx_digest_items_user_mode",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_digest_items_user_mode ON digest_items(user_id, mode)",
+		},
 		{
 			name: "idx_ai_usage_stats_date",
 			sql:  "CREATE INDEX IF NOT EXISTS idx_ai_usage_stats_date ON ai_usage_stats(date)",
 		},
+		{
+			name: "idx_keyword_hits_day",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_keyword_hits_day ON keyword_hits(day)",
+		},
+		{
+			name: "idx_recent_items_name_date",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_recent_items_name_date ON recent_items(rss_name, pub_date)",
+		},
+		{
+			name: "idx_api_keys_user",
+			sql:  "CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id)",
+		},
 	}
 
 	// 创建索引
@@ -1333,6 +1972,36 @@ func initDatabase() error {
 	return nil
 }
 
+// ensureColumn 检查表中是否存在指定列，不存在则添加
+func ensureColumn(table, column, definition string) error {
+	return withDB(func(db *sql.DB) error {
+		rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var cid, notNull, pk int
+			var name, colType string
+			var defaultValue sql.NullString
+			if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+				return err
+			}
+			if name == column {
+				return nil
+			}
+		}
+		rows.Close()
+
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+		if err == nil {
+			logMessage("info", fmt.Sprintf("数据库表 %s 已添加列 %s", table, column))
+		}
+		return err
+	})
+}
+
 func getKeywordsForUser(userID int64) ([]string, error) {
 	var keywordsStr string
 	var keywords []string
@@ -1371,6 +2040,11 @@ func addKeywordsForUser(userID int64, newKeywords []string) (string, error) {
 	// 处理逗号分隔的关键词
 	var processedKeywords []string
 	for _, k := range newKeywords {
+		// 表达式和正则中的逗号属于关键词本身，不做拆分
+		if isWholeKeyword(k) {
+			processedKeywords = append(processedKeywords, strings.TrimSpace(k))
+			continue
+		}
 		// 替换中式逗号为美式逗号
 		k = strings.ReplaceAll(k, "，", ",")
 		// 按逗号分割
@@ -1388,18 +2062,30 @@ func addKeywordsForUser(userID int64, newKeywords []string) (string, error) {
 		}
 	}
 
+	// 校验表达式和正则语法，有错误时不添加任何关键词
+	if problems := validateKeywordSyntax(processedKeywords); len(problems) > 0 {
+		return "", newUserError(UserErrorInvalid, "以下关键词有误，未添加任何关键词：\n\n%s", strings.Join(problems, "\n"))
+	}
+
 	// 添加新关键词并去重
-	var addedCount int
+	var addedKeywords []string
 	for _, k := range processedKeywords {
 		if !keywordMap[k] {
 			keywordMap[k] = true
-			addedCount++
+			addedKeywords = append(addedKeywords, k)
 		}
 	}
+	addedCount := len(addedKeywords)
 
 	// 如果没有新增关键词
 	if addedCount == 0 {
-		return "❌ 没有新增关键词，可能全部已存在", nil
+		return "", newUserError(UserErrorConflict, "没有新增关键词，可能全部已存在")
+	}
+
+	// 检查关键词数量配额
+	if limit := getUserQuota(userID).Keywords; limit > 0 && len(keywordMap) > limit {
+		return "", newUserError(UserErrorQuota, "关键词数量超出上限（%d），当前已有 %d 个，最多还能添加 %d 个，未添加任何关键词",
+			limit, len(existingKeywords), max(limit-len(existingKeywords), 0))
 	}
 
 	// 将map转换回slice
@@ -1442,6 +2128,13 @@ func addKeywordsForUser(userID int64, newKeywords []string) (string, error) {
 		return "", err
 	}
 
+	// 新关键词从添加时开始统计命中情况
+	if err := withDB(func(db *sql.DB) error {
+		return trackKeywords(db, userID, addedKeywords, time.Now().UTC())
+	}); err != nil {
+		logMessage("warn", fmt.Sprintf("记录关键词统计起始时间失败: %v", err), userID)
+	}
+
 	// 构建关键词列表字符串
 	// 每行显示4个关键词
 	var rows []string
@@ -1479,7 +2172,7 @@ func removeKeywordForUser(userID int64, keyword string) (string, error) {
 	}
 
 	if !found {
-		return fmt.Sprintf("❌ 关键词 \"%s\" 不存在", keyword), nil
+		return "", newUserError(UserErrorNotFound, "关键词 \"%s\" 不存在", keyword)
 	}
 
 	keywordsJSON, err := json.Marshal(newKeywords)
@@ -1501,6 +2194,14 @@ func removeKeywordForUser(userID int64, keyword string) (string, error) {
 		return "", err
 	}
 
+	// 关键词删除后清理其订阅范围和命中统计
+	if err := deleteKeywordScopes(userID, keyword); err != nil {
+		logMessage("warn", fmt.Sprintf("清理关键词范围失败: %v", err), userID)
+	}
+	if err := deleteKeywordHits(userID, keyword); err != nil {
+		logMessage("warn", fmt.Sprintf("清理关键词统计失败: %v", err), userID)
+	}
+
 	// 如果没有剩余关键词，直接返回删除成功的消息
 	if len(newKeywords) == 0 {
 		return fmt.Sprintf("✅ 关键词 \"%s\" 已删除\n当前没有关键词", keyword), nil
@@ -1532,7 +2233,9 @@ func getSubscriptionsForUser(userID int64) ([]SubscriptionInfo, error) {
 
 	err := withDB(func(db *sql.DB) error {
 		// 获取所有订阅
-		rows, err := db.Query(`SELECT rss_name, rss_url, users FROM subscriptions`)
+		rows, err := db.Query(`
+			SELECT s.subscription_id, s.rss_name, s.rss_url, s.users, COALESCE(f.last_update_time, '')
+			FROM subscriptions s LEFT JOIN feed_data f ON f.rss_name = s.rss_name`)
 
 		if err != nil {
 			return err
@@ -1541,10 +2244,11 @@ func getSubscriptionsForUser(userID int64) ([]SubscriptionInfo, error) {
 
 		for rows.Next() {
 			var sub SubscriptionInfo
-			var usersStr string
-			if err := rows.Scan(&sub.Name, &sub.URL, &usersStr); err != nil {
+			var usersStr, lastUpdate string
+			if err := rows.Scan(&sub.ID, &sub.Name, &sub.URL, &usersStr, &lastUpdate); err != nil {
 				continue
 			}
+			sub.LastUpdate = formatFeedUpdateTime(userID, lastUpdate)
 
 			// 解析用户列表
 			var users []int64
@@ -1592,6 +2296,9 @@ func removeSubscriptionForUser(userID int64, subscriptionName string) (string, e
 
 		var usersStr string
 		err = tx.QueryRow("SELECT users FROM subscriptions WHERE rss_name = ?", subscriptionName).Scan(&usersStr)
+		if err == sql.ErrNoRows {
+			return newUserError(UserErrorNotFound, "订阅 \"%s\" 不存在", subscriptionName)
+		}
 		if err != nil {
 			return err
 		}
@@ -1632,6 +2339,9 @@ func removeSubscriptionForUser(userID int64, subscriptionName string) (string, e
 					_, err = tx.Exec("UPDATE subscriptions SET users = ? WHERE rss_name = ?", string(usersJSON), subscriptionName)
 					result = fmt.Sprintf("✅ 你已取消订阅 \"%s\"", subscriptionName)
 				}
+				if err == nil {
+					err = removeUserSubscriptionData(tx, userID, subscriptionName)
+				}
 
 				if err != nil {
 					return err
@@ -1666,6 +2376,9 @@ func removeSubscriptionForUser(userID int64, subscriptionName string) (string, e
 			_, err = tx.Exec("UPDATE subscriptions SET users = ? WHERE rss_name = ?", string(usersJSON), subscriptionName)
 			result = fmt.Sprintf("✅ 你已取消订阅 \"%s\"", subscriptionName)
 		}
+		if err == nil {
+			err = removeUserSubscriptionData(tx, userID, subscriptionName)
+		}
 
 		if err != nil {
 			return err
@@ -1677,6 +2390,22 @@ func removeSubscriptionForUser(userID int64, subscriptionName string) (string, e
 	return result, err
 }
 
+// removeUserSubscriptionData 清理用户取消订阅后残留的订阅级设置和待发送内容
+func removeUserSubscriptionData(tx *sql.Tx, userID int64, subscriptionName string) error {
+	statements := []string{
+		"DELETE FROM user_subscription_settings WHERE user_id = ? AND rss_name = ?",
+		"DELETE FROM digest_items WHERE user_id = ? AND rss_name = ?",
+		"DELETE FROM destination_routes WHERE destination_id IN (SELECT id FROM destinations WHERE owner_id = ?) AND rss_name = ?",
+		"DELETE FROM destination_topics WHERE destination_id IN (SELECT id FROM destinations WHERE owner_id = ?) AND kind = 'sub' AND route_key = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID, subscriptionName); err != nil {
+			return err
+		}
+	}
+	return removeSubscriptionKeywordScopes(tx, userID, subscriptionName)
+}
+
 func getUserStats(userID int64) (*UserStats, error) {
 	stats := &UserStats{}
 
@@ -1736,12 +2465,17 @@ func validateAndProcessSubscription(feedURL, name, channel string, userID int64)
 	// 验证URL格式
 	parsedURL, err := url.Parse(feedURL)
 	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
-		return fmt.Errorf("无效的URL格式，请使用http或https开头的完整URL")
+		return newUserError(UserErrorInvalid, "无效的URL格式，请使用http或https开头的完整URL")
+	}
+
+	// 检查订阅数量配额
+	if err := checkSubscriptionQuota(userID); err != nil {
+		return err
 	}
 
 	// 验证RSS源有效性
 	if valid, errMsg := verifyRSSFeed(feedURL); !valid {
-		return fmt.Errorf("RSS源验证失败: %s", errMsg)
+		return newUserError(UserErrorInvalid, "RSS源验证失败: %s", errMsg)
 	}
 
 	return withDB(func(db *sql.DB) error {
@@ -1789,7 +2523,7 @@ func validateAndProcessSubscription(feedURL, name, channel string, userID int64)
 			// 检查用户是否已订阅
 			for _, uid := range existingUsers {
 				if uid == userID {
-					return fmt.Errorf("你已经订阅了这个RSS源")
+					return newUserError(UserErrorConflict, "你已经订阅了这个RSS源")
 				}
 			}
 
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+// setupTestDB 使用临时数据库和默认配置初始化全局状态，测试结束后关闭
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	globalConfig = &Config{Timezone: DefaultTimezone, DateFormat: DefaultDateFormat, AccessMode: AccessModeOpen}
+	testDB, err := sql.Open("sqlite3", fmt.Sprintf("%s/test.db?cache=shared&mode=rwc&_timeout=30000", t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDB.SetMaxOpenConns(10)
+	db = testDB
+	t.Cleanup(func() { testDB.Close() })
+	if err := initDatabase(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus 指标：在 HTTP 服务中通过 GET /metrics 以文本格式输出
+// 只实现了用到的计数器、仪表盘和直方图，避免为此引入额外的依赖
+// 队列长度等需要查询数据库的指标在抓取时计算
+
+// 指标类型
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// 直方图的默认分桶（秒）
+var (
+	fetchDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	cycleDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+)
+
+// metricFamily 同名指标的所有标签组合
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries 一组标签值对应的数值
+type metricSeries struct {
+	labelValues []string
+	value       float64  // 计数器和仪表盘的值
+	counts      []uint64 // 直方图每个分桶的累计数量
+	sum         float64
+	count       uint64
+}
+
+var (
+	metricRegistry      []*metricFamily
+	metricRegistryMutex sync.Mutex
+)
+
+// registerMetric 注册指标，输出时按名称排序
+func registerMetric(name, help, kind string, buckets []float64, labels []string) *metricFamily {
+	family := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	metricRegistryMutex.Lock()
+	metricRegistry = append(metricRegistry, family)
+	metricRegistryMutex.Unlock()
+	return family
+}
+
+func newCounter(name, help string, labels ...string) *metricFamily {
+	return registerMetric(name, help, metricCounter, nil, labels)
+}
+
+func newGauge(name, help string, labels ...string) *metricFamily {
+	return registerMetric(name, help, metricGauge, nil, labels)
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *metricFamily {
+	return registerMetric(name, help, metricHistogram, buckets, labels)
+}
+
+// seriesFor 获取标签值对应的序列，不存在时创建，调用方需持有锁
+func (m *metricFamily) seriesFor(labelValues []string) *metricSeries {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d 个", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	series, ok := m.series[key]
+	if !ok {
+		series = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == metricHistogram {
+			series.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = series
+	}
+	return series
+}
+
+// Add 计数器增加指定值
+func (m *metricFamily) Add(value float64, labelValues ...string) {
+	m.mu.Lock()
+	m.seriesFor(labelValues).value += value
+	m.mu.Unlock()
+}
+
+// Inc 计数器加一
+func (m *metricFamily) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+// Set 设置仪表盘的值
+func (m *metricFamily) Set(value float64, labelValues ...string) {
+	m.mu.Lock()
+	m.seriesFor(labelValues).value = value
+	m.mu.Unlock()
+}
+
+// Observe 直方图记录一次观测值
+func (m *metricFamily) Observe(value float64, labelValues ...string) {
+	m.mu.Lock()
+	series := m.seriesFor(labelValues)
+	for i, bound := range m.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+	m.mu.Unlock()
+}
+
+// Value 读取计数器或仪表盘的当前值
+func (m *metricFamily) Value(labelValues ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if series, ok := m.series[strings.Join(labelValues, "\xff")]; ok {
+		return series.value
+	}
+	return 0
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatLabels 格式化标签，extra 为直方图的 le 标签
+func formatLabels(names, values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[0], extra[1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// write 以 Prometheus 文本格式输出指标
+func (m *metricFamily) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.series) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	for _, key := range keys {
+		series := m.series[key]
+		if m.kind != metricHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, series.labelValues), formatMetricValue(series.value))
+			continue
+		}
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name,
+				formatLabels(m.labels, series.labelValues, "le", formatMetricValue(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(m.labels, series.labelValues, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, formatLabels(m.labels, series.labelValues), formatMetricValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, formatLabels(m.labels, series.labelValues), series.count)
+	}
+}
+
+// 订阅抓取
+var (
+	metricFeedFetchDuration = newHistogram("rssbot_feed_fetch_duration_seconds", "抓取并解析 RSS 源的耗时", fetchDurationBuckets, "feed")
+	metricFeedFetchErrors   = newCounter("rssbot_feed_fetch_errors_total", "抓取 RSS 源失败的次数", "feed")
+	metricFeedItemsParsed   = newCounter("rssbot_feed_items_parsed_total", "RSS 源中解析到的条目数", "feed")
+	metricFeedItemsNew      = newCounter("rssbot_feed_items_new_total", "RSS 源中的新条目数", "feed")
+	metricFeedMatches       = newCounter("rssbot_feed_matches_total", "命中关键词或全量推送的次数（按用户和推送目标计）", "feed")
+	metricFeedPushes        = newCounter("rssbot_feed_pushes_total", "实际发送成功的推送条数（去重后，按用户和推送目标计，摘要和免打扰补发按条目计）", "feed")
+)
+
+// 检查周期
+var (
+	metricCycleDuration     = newHistogram("rssbot_check_cycle_duration_seconds", "一轮检查所有订阅的耗时", cycleDurationBuckets)
+	metricCycleLastComplete = newGauge("rssbot_check_cycle_last_completed_timestamp_seconds", "最近一轮检查完成的时间")
+)
+
+// Telegram 和队列
+var (
+	metricTelegramSendErrors = newCounter("rssbot_telegram_send_errors_total", "发送 Telegram 消息失败的次数", "method", "type")
+	metricQueueDepth         = newGauge("rssbot_queue_depth", "等待发送的条目数", "queue")
+)
+
+// AI
+var (
+	metricAIRequests     = newCounter("rssbot_ai_requests_total", "调用 AI 服务的次数（不含缓存命中）", "operation", "status")
+	metricAITokens       = newCounter("rssbot_ai_tokens_total", "AI 服务消耗的 Token 数", "operation")
+	metricAICost         = newCounter("rssbot_ai_cost_total", "AI 服务的估算费用", "operation")
+	metricAICacheLookups = newCounter("rssbot_ai_cache_lookups_total", "AI 结果缓存的查询次数", "operation", "result")
+	metricAICacheRatio   = newGauge("rssbot_ai_cache_hit_ratio", "启动以来 AI 结果缓存的命中率", "operation")
+)
+
+// observeFeedFetch 记录一次抓取的耗时和结果
+func observeFeedFetch(feed string, duration time.Duration, err error) {
+	metricFeedFetchDuration.Observe(duration.Seconds(), feed)
+	if err != nil {
+		metricFeedFetchErrors.Inc(feed)
+	}
+}
+
+// observeCheckCycle 记录一轮检查完成
+func observeCheckCycle(duration time.Duration) {
+	metricCycleDuration.Observe(duration.Seconds())
+	metricCycleLastComplete.Set(float64(time.Now().Unix()))
+	markCycleCompleted()
+}
+
+// observeAICacheLookup 记录一次 AI 缓存查询
+func observeAICacheLookup(operation string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	metricAICacheLookups.Inc(operation, result)
+}
+
+// observeAIRequest 记录一次 AI 服务调用
+func observeAIRequest(operation string, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	metricAIRequests.Inc(operation, status)
+	markAIResult(err)
+}
+
+// observeAIUsage 记录 AI 服务消耗的 Token 和费用
+func observeAIUsage(operation string, tokens int, cost float64) {
+	metricAITokens.Add(float64(tokens), operation)
+	metricAICost.Add(cost, operation)
+}
+
+// telegramSendMethod 是否为发送或编辑消息的接口
+func telegramSendMethod(method string) bool {
+	return strings.HasPrefix(method, "send") || strings.HasPrefix(method, "editMessage") || method == "copyMessage"
+}
+
+// telegramErrorType 按 HTTP 状态码归类 Telegram 接口的错误
+func telegramErrorType(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case statusCode == http.StatusForbidden:
+		return "forbidden"
+	case statusCode == http.StatusBadRequest:
+		return "bad_request"
+	case statusCode >= 500:
+		return "server_error"
+	default:
+		return "other"
+	}
+}
+
+// telegramMetricsTransport 统计发送消息失败的次数，Bot 的所有发送都经过这里
+type telegramMetricsTransport struct {
+	base http.RoundTripper
+}
+
+// telegramResponseError 把网络错误和非 200 响应统一为 error
+func telegramResponseError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newTelegramMetricsTransport 包装 Bot 使用的 HTTP 传输
+func newTelegramMetricsTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &telegramMetricsTransport{base: base}
+}
+
+func (t *telegramMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	method := path.Base(req.URL.Path)
+	if method == "getUpdates" {
+		markPollResult(telegramResponseError(resp, err))
+		return resp, err
+	}
+	if !telegramSendMethod(method) {
+		return resp, err
+	}
+	if err != nil {
+		metricTelegramSendErrors.Inc(method, "network")
+	} else if resp.StatusCode != http.StatusOK {
+		metricTelegramSendErrors.Inc(method, telegramErrorType(resp.StatusCode))
+	}
+	return resp, err
+}
+
+// collectScrapeMetrics 抓取时更新需要实时计算的指标
+func collectScrapeMetrics() {
+	queues := map[string]string{
+		"deferred": "SELECT COUNT(*) FROM deferred_pushes",
+		"digest":   "SELECT COUNT(*) FROM digest_items",
+	}
+	for queue, query := range queues {
+		var count int
+		err := withDB(func(db *sql.DB) error {
+			return db.QueryRow(query).Scan(&count)
+		})
+		if err != nil {
+			logMessage("warn", fmt.Sprintf("统计队列 %s 长度失败: %v", queue, err))
+			continue
+		}
+		metricQueueDepth.Set(float64(count), queue)
+	}
+
+	for _, operation := range []string{"translate", "summarize"} {
+		hits := metricAICacheLookups.Value(operation, "hit")
+		total := hits + metricAICacheLookups.Value(operation, "miss")
+		if total > 0 {
+			metricAICacheRatio.Set(hits/total, operation)
+		}
+	}
+}
+
+// handleMetrics 输出所有指标
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	collectScrapeMetrics()
+
+	metricRegistryMutex.Lock()
+	families := append([]*metricFamily(nil), metricRegistry...)
+	metricRegistryMutex.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buffered := bufio.NewWriter(w)
+	for _, family := range families {
+		family.write(buffered)
+	}
+	buffered.Flush()
+}
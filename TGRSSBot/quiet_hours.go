@@ -0,0 +1,554 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UrgentKeywordPrefix 紧急关键词前缀，命中后无视免打扰时段立即推送
+const UrgentKeywordPrefix = "!"
+
+// DeferredPush 免打扰期间暂存的推送
+type DeferredPush struct {
+	ID        int64
+	UserID    int64
+	RSSName   string
+	Content   string // 已格式化的HTML推送内容
+	CreatedAt time.Time
+}
+
+// deferredFlushMutex 保证同一时间只有一个补发流程读取并清理暂存推送，避免重复补发
+var deferredFlushMutex sync.Mutex
+
+// 暂停推送的快捷时长（分钟）
+var snoozeOptions = []struct {
+	Label   string
+	Minutes int
+}{
+	{"1小时", 60},
+	{"3小时", 180},
+	{"8小时", 480},
+	{"1天", 1440},
+	{"3天", 4320},
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回当天的分钟数
+func parseClock(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("时间格式应为 HH:MM")
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("小时应在 0-23 之间")
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("分钟应在 0-59 之间")
+	}
+	return hour*60 + minute, nil
+}
+
+// inQuietHours 判断给定时刻是否处于用户的免打扰时段
+func inQuietHours(settings *UserSettings, now time.Time) bool {
+	if settings.QuietStart == "" || settings.QuietEnd == "" {
+		return false
+	}
+	start, err := parseClock(settings.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(settings.QuietEnd)
+	if err != nil || start == end {
+		return false
+	}
+
+	local := now.In(loadLocation(settings.Timezone))
+	current := local.Hour()*60 + local.Minute()
+	if start < end {
+		return current >= start && current < end
+	}
+	// 跨越午夜，如 23:00-07:00
+	return current >= start || current < end
+}
+
+// isSnoozed 判断用户是否处于暂停推送状态
+func isSnoozed(settings *UserSettings, now time.Time) bool {
+	return !settings.SnoozeUntil.IsZero() && now.Before(settings.SnoozeUntil)
+}
+
+// shouldDeferPush 判断推送是否需要暂存
+// 暂停推送期间所有推送都暂存；免打扰时段内仅紧急关键词可直接推送
+func shouldDeferPush(userID int64, urgent bool) bool {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		return false
+	}
+
+	now := time.Now()
+	if isSnoozed(settings, now) {
+		return true
+	}
+	return !urgent && inQuietHours(settings, now)
+}
+
+// isUrgentMatch 判断匹配到的关键词中是否包含紧急关键词
+func isUrgentMatch(matchedKeywords, keywords []string) bool {
+	urgent := make(map[string]bool)
+	for _, kw := range keywords {
+		kw = strings.TrimSpace(kw)
+		if strings.HasPrefix(kw, UrgentKeywordPrefix) {
+			urgent[strings.ToLower(strings.TrimPrefix(kw, UrgentKeywordPrefix))] = true
+		}
+	}
+	for _, kw := range matchedKeywords {
+		if urgent[strings.ToLower(kw)] {
+			return true
+		}
+	}
+	return false
+}
+
+// queueDeferredPush 将推送加入暂存队列
+func queueDeferredPush(userID int64, rssName, content string) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO deferred_pushes (user_id, rss_name, content, created_at)
+			VALUES (?, ?, ?, ?)`, userID, rssName, content, time.Now())
+		return err
+	})
+}
+
+// getDeferredPushes 获取用户暂存的推送
+func getDeferredPushes(userID int64) ([]DeferredPush, error) {
+	var pushes []DeferredPush
+
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT id, user_id, rss_name, content, created_at
+			FROM deferred_pushes WHERE user_id = ? ORDER BY id`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var push DeferredPush
+			if err := rows.Scan(&push.ID, &push.UserID, &push.RSSName, &push.Content, &push.CreatedAt); err != nil {
+				continue
+			}
+			pushes = append(pushes, push)
+		}
+		return nil
+	})
+
+	return pushes, err
+}
+
+// deleteDeferredPushes 删除已投递的暂存推送
+func deleteDeferredPushes(userID int64, maxID int64) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec("DELETE FROM deferred_pushes WHERE user_id = ? AND id <= ?", userID, maxID)
+		return err
+	})
+}
+
+// getDeferredUsers 获取存在暂存推送的用户
+func getDeferredUsers() ([]int64, error) {
+	var userIDs []int64
+
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT DISTINCT user_id FROM deferred_pushes")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var uid int64
+			if err := rows.Scan(&uid); err == nil {
+				userIDs = append(userIDs, uid)
+			}
+		}
+		return nil
+	})
+
+	return userIDs, err
+}
+
+// splitHTMLEntriesCounted 将多条HTML内容打包成若干条不超过maxLength的消息，并返回每条消息包含的条目数
+// 只在条目之间切分，避免截断HTML标签；单条超长时按纯文本截断
+func splitHTMLEntriesCounted(header string, entries []string, maxLength int) ([]string, []int) {
+	var chunks []string
+	var counts []int
+	current := header
+	count := 0
+
+	for _, entry := range entries {
+		if len(entry) > maxLength-len(header)-2 {
+			entry = truncateText(cleanHTMLTags(entry), maxLength-len(header)-2)
+		}
+		if current != "" && len(current)+len(entry)+2 > maxLength {
+			chunks = append(chunks, current)
+			counts = append(counts, count)
+			current = ""
+			count = 0
+		}
+		if current != "" {
+			current += "\n\n"
+		}
+		current += entry
+		count++
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+		counts = append(counts, count)
+	}
+	return chunks, counts
+}
+
+// cleanHTMLTags 移除所有HTML标签
+func cleanHTMLTags(content string) string {
+	var result strings.Builder
+	inTag := false
+	for _, r := range content {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			result.WriteRune(r)
+		}
+	}
+	return result.String()
+}
+
+// truncateText 按字节上限截断文本，保证不切断UTF-8字符
+func truncateText(text string, maxLength int) string {
+	if len(text) <= maxLength {
+		return text
+	}
+	cut := maxLength - len("...")
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !isRuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
+
+// isRuneStart 判断字节是否为UTF-8字符的起始字节
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// flushDeferredPushes 将用户暂存的推送合并为补发消息发送
+// 只清理已成功发送的条目，发送失败的部分留待下次补发
+func flushDeferredPushes(userID int64) {
+	deferredFlushMutex.Lock()
+	defer deferredFlushMutex.Unlock()
+
+	pushes, err := getDeferredPushes(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取暂存推送失败: %v", err), userID)
+		return
+	}
+	if len(pushes) == 0 {
+		return
+	}
+
+	var entries []string
+	for _, push := range pushes {
+		entries = append(entries, fmt.Sprintf("📰 <b>%s</b>\n%s", push.RSSName, push.Content))
+	}
+
+	header := fmt.Sprintf("🌅 免打扰期间共有 %d 条推送：", len(pushes))
+	chunks, counts := splitHTMLEntriesCounted(header, entries, MaxMessageLength)
+	sent := 0
+	for i, chunk := range chunks {
+		if _, err := sendHTMLMessage(userID, chunk); err != nil {
+			logMessage("error", fmt.Sprintf("补发暂存推送失败: %v", err), userID)
+			break
+		}
+		sent += counts[i]
+		time.Sleep(100 * time.Millisecond)
+	}
+	if sent == 0 {
+		return
+	}
+
+	for _, push := range pushes[:sent] {
+		metricFeedPushes.Inc(push.RSSName)
+		recordPush(push.RSSName)
+	}
+	if err := deleteDeferredPushes(userID, pushes[sent-1].ID); err != nil {
+		logMessage("error", fmt.Sprintf("清理暂存推送失败: %v", err), userID)
+	}
+	logMessage("info", fmt.Sprintf("已补发 %d/%d 条免打扰期间的推送", sent, len(pushes)), userID)
+}
+
+// checkDeferredPushes 检查所有暂存推送，免打扰结束的用户进行补发
+func checkDeferredPushes() {
+	userIDs, err := getDeferredUsers()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取暂存推送用户失败: %v", err))
+		return
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		settings, err := GetUserSettings(userID)
+		if err != nil {
+			logMessage("warn", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+			continue
+		}
+		if isSnoozed(settings, now) || inQuietHours(settings, now) {
+			continue
+		}
+		flushDeferredPushes(userID)
+	}
+}
+
+// startDeferredDelivery 启动暂存推送的补发协程
+func startDeferredDelivery() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logMessage("error", fmt.Sprintf("补发暂存推送时发生panic: %v", r))
+				}
+			}()
+			checkDeferredPushes()
+		}()
+	}
+}
+
+// describeQuietHours 描述用户的免打扰时段
+func describeQuietHours(settings *UserSettings) string {
+	if settings.QuietStart == "" || settings.QuietEnd == "" {
+		return "未启用"
+	}
+	return fmt.Sprintf("%s - %s", settings.QuietStart, settings.QuietEnd)
+}
+
+// describeSnooze 描述用户的暂停推送状态
+func describeSnooze(settings *UserSettings) string {
+	if !isSnoozed(settings, time.Now()) {
+		return "未暂停"
+	}
+	if settings.SnoozeUntil.Sub(time.Now()) > snoozeForever/2 {
+		return "直到手动恢复"
+	}
+	return fmt.Sprintf("至 %s", settings.SnoozeUntil.In(loadLocation(settings.Timezone)).Format(settings.dateLayout()))
+}
+
+// showQuietHoursPrompt 显示免打扰时段设置提示
+func showQuietHoursPrompt(userID int64, messageID int) {
+	setUserState(userID, "set_quiet_hours", messageID, nil)
+
+	text := `🌙 请输入免打扰时段（按你的时区），格式为 开始-结束：
+
+📝 示例：23:00-07:00
+输入 off 关闭免打扰
+
+💡 免打扰期间的推送会在时段结束后合并补发，以 ! 开头的紧急关键词不受影响`
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🚫 关闭免打扰", "quiet_off"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+		),
+	)
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// setQuietHours 设置免打扰时段，value 为 "HH:MM-HH:MM" 或 "off"
+func setQuietHours(userID int64, messageID int, value string) {
+	value = strings.TrimSpace(value)
+
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置免打扰失败，请稍后重试")
+		return
+	}
+
+	if strings.EqualFold(value, "off") {
+		settings.QuietStart = ""
+		settings.QuietEnd = ""
+	} else {
+		parts := strings.Split(strings.ReplaceAll(value, "～", "-"), "-")
+		if len(parts) != 2 {
+			messageSender.SendError(userID, messageID, "❌ 格式错误！请按 开始-结束 格式输入，例如：23:00-07:00")
+			return
+		}
+		start, err1 := parseClock(parts[0])
+		end, err2 := parseClock(parts[1])
+		if err1 != nil || err2 != nil || start == end {
+			messageSender.SendError(userID, messageID, "❌ 时间无效！请按 开始-结束 格式输入，例如：23:00-07:00")
+			return
+		}
+		settings.QuietStart = fmt.Sprintf("%02d:%02d", start/60, start%60)
+		settings.QuietEnd = fmt.Sprintf("%02d:%02d", end/60, end%60)
+	}
+
+	fields := map[string]interface{}{"quiet_start": settings.QuietStart, "quiet_end": settings.QuietEnd}
+	if err := UpdateUserSettingFields(userID, fields); err != nil {
+		logMessage("error", fmt.Sprintf("保存用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置免打扰失败，请稍后重试")
+		return
+	}
+
+	clearUserState(userID)
+	logMessage("info", fmt.Sprintf("用户免打扰时段已设置为 %s", describeQuietHours(settings)), userID)
+	showSettingsMenu(userID, messageID)
+}
+
+// handleQuietHoursInput 处理用户输入的免打扰时段
+func handleQuietHoursInput(message *tgbotapi.Message) {
+	setQuietHours(message.Chat.ID, 0, message.Text)
+}
+
+// showSnoozeMenu 显示暂停推送选项
+func showSnoozeMenu(userID int64, messageID int) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取设置失败，请稍后重试")
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var currentRow []tgbotapi.InlineKeyboardButton
+	for i, option := range snoozeOptions {
+		currentRow = append(currentRow, tgbotapi.NewInlineKeyboardButtonData(
+			option.Label, fmt.Sprintf("snooze_%d", option.Minutes)))
+		if len(currentRow) == 3 || i == len(snoozeOptions)-1 {
+			rows = append(rows, currentRow)
+			currentRow = nil
+		}
+	}
+	if isSnoozed(settings, time.Now()) {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ 恢复推送", "snooze_off"),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+	))
+
+	text := fmt.Sprintf(`⏸ 暂停推送
+
+当前状态：%s
+
+暂停期间的所有推送（包括紧急关键词）都会暂存，恢复后合并补发。
+也可以使用命令：/snooze 2h、/snooze 30m、/snooze off`, describeSnooze(settings))
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// setSnooze 设置暂停推送时长，duration 为0表示恢复推送
+func setSnooze(userID int64, duration time.Duration) (string, error) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		return "", err
+	}
+
+	// 零值表示未暂停，存储为NULL
+	var snoozeUntil interface{}
+	if duration <= 0 {
+		settings.SnoozeUntil = time.Time{}
+	} else {
+		settings.SnoozeUntil = time.Now().Add(duration)
+		snoozeUntil = settings.SnoozeUntil
+	}
+
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"snooze_until": snoozeUntil}); err != nil {
+		return "", err
+	}
+
+	if duration <= 0 {
+		// 恢复后立即补发暂停期间的推送（仍处于免打扰时段时由定时任务处理）
+		go checkDeferredPushes()
+		return "▶️ 已恢复推送", nil
+	}
+	return fmt.Sprintf("⏸ 已暂停推送，%s", describeSnooze(settings)), nil
+}
+
+// parseSnoozeDuration 解析暂停时长，支持 30m、2h、1d 及 Go 时长格式
+func parseSnoozeDuration(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("无效的时长: %s", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("无效的时长: %s", value)
+	}
+	return duration, nil
+}
+
+// handleSnoozeCommand 处理 /snooze 命令
+func handleSnoozeCommand(userID int64, args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		showSnoozeMenu(userID, 0)
+		return
+	}
+
+	var duration time.Duration
+	if !strings.EqualFold(args, "off") {
+		var err error
+		duration, err = parseSnoozeDuration(args)
+		if err != nil {
+			sendMessage(userID, "❌ "+err.Error()+"\n用法：/snooze 2h、/snooze 30m、/snooze 1d、/snooze off")
+			return
+		}
+	}
+
+	result, err := setSnooze(userID, duration)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("设置暂停推送失败: %v", err), userID)
+		sendMessage(userID, "设置暂停推送失败，请稍后重试")
+		return
+	}
+	sendMessage(userID, result)
+}
+
+// handleSnoozeCallback 处理暂停推送按钮
+func handleSnoozeCallback(userID int64, messageID int, value string) {
+	var duration time.Duration
+	if value != "off" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			messageSender.SendError(userID, messageID, "❌ 无效的暂停时长")
+			return
+		}
+		duration = time.Duration(minutes) * time.Minute
+	}
+
+	if _, err := setSnooze(userID, duration); err != nil {
+		logMessage("error", fmt.Sprintf("设置暂停推送失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置暂停推送失败，请稍后重试")
+		return
+	}
+	showSnoozeMenu(userID, messageID)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSnoozeDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30m", want: 30 * time.Minute},
+		{value: "2h", want: 2 * time.Hour},
+		{value: " 2H ", want: 2 * time.Hour},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "1d", want: 24 * time.Hour},
+		{value: "7D", want: 7 * 24 * time.Hour},
+		{value: "", wantErr: true},
+		{value: "0m", wantErr: true},
+		{value: "-2h", wantErr: true},
+		{value: "0d", wantErr: true},
+		{value: "-1d", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "2", wantErr: true},
+		{value: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSnoozeDuration(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSnoozeDuration(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSnoozeDuration(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "00:00", want: 0},
+		{value: "7:05", want: 7*60 + 5},
+		{value: " 23:59 ", want: 23*60 + 59},
+		{value: "24:00", wantErr: true},
+		{value: "12:60", wantErr: true},
+		{value: "-1:00", wantErr: true},
+		{value: "1200", wantErr: true},
+		{value: "12:00:00", wantErr: true},
+		{value: "ab:cd", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseClock(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseClock(%q) = %d, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseClock(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2025, 6, 6, parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+	}
+	tests := []struct {
+		start, end, now string
+		want            bool
+	}{
+		{"09:00", "18:00", "12:00", true},
+		{"09:00", "18:00", "09:00", true},
+		{"09:00", "18:00", "18:00", false},
+		{"09:00", "18:00", "08:59", false},
+		// 跨越午夜
+		{"23:00", "07:00", "23:30", true},
+		{"23:00", "07:00", "03:00", true},
+		{"23:00", "07:00", "07:00", false},
+		{"23:00", "07:00", "12:00", false},
+		// 未设置、起止相同或格式错误时视为未启用
+		{"", "", "12:00", false},
+		{"08:00", "08:00", "08:00", false},
+		{"25:00", "07:00", "03:00", false},
+	}
+	for _, tt := range tests {
+		settings := &UserSettings{Timezone: "UTC", QuietStart: tt.start, QuietEnd: tt.end}
+		if got := inQuietHours(settings, at(tt.now)); got != tt.want {
+			t.Errorf("inQuietHours(%s-%s, %s) = %v, want %v", tt.start, tt.end, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestIsUrgentMatch(t *testing.T) {
+	keywords := []string{"!Outage", "release", " !安全 "}
+	tests := []struct {
+		matched []string
+		want    bool
+	}{
+		{[]string{"outage"}, true},
+		{[]string{"release", "安全"}, true},
+		{[]string{"release"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isUrgentMatch(tt.matched, keywords); got != tt.want {
+			t.Errorf("isUrgentMatch(%q) = %v, want %v", tt.matched, got, tt.want)
+		}
+	}
+}
+
+func TestSplitHTMLEntriesCounted(t *testing.T) {
+	entries := []string{"aaaa", "bbbb", "cccc", "dddd"}
+	chunks, counts := splitHTMLEntriesCounted("hh", entries, 14)
+	if len(chunks) != len(counts) {
+		t.Fatalf("got %d chunks and %d counts", len(chunks), len(counts))
+	}
+	total := 0
+	for i, chunk := range chunks {
+		if len(chunk) > 14 {
+			t.Errorf("chunk %d is %d bytes, want <= 14", i, len(chunk))
+		}
+		total += counts[i]
+	}
+	if total != len(entries) {
+		t.Errorf("counts sum to %d, want %d", total, len(entries))
+	}
+	if counts[0] != 2 {
+		t.Errorf("first chunk holds %d entries, want 2", counts[0])
+	}
+}
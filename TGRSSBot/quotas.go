@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 用户配额：config.json 的 Quotas 为所有用户的默认配额，管理员可通过 /quota 为单个用户覆盖
+// 每项配额为 0 表示不限制；所有者和管理员不受配额限制
+// AI 次数按用户每日统计，最小轮询间隔限制用户订阅的 RSS 源多久检查一次，
+// 同一 RSS 源被多个用户订阅时按其中最短的间隔检查
+
+// UserQuota 用户配额
+type UserQuota struct {
+	Subscriptions    int `json:"subscriptions"`      // 订阅数量上限
+	Keywords         int `json:"keywords"`           // 关键词数量上限
+	AITranslateDaily int `json:"ai_translate_daily"` // 每日AI翻译次数上限
+	AISummarizeDaily int `json:"ai_summarize_daily"` // 每日AI摘要次数上限
+	MinPollMinutes   int `json:"min_poll_minutes"`   // 订阅最小轮询间隔(分钟)
+}
+
+// quotaField 可单独设置的配额项
+type quotaField struct {
+	column string
+	name   string
+	get    func(q *UserQuota) *int
+}
+
+// quotaFields 配额项，键为 /quota 命令中使用的名称
+var quotaFields = map[string]quotaField{
+	"subs":      {"subscriptions", "订阅数量", func(q *UserQuota) *int { return &q.Subscriptions }},
+	"keywords":  {"keywords", "关键词数量", func(q *UserQuota) *int { return &q.Keywords }},
+	"translate": {"ai_translate_daily", "每日AI翻译", func(q *UserQuota) *int { return &q.AITranslateDaily }},
+	"summarize": {"ai_summarize_daily", "每日AI摘要", func(q *UserQuota) *int { return &q.AISummarizeDaily }},
+	"poll":      {"min_poll_minutes", "最小轮询间隔(分钟)", func(q *UserQuota) *int { return &q.MinPollMinutes }},
+}
+
+// quotaFieldOrder 配额项的显示顺序
+var quotaFieldOrder = []string{"subs", "keywords", "translate", "summarize", "poll"}
+
+// AI 操作类型，与 ai_usage_stats 中的记录一致
+const (
+	AIOpTranslate = "translate"
+	AIOpSummarize = "summarize"
+)
+
+// ErrAIQuotaExceeded 用户今日的AI次数已用完
+var ErrAIQuotaExceeded = errors.New("今日AI使用次数已达上限")
+
+var (
+	aiQuotaNotified = make(map[string]string)    // "用户ID:操作" -> 最近一次提醒的日期
+	feedLastPolled  = make(map[string]time.Time) // 订阅名称 -> 上次检查时间
+	quotaMutex      sync.Mutex
+)
+
+// isQuotaExempt 所有者和管理员不受配额限制
+func isQuotaExempt(userID int64) bool {
+	return hasRole(getUserRole(userID), RoleAdmin)
+}
+
+// loadQuotaOverrides 读取用户的配额覆盖，未指定用户时读取全部，未覆盖的项为 nil
+func loadQuotaOverrides(db *sql.DB, userIDs ...int64) (map[int64]map[string]*int, error) {
+	columns := make([]string, 0, len(quotaFieldOrder))
+	for _, key := range quotaFieldOrder {
+		columns = append(columns, quotaFields[key].column)
+	}
+	query := "SELECT user_id, " + strings.Join(columns, ", ") + " FROM user_quotas"
+	var args []interface{}
+	if len(userIDs) > 0 {
+		query += " WHERE user_id IN (?" + strings.Repeat(", ?", len(userIDs)-1) + ")"
+		for _, userID := range userIDs {
+			args = append(args, userID)
+		}
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := make(map[int64]map[string]*int)
+	for rows.Next() {
+		var userID int64
+		values := make([]sql.NullInt64, len(quotaFieldOrder))
+		dest := []interface{}{&userID}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		fields := make(map[string]*int)
+		for i, key := range quotaFieldOrder {
+			if values[i].Valid {
+				value := int(values[i].Int64)
+				fields[key] = &value
+			}
+		}
+		overrides[userID] = fields
+	}
+	return overrides, rows.Err()
+}
+
+// applyQuotaOverrides 在默认配额上应用用户的覆盖
+func applyQuotaOverrides(fields map[string]*int) UserQuota {
+	quota := globalConfig.Quotas
+	for key, value := range fields {
+		if value != nil {
+			*quotaFields[key].get(&quota) = *value
+		}
+	}
+	return quota
+}
+
+// getUserQuota 获取用户生效的配额，所有者和管理员返回不限制
+func getUserQuota(userID int64) UserQuota {
+	if isQuotaExempt(userID) {
+		return UserQuota{}
+	}
+	var overrides map[int64]map[string]*int
+	err := withDB(func(db *sql.DB) error {
+		var err error
+		overrides, err = loadQuotaOverrides(db, userID)
+		return err
+	})
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户配额失败: %v", err), userID)
+	}
+	return applyQuotaOverrides(overrides[userID])
+}
+
+// setUserQuota 设置用户的单项配额，value 为 nil 时恢复默认
+func setUserQuota(userID int64, key string, value *int, operatorID int64) error {
+	field, ok := quotaFields[key]
+	if !ok {
+		return fmt.Errorf("未知的配额项 %s", key)
+	}
+	var arg interface{}
+	if value != nil {
+		arg = *value
+	}
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO user_quotas (user_id, `+field.column+`, updated_by, updated_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(user_id) DO UPDATE SET
+				`+field.column+` = excluded.`+field.column+`, updated_by = excluded.updated_by, updated_at = CURRENT_TIMESTAMP`,
+			userID, arg, operatorID)
+		return err
+	})
+}
+
+// checkSubscriptionQuota 检查用户能否再添加一个订阅
+func checkSubscriptionQuota(userID int64) error {
+	limit := getUserQuota(userID).Subscriptions
+	if limit <= 0 {
+		return nil
+	}
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		return err
+	}
+	if count := len(subscriptions); count >= limit {
+		return newUserError(UserErrorQuota, "订阅数量已达上限（%d/%d），请先删除不需要的订阅", count, limit)
+	}
+	return nil
+}
+
+// getUserAIUsage 获取用户今日的AI翻译和摘要次数
+func getUserAIUsage(userID int64) (translate, summarize int) {
+	today := time.Now().Format("2006-01-02")
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow("SELECT translate_count, summarize_count FROM user_ai_usage WHERE user_id = ? AND date = ?",
+			userID, today).Scan(&translate, &summarize)
+	})
+	if err != nil && err != sql.ErrNoRows {
+		logMessage("error", fmt.Sprintf("获取用户AI使用次数失败: %v", err), userID)
+	}
+	return translate, summarize
+}
+
+// reserveUserAIUsage 检查用户今日的AI次数，未超出上限时计入一次
+// 检查和计数在同一条语句中完成，并发处理多个订阅时也不会超出上限
+func reserveUserAIUsage(userID int64, operation string) error {
+	quota := getUserQuota(userID)
+	column, limit := "summarize_count", quota.AISummarizeDaily
+	if operation == AIOpTranslate {
+		column, limit = "translate_count", quota.AITranslateDaily
+	}
+
+	today := time.Now().Format("2006-01-02")
+	reserved := true
+	err := withDB(func(db *sql.DB) error {
+		if limit <= 0 {
+			_, err := db.Exec(`
+				INSERT INTO user_ai_usage (user_id, date, `+column+`) VALUES (?, ?, 1)
+				ON CONFLICT(user_id, date) DO UPDATE SET `+column+` = `+column+` + 1`,
+				userID, today)
+			return err
+		}
+		result, err := db.Exec(`
+			INSERT INTO user_ai_usage (user_id, date, `+column+`) VALUES (?, ?, 1)
+			ON CONFLICT(user_id, date) DO UPDATE SET `+column+` = `+column+` + 1 WHERE `+column+` < ?`,
+			userID, today, limit)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		reserved = affected > 0
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		notifyAIQuotaExceeded(userID, operation, limit)
+		return ErrAIQuotaExceeded
+	}
+	return nil
+}
+
+// notifyAIQuotaExceeded 用户AI次数用完时每天提醒一次
+func notifyAIQuotaExceeded(userID int64, operation string, limit int) {
+	key := fmt.Sprintf("%d:%s", userID, operation)
+	today := time.Now().Format("2006-01-02")
+	quotaMutex.Lock()
+	notified := aiQuotaNotified[key] == today
+	aiQuotaNotified[key] = today
+	quotaMutex.Unlock()
+	if notified {
+		return
+	}
+
+	name := "翻译"
+	if operation == AIOpSummarize {
+		name = "摘要"
+	}
+	logMessage("info", fmt.Sprintf("用户今日AI%s次数已达上限 %d", name, limit), userID)
+	sendMessage(userID, fmt.Sprintf("🤖 今日AI%s次数已用完（上限 %d 次），之后的推送将不再%s，明天自动恢复", name, limit, name))
+}
+
+// filterSubscriptionsByPollInterval 按订阅用户的最小轮询间隔筛选本轮需要检查的订阅
+func filterSubscriptionsByPollInterval(db *sql.DB, subscriptions []Subscription) []Subscription {
+	overrides, err := loadQuotaOverrides(db)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取用户配额失败: %v", err))
+	}
+	exempt := make(map[int64]bool)
+	rows, err := db.Query("SELECT user_id FROM user_roles WHERE role IN (?, ?)", RoleOwner, RoleAdmin)
+	if err == nil {
+		for rows.Next() {
+			var userID int64
+			if rows.Scan(&userID) == nil {
+				exempt[userID] = true
+			}
+		}
+		rows.Close()
+	}
+
+	now := time.Now()
+	quotaMutex.Lock()
+	defer quotaMutex.Unlock()
+
+	var due []Subscription
+	for _, sub := range subscriptions {
+		// 取订阅用户中最短的间隔，没有订阅用户时按默认配额
+		interval := -1
+		for _, userID := range sub.Users {
+			minutes := 0
+			if !exempt[userID] {
+				minutes = applyQuotaOverrides(overrides[userID]).MinPollMinutes
+			}
+			if interval < 0 || minutes < interval {
+				interval = minutes
+			}
+		}
+		if interval < 0 {
+			interval = globalConfig.Quotas.MinPollMinutes
+		}
+
+		last, ok := feedLastPolled[sub.Name]
+		if interval > 0 && ok && now.Sub(last) < time.Duration(interval)*time.Minute {
+			logMessage("debug", fmt.Sprintf("订阅 %s 未到轮询间隔，跳过本轮检查", sub.Name))
+			continue
+		}
+		feedLastPolled[sub.Name] = now
+		due = append(due, sub)
+	}
+	return due
+}
+
+// formatQuotaValue 格式化配额上限，0 显示为不限
+func formatQuotaValue(limit int) string {
+	if limit <= 0 {
+		return "不限"
+	}
+	return strconv.Itoa(limit)
+}
+
+// formatQuotaUsage 主菜单中显示的配额使用情况
+func formatQuotaUsage(userID int64, subscriptions, keywords int) string {
+	quota := getUserQuota(userID)
+	translate, summarize := getUserAIUsage(userID)
+	text := fmt.Sprintf("📦 配额：订阅 %d/%s  关键词 %d/%s",
+		subscriptions, formatQuotaValue(quota.Subscriptions), keywords, formatQuotaValue(quota.Keywords))
+	if globalConfig.AI != nil && globalConfig.AI.Enabled {
+		text += fmt.Sprintf("\n🤖 今日AI：翻译 %d/%s  摘要 %d/%s",
+			translate, formatQuotaValue(quota.AITranslateDaily), summarize, formatQuotaValue(quota.AISummarizeDaily))
+	}
+	return text
+}
+
+// describeUserQuota 显示用户的配额和使用情况，标注哪些项为单独设置
+func describeUserQuota(targetID int64) string {
+	var fields map[string]*int
+	err := withDB(func(db *sql.DB) error {
+		overrides, err := loadQuotaOverrides(db, targetID)
+		fields = overrides[targetID]
+		return err
+	})
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户配额失败: %v", err), targetID)
+	}
+	quota := applyQuotaOverrides(fields)
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("📦 用户 %d 的配额", targetID))
+	if isQuotaExempt(targetID) {
+		lines = append(lines, "该用户为管理员，不受配额限制")
+	}
+	for _, key := range quotaFieldOrder {
+		field := quotaFields[key]
+		source := "默认"
+		if fields[key] != nil {
+			source = "单独设置"
+		}
+		lines = append(lines, fmt.Sprintf("● %s（%s）：%s [%s]", field.name, key, formatQuotaValue(*field.get(&quota)), source))
+	}
+
+	subscriptions, _ := getSubscriptionsForUser(targetID)
+	keywords, _ := getKeywordsForUser(targetID)
+	translate, summarize := getUserAIUsage(targetID)
+	lines = append(lines, "", fmt.Sprintf("当前使用：订阅 %d，关键词 %d，今日AI翻译 %d，今日AI摘要 %d",
+		len(subscriptions), len(keywords), translate, summarize))
+	return strings.Join(lines, "\n")
+}
+
+// handleQuotaCommand 处理 /quota 命令
+// /quota <用户ID> 查看配额，/quota <用户ID> <配额项> <数值|default> 设置配额，0 表示不限制
+func handleQuotaCommand(userID, operatorID int64, args string) {
+	usage := "❌ 用法：/quota <用户ID> [subs|keywords|translate|summarize|poll] [数值|default]\n数值为 0 表示不限制，default 表示恢复默认配额"
+	fields := strings.Fields(args)
+	if len(fields) != 1 && len(fields) != 3 {
+		sendMessage(userID, usage)
+		return
+	}
+	targetID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		sendMessage(userID, usage)
+		return
+	}
+	if len(fields) == 1 {
+		sendMessage(userID, describeUserQuota(targetID))
+		return
+	}
+
+	key := strings.ToLower(fields[1])
+	if _, ok := quotaFields[key]; !ok {
+		sendMessage(userID, usage)
+		return
+	}
+	var value *int
+	if !strings.EqualFold(fields[2], "default") {
+		n, err := strconv.Atoi(fields[2])
+		if err != nil || n < 0 {
+			sendMessage(userID, "❌ 配额必须是不小于 0 的整数")
+			return
+		}
+		value = &n
+	}
+
+	if err := setUserQuota(targetID, key, value, operatorID); err != nil {
+		logMessage("error", fmt.Sprintf("设置用户配额失败: %v", err), operatorID)
+		sendMessage(userID, "设置失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("设置用户 %d 的配额 %s = %s", targetID, key, fields[2]), operatorID)
+	sendMessage(userID, "✅ 已更新\n\n"+describeUserQuota(targetID))
+}
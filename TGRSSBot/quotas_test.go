@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAIService 记录调用次数的 AI 服务
+type fakeAIService struct {
+	mutex sync.Mutex
+	calls int
+}
+
+func (s *fakeAIService) Translate(ctx context.Context, text, sourceLang, targetLang string) (*TranslateResult, error) {
+	s.mutex.Lock()
+	s.calls++
+	s.mutex.Unlock()
+	return &TranslateResult{OriginalText: text, TranslatedText: "译文：" + text, TargetLang: targetLang, Provider: "fake"}, nil
+}
+
+func (s *fakeAIService) Summarize(ctx context.Context, text string, maxLength, minLength int) (*SummaryResult, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeAIService) GetName() string                      { return "fake" }
+func (s *fakeAIService) GetModel() string                     { return "fake" }
+func (s *fakeAIService) IsAvailable(ctx context.Context) bool { return true }
+func (s *fakeAIService) GetSupportedLanguages() []Language    { return nil }
+
+// markAIQuotaNotified 标记今日已提醒过，测试中不发送消息
+func markAIQuotaNotified(userID int64, operation string) {
+	quotaMutex.Lock()
+	aiQuotaNotified[fmt.Sprintf("%d:%s", userID, operation)] = time.Now().Format("2006-01-02")
+	quotaMutex.Unlock()
+}
+
+func TestReserveUserAIUsageConcurrent(t *testing.T) {
+	setupTestDB(t)
+	globalConfig.Quotas.AITranslateDaily = 3
+	const userID = 42
+	markAIQuotaNotified(userID, AIOpTranslate)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := reserveUserAIUsage(userID, AIOpTranslate)
+			if err != nil && !errors.Is(err, ErrAIQuotaExceeded) {
+				t.Errorf("reserveUserAIUsage: %v", err)
+				return
+			}
+			if err == nil {
+				mutex.Lock()
+				reserved++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 3 {
+		t.Errorf("reserved %d times, want 3", reserved)
+	}
+	if translate, _ := getUserAIUsage(userID); translate != 3 {
+		t.Errorf("translate_count = %d, want 3", translate)
+	}
+}
+
+func TestReserveUserAIUsageUnlimited(t *testing.T) {
+	setupTestDB(t)
+	const userID = 43
+	for i := 0; i < 5; i++ {
+		if err := reserveUserAIUsage(userID, AIOpSummarize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, summarize := getUserAIUsage(userID); summarize != 5 {
+		t.Errorf("summarize_count = %d, want 5", summarize)
+	}
+}
+
+func TestTranslateForUserChargesOnlyCacheMisses(t *testing.T) {
+	setupTestDB(t)
+	globalConfig.Quotas.AITranslateDaily = 2
+	const userID = 44
+	markAIQuotaNotified(userID, AIOpTranslate)
+
+	service := &fakeAIService{}
+	handler := NewAIHandler(service, db)
+	ctx := context.Background()
+
+	// 同一内容只请求一次，缓存命中不计入配额
+	for i := 0; i < 3; i++ {
+		if _, err := handler.TranslateForUser(ctx, userID, "hello", "", "zh-CN"); err != nil {
+			t.Fatalf("translate #%d: %v", i+1, err)
+		}
+	}
+	if translate, _ := getUserAIUsage(userID); translate != 1 || service.calls != 1 {
+		t.Fatalf("after cache hits: translate_count = %d, calls = %d, want 1, 1", translate, service.calls)
+	}
+
+	if _, err := handler.TranslateForUser(ctx, userID, "world", "", "zh-CN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handler.TranslateForUser(ctx, userID, "again", "", "zh-CN"); !errors.Is(err, ErrAIQuotaExceeded) {
+		t.Fatalf("third distinct text: err = %v, want ErrAIQuotaExceeded", err)
+	}
+	// 配额用完后缓存中已有的内容仍可使用
+	if _, err := handler.TranslateForUser(ctx, userID, "hello", "", "zh-CN"); err != nil {
+		t.Errorf("cached text after quota exhausted: %v", err)
+	}
+	if service.calls != 2 {
+		t.Errorf("AI service called %d times, want 2", service.calls)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 全量推送：按 用户/订阅 开启后，该订阅的所有新内容都会推送，不需要命中关键词
+// 屏蔽词仍然生效；推送中的关键词显示为 ReceiveAllLabel
+
+// ReceiveAllLabel 全量推送时在消息中代替关键词显示的标签
+const ReceiveAllLabel = "全部推送"
+
+// getAllReceiveAllSubscriptions 获取所有开启全量推送的订阅，返回 用户ID -> 订阅名称集合
+func getAllReceiveAllSubscriptions(db *sql.DB) (map[int64]map[string]bool, error) {
+	rows, err := db.Query("SELECT user_id, rss_name FROM user_subscription_settings WHERE receive_all = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]map[string]bool)
+	for rows.Next() {
+		var userID int64
+		var rssName string
+		if err := rows.Scan(&userID, &rssName); err != nil {
+			return nil, err
+		}
+		if result[userID] == nil {
+			result[userID] = make(map[string]bool)
+		}
+		result[userID][rssName] = true
+	}
+	return result, rows.Err()
+}
+
+// isReceiveAll 检查订阅是否开启了全量推送
+func isReceiveAll(userID int64, rssName string) (bool, error) {
+	var receiveAll bool
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow(`
+			SELECT receive_all FROM user_subscription_settings
+			WHERE user_id = ? AND rss_name = ?`, userID, rssName).Scan(&receiveAll)
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return receiveAll, err
+}
+
+// setReceiveAll 设置订阅是否全量推送
+func setReceiveAll(userID int64, rssName string, receiveAll bool) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO user_subscription_settings (user_id, rss_name, receive_all)
+			VALUES (?, ?, ?)
+			ON CONFLICT(user_id, rss_name) DO UPDATE SET receive_all = excluded.receive_all`,
+			userID, rssName, receiveAll)
+		return err
+	})
+}
+
+// hasBlockedHit 判断命中结果中是否有屏蔽词
+func hasBlockedHit(hits []KeywordHit) bool {
+	for _, hit := range hits {
+		if hit.Blocked {
+			return true
+		}
+	}
+	return false
+}
+
+// createReceiveAllChoiceKeyboard 添加订阅后选择匹配方式的键盘
+func createReceiveAllChoiceKeyboard(subID int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔑 只推送命中关键词的内容", fmt.Sprintf("sub_recv_%d_0_add", subID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📥 推送全部内容（屏蔽词仍生效）", fmt.Sprintf("sub_recv_%d_1_add", subID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "back_to_menu"),
+		),
+	)
+}
+
+// findSubscriptionIDByName 根据名称查找用户订阅的ID
+func findSubscriptionIDByName(userID int64, name string) (int, bool) {
+	subscriptions, err := getSubscriptionsForUser(userID)
+	if err != nil {
+		return 0, false
+	}
+	for _, sub := range subscriptions {
+		if sub.Name == name {
+			return sub.ID, true
+		}
+	}
+	return 0, false
+}
+
+// handleReceiveAllCallback 处理全量推送按钮
+// value 格式为 "<订阅ID>_<0|1>"，添加订阅流程中为 "<订阅ID>_<0|1>_add"
+func handleReceiveAllCallback(userID int64, messageID int, value string) {
+	parts := strings.Split(value, "_")
+	if len(parts) < 2 {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	subID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	receiveAll := parts[1] == "1"
+
+	sub, err := getSubscriptionInfoByID(userID, subID)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 订阅不存在")
+		return
+	}
+
+	if err := setReceiveAll(userID, sub.Name, receiveAll); err != nil {
+		logMessage("error", fmt.Sprintf("设置全量推送失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("订阅 %s 全量推送: %v", sub.Name, receiveAll), userID)
+
+	if len(parts) == 3 && parts[2] == "add" {
+		text := fmt.Sprintf("✅ 订阅 %s 将只推送命中关键词的内容", sub.Name)
+		if receiveAll {
+			text = fmt.Sprintf("✅ 订阅 %s 将推送全部新内容，命中屏蔽词的内容除外", sub.Name)
+		}
+		text += "\n\n可在 ⚙️ 个人设置 → 📬 推送方式 → 📰 按订阅设置 中修改"
+		keyboard := CreateBackButton()
+		messageSender.SendResponse(userID, messageID, text, &keyboard)
+		return
+	}
+	showSubscriptionDeliveryOptions(userID, messageID, subID)
+}
+
+// describeReceiveAll 描述订阅的推送范围
+func describeReceiveAll(receiveAll bool) string {
+	if receiveAll {
+		return "全部内容（屏蔽词仍生效）"
+	}
+	return "只推送命中关键词的内容"
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 注册：非开放模式下，新用户可以通过邀请链接 /start <邀请码> 直接获得用户角色
+// 审核模式（approval）下，没有邀请码的新用户发送 /start 后进入待审核队列，
+// 所有管理员会收到带有 通过/拒绝 按钮的通知，审核通过前只能看到等待提示
+
+// 申请状态
+const (
+	ApplicationPending  = "pending"  // 等待审核
+	ApplicationApproved = "approved" // 已通过
+	ApplicationDenied   = "denied"   // 已拒绝
+)
+
+const (
+	inviteCodeLength   = 10 // 邀请码长度
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"
+	inviteTimeLayout   = "2006-01-02 15:04:05" // 数据库中时间的格式（UTC）
+	defaultInviteUses  = 1                     // 默认可使用次数
+)
+
+// InviteCode 邀请码
+type InviteCode struct {
+	Code      string
+	CreatedBy int64
+	MaxUses   int
+	UsedCount int
+	ExpiresAt time.Time // 零值表示永久有效
+}
+
+// expired 邀请码是否已过期或用完
+func (c *InviteCode) expired(now time.Time) bool {
+	return c.UsedCount >= c.MaxUses || (!c.ExpiresAt.IsZero() && now.After(c.ExpiresAt))
+}
+
+// describe 邀请码的状态描述
+func (c *InviteCode) describe(userID int64) string {
+	expires := "永久有效"
+	if !c.ExpiresAt.IsZero() {
+		expires = formatTimeForUser(userID, c.ExpiresAt) + " 过期"
+	}
+	return fmt.Sprintf("已使用 %d/%d 次，%s", c.UsedCount, c.MaxUses, expires)
+}
+
+// inviteLink 邀请码对应的链接
+func inviteLink(code string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", bot.Self.UserName, code)
+}
+
+// generateInviteCode 生成随机邀请码
+func generateInviteCode() (string, error) {
+	var builder strings.Builder
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := 0; i < inviteCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(inviteCodeAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+// createInviteCode 创建邀请码，ttl 为 0 表示永久有效
+func createInviteCode(createdBy int64, maxUses int, ttl time.Duration) (*InviteCode, error) {
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := &InviteCode{Code: code, CreatedBy: createdBy, MaxUses: maxUses}
+	expiresAt := ""
+	if ttl > 0 {
+		invite.ExpiresAt = time.Now().UTC().Add(ttl)
+		expiresAt = invite.ExpiresAt.Format(inviteTimeLayout)
+	}
+	err = withDB(func(db *sql.DB) error {
+		_, err := db.Exec("INSERT INTO invite_codes (code, created_by, max_uses, expires_at) VALUES (?, ?, ?, ?)",
+			code, createdBy, maxUses, expiresAt)
+		return err
+	})
+	return invite, err
+}
+
+// scanInviteCode 读取一行邀请码
+func scanInviteCode(scanner interface{ Scan(...interface{}) error }) (*InviteCode, error) {
+	var invite InviteCode
+	var expiresAt string
+	if err := scanner.Scan(&invite.Code, &invite.CreatedBy, &invite.MaxUses, &invite.UsedCount, &expiresAt); err != nil {
+		return nil, err
+	}
+	if expiresAt != "" {
+		invite.ExpiresAt, _ = time.Parse(inviteTimeLayout, expiresAt)
+	}
+	return &invite, nil
+}
+
+// getActiveInviteCodes 获取仍可使用的邀请码
+func getActiveInviteCodes() ([]*InviteCode, error) {
+	var invites []*InviteCode
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT code, created_by, max_uses, used_count, expires_at FROM invite_codes ORDER BY created_at")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		now := time.Now().UTC()
+		for rows.Next() {
+			invite, err := scanInviteCode(rows)
+			if err != nil {
+				return err
+			}
+			if !invite.expired(now) {
+				invites = append(invites, invite)
+			}
+		}
+		return rows.Err()
+	})
+	return invites, err
+}
+
+// deleteInviteCode 作废邀请码
+func deleteInviteCode(code string) (bool, error) {
+	var deleted bool
+	err := withDB(func(db *sql.DB) error {
+		result, err := db.Exec("DELETE FROM invite_codes WHERE code = ?", code)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		deleted = affected > 0
+		return err
+	})
+	return deleted, err
+}
+
+// redeemInviteCode 使用邀请码，成功后用户获得普通用户角色
+func redeemInviteCode(userID int64, code string) error {
+	var invalid string
+	err := withDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		invite, err := scanInviteCode(tx.QueryRow(
+			"SELECT code, created_by, max_uses, used_count, expires_at FROM invite_codes WHERE code = ?", code))
+		if err == sql.ErrNoRows {
+			invalid = "邀请码无效"
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// 在同一条语句中检查次数和有效期，避免并发兑换时超出可使用次数
+		result, err := tx.Exec(`
+			UPDATE invite_codes SET used_count = used_count + 1
+			WHERE code = ? AND used_count < max_uses AND (expires_at = '' OR expires_at > ?)`,
+			code, time.Now().UTC().Format(inviteTimeLayout))
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			invalid = "邀请码已过期或已用完"
+			return nil
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_roles (user_id, role, updated_by, updated_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(user_id) DO UPDATE SET
+				role = excluded.role, updated_by = excluded.updated_by, updated_at = CURRENT_TIMESTAMP`,
+			userID, RoleUser, invite.CreatedBy)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE user_applications SET status = ?, handled_by = ?, handled_at = CURRENT_TIMESTAMP WHERE user_id = ?",
+			ApplicationApproved, invite.CreatedBy, userID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+	if invalid != "" {
+		return fmt.Errorf("%s", invalid)
+	}
+	return nil
+}
+
+// Application 使用申请
+type Application struct {
+	UserID   int64
+	Username string
+	Name     string
+	Status   string
+}
+
+// label 申请人的显示名称
+func (a *Application) label() string {
+	label := fmt.Sprintf("%s (%d)", a.Name, a.UserID)
+	if a.Username != "" {
+		label += " @" + a.Username
+	}
+	return label
+}
+
+// getApplication 获取用户的申请，没有申请时返回 nil
+func getApplication(userID int64) (*Application, error) {
+	var app Application
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow("SELECT user_id, username, name, status FROM user_applications WHERE user_id = ?", userID).
+			Scan(&app.UserID, &app.Username, &app.Name, &app.Status)
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// getPendingApplications 获取等待审核的申请
+func getPendingApplications() ([]*Application, error) {
+	var apps []*Application
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT user_id, username, name, status FROM user_applications WHERE status = ? ORDER BY created_at", ApplicationPending)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var app Application
+			if err := rows.Scan(&app.UserID, &app.Username, &app.Name, &app.Status); err != nil {
+				return err
+			}
+			apps = append(apps, &app)
+		}
+		return rows.Err()
+	})
+	return apps, err
+}
+
+// submitApplication 提交使用申请
+func submitApplication(user *tgbotapi.User) (*Application, error) {
+	app := &Application{
+		UserID:   user.ID,
+		Username: user.UserName,
+		Name:     strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Status:   ApplicationPending,
+	}
+	err := withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO user_applications (user_id, username, name, status)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET
+				username = excluded.username, name = excluded.name, status = excluded.status,
+				created_at = CURRENT_TIMESTAMP, handled_by = 0, handled_at = NULL`,
+			app.UserID, app.Username, app.Name, app.Status)
+		return err
+	})
+	return app, err
+}
+
+// setApplicationStatus 更新申请状态，只处理等待中的申请，返回是否更新
+func setApplicationStatus(userID int64, status string, operatorID int64) (bool, error) {
+	var updated bool
+	err := withDB(func(db *sql.DB) error {
+		result, err := db.Exec(`
+			UPDATE user_applications SET status = ?, handled_by = ?, handled_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND status = ?`, status, operatorID, userID, ApplicationPending)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		updated = affected > 0
+		return err
+	})
+	return updated, err
+}
+
+// getAdminIDs 获取所有管理员和所有者
+func getAdminIDs() ([]int64, error) {
+	var adminIDs []int64
+	err := withDB(func(db *sql.DB) error {
+		rows, err := db.Query("SELECT user_id FROM user_roles WHERE role IN (?, ?)", RoleOwner, RoleAdmin)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var userID int64
+			if err := rows.Scan(&userID); err != nil {
+				return err
+			}
+			adminIDs = append(adminIDs, userID)
+		}
+		return rows.Err()
+	})
+	return adminIDs, err
+}
+
+// createApplicationKeyboard 审核申请的按钮
+func createApplicationKeyboard(userID int64) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 通过", fmt.Sprintf("reg_approve_%d", userID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 拒绝", fmt.Sprintf("reg_deny_%d", userID)),
+		),
+	)
+}
+
+// notifyAdminsOfApplication 把新的申请发给所有管理员
+func notifyAdminsOfApplication(app *Application) {
+	adminIDs, err := getAdminIDs()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取管理员列表失败: %v", err), app.UserID)
+		return
+	}
+	if len(adminIDs) == 0 {
+		logMessage("warn", "没有管理员可以审核新用户申请，请在配置文件中设置 ADMINIDS 或 Roles", app.UserID)
+		return
+	}
+	text := fmt.Sprintf("🆕 新用户申请使用 Bot\n\n👤 %s", app.label())
+	keyboard := createApplicationKeyboard(app.UserID)
+	for _, adminID := range adminIDs {
+		if err := messageSender.SendResponse(adminID, 0, text, &keyboard); err != nil {
+			logMessage("warn", fmt.Sprintf("通知管理员 %d 失败: %v", adminID, err), app.UserID)
+		}
+	}
+}
+
+// registrationNotice 没有使用权限的用户看到的提示
+func registrationNotice(userID int64) string {
+	if globalConfig.AccessMode != AccessModeApproval {
+		return fmt.Sprintf("此 Bot 仅限授权用户使用，可使用邀请链接加入，或将你的用户ID %d 发给管理员", userID)
+	}
+	app, err := getApplication(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户申请失败: %v", err), userID)
+	}
+	switch {
+	case app != nil && app.Status == ApplicationPending:
+		return "⏳ 你的使用申请正在等待管理员审核，通过后会通知你"
+	case app != nil && app.Status == ApplicationDenied:
+		return "你的使用申请未通过，如有疑问请联系管理员"
+	}
+	return "此 Bot 需要管理员审核后才能使用，请发送 /start 提交申请，或使用邀请链接加入"
+}
+
+// handleRegistration 处理没有使用权限的用户发送的 /start，返回是否已处理（不再继续执行命令）
+// 带邀请码时兑换邀请码，审核模式下提交申请
+func handleRegistration(message *tgbotapi.Message) bool {
+	userID := message.From.ID
+	chatID := message.Chat.ID
+	role := effectiveRole(getUserRole(userID))
+	if role == RoleBanned || hasRole(role, RoleUser) {
+		return false
+	}
+
+	if code := strings.TrimSpace(message.CommandArguments()); code != "" {
+		if err := redeemInviteCode(userID, code); err != nil {
+			logMessage("info", fmt.Sprintf("邀请码 %s 兑换失败: %v", code, err), userID)
+			sendMessage(chatID, "❌ "+err.Error())
+			return true
+		}
+		logMessage("info", fmt.Sprintf("用户通过邀请码 %s 加入", code), userID)
+		return false
+	}
+
+	if globalConfig.AccessMode != AccessModeApproval {
+		return false
+	}
+
+	app, err := getApplication(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户申请失败: %v", err), userID)
+		sendMessage(chatID, "获取申请状态失败，请稍后重试")
+		return true
+	}
+	// 角色被移除的用户可以重新申请
+	if app != nil && app.Status != ApplicationApproved {
+		sendMessage(chatID, registrationNotice(userID))
+		return true
+	}
+
+	if app, err = submitApplication(message.From); err != nil {
+		logMessage("error", fmt.Sprintf("提交使用申请失败: %v", err), userID)
+		sendMessage(chatID, "提交申请失败，请稍后重试")
+		return true
+	}
+	logMessage("info", "新用户提交使用申请", userID)
+	notifyAdminsOfApplication(app)
+	sendMessage(chatID, "📝 已提交使用申请，管理员审核通过后会通知你")
+	return true
+}
+
+// handleRegistrationCallback 处理审核按钮，value 格式为 "approve_<用户ID>" 或 "deny_<用户ID>"
+func handleRegistrationCallback(userID int64, messageID int, operatorID int64, value string) {
+	parts := strings.SplitN(value, "_", 2)
+	if len(parts) != 2 || (parts[0] != "approve" && parts[0] != "deny") {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	targetID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	app, err := getApplication(targetID)
+	if err != nil || app == nil {
+		messageSender.SendError(userID, messageID, "❌ 申请不存在")
+		return
+	}
+
+	status := ApplicationDenied
+	if parts[0] == "approve" {
+		status = ApplicationApproved
+	}
+	updated, err := setApplicationStatus(targetID, status, operatorID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("更新申请状态失败: %v", err), operatorID)
+		messageSender.SendError(userID, messageID, "操作失败，请稍后重试")
+		return
+	}
+	if !updated {
+		// 其他管理员已经处理过
+		messageSender.SendResponse(userID, messageID, fmt.Sprintf("👤 %s\n\n该申请已处理：%s", app.label(), describeApplicationStatus(app.Status)), nil)
+		return
+	}
+
+	if status == ApplicationApproved {
+		if err := setUserRole(targetID, RoleUser, operatorID); err != nil {
+			logMessage("error", fmt.Sprintf("设置用户角色失败: %v", err), operatorID)
+			messageSender.SendError(userID, messageID, "操作失败，请稍后重试")
+			return
+		}
+		sendMessage(targetID, "✅ 你的使用申请已通过，发送 /start 开始使用")
+	} else {
+		sendMessage(targetID, "你的使用申请未通过，如有疑问请联系管理员")
+	}
+	logMessage("info", fmt.Sprintf("审核用户 %d 的申请: %s", targetID, describeApplicationStatus(status)), operatorID)
+	messageSender.SendResponse(userID, messageID, fmt.Sprintf("👤 %s\n\n%s（由 %d 处理）", app.label(), describeApplicationStatus(status), operatorID), nil)
+}
+
+// describeApplicationStatus 申请状态的文字描述
+func describeApplicationStatus(status string) string {
+	switch status {
+	case ApplicationApproved:
+		return "✅ 已通过"
+	case ApplicationDenied:
+		return "❌ 已拒绝"
+	}
+	return "⏳ 等待审核"
+}
+
+// handlePendingCommand 处理 /pending 命令，列出等待审核的申请
+func handlePendingCommand(userID int64) {
+	apps, err := getPendingApplications()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取待审核申请失败: %v", err), userID)
+		sendMessage(userID, "获取待审核申请失败，请稍后重试")
+		return
+	}
+	if len(apps) == 0 {
+		sendMessage(userID, "没有等待审核的申请")
+		return
+	}
+	for _, app := range apps {
+		keyboard := createApplicationKeyboard(app.UserID)
+		messageSender.SendResponse(userID, 0, "⏳ 等待审核\n\n👤 "+app.label(), &keyboard)
+	}
+}
+
+// handleInviteCommand 处理 /invite 命令
+// /invite [次数] [有效期] 创建邀请码，/invite list 查看可用的邀请码，/invite del <邀请码> 作废邀请码
+func handleInviteCommand(userID, operatorID int64, args string) {
+	fields := strings.Fields(args)
+	if len(fields) > 0 {
+		switch strings.ToLower(fields[0]) {
+		case "list":
+			showInviteCodes(userID)
+			return
+		case "del":
+			if len(fields) != 2 {
+				sendMessage(userID, "❌ 用法：/invite del <邀请码>")
+				return
+			}
+			deleted, err := deleteInviteCode(fields[1])
+			if err != nil {
+				logMessage("error", fmt.Sprintf("作废邀请码失败: %v", err), operatorID)
+				sendMessage(userID, "作废邀请码失败，请稍后重试")
+				return
+			}
+			if !deleted {
+				sendMessage(userID, "❌ 邀请码不存在")
+				return
+			}
+			logMessage("info", fmt.Sprintf("作废邀请码: %s", fields[1]), operatorID)
+			sendMessage(userID, "✅ 已作废邀请码 "+fields[1])
+			return
+		}
+	}
+
+	maxUses := defaultInviteUses
+	var ttl time.Duration
+	usage := "❌ 用法：/invite [次数] [有效期]，如 /invite 5 7d\n/invite list 查看邀请码，/invite del <邀请码> 作废"
+	if len(fields) > 0 {
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n <= 0 {
+			sendMessage(userID, usage)
+			return
+		}
+		maxUses = n
+	}
+	if len(fields) > 1 {
+		duration, err := parseSnoozeDuration(fields[1])
+		if err != nil {
+			sendMessage(userID, usage)
+			return
+		}
+		ttl = duration
+	}
+
+	invite, err := createInviteCode(operatorID, maxUses, ttl)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("创建邀请码失败: %v", err), operatorID)
+		sendMessage(userID, "创建邀请码失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("创建邀请码 %s: %s", invite.Code, invite.describe(operatorID)), operatorID)
+	sendMessage(userID, fmt.Sprintf("🎟 邀请码：%s\n%s\n\n邀请链接：%s", invite.Code, invite.describe(operatorID), inviteLink(invite.Code)))
+}
+
+// showInviteCodes 列出仍可使用的邀请码
+func showInviteCodes(userID int64) {
+	invites, err := getActiveInviteCodes()
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取邀请码失败: %v", err), userID)
+		sendMessage(userID, "获取邀请码失败，请稍后重试")
+		return
+	}
+	if len(invites) == 0 {
+		sendMessage(userID, "没有可用的邀请码，使用 /invite 创建")
+		return
+	}
+	var lines []string
+	for _, invite := range invites {
+		lines = append(lines, fmt.Sprintf("• %s：%s\n  %s", invite.Code, invite.describe(userID), inviteLink(invite.Code)))
+	}
+	sendMessage(userID, "🎟 可用的邀请码：\n\n"+strings.Join(lines, "\n"))
+}
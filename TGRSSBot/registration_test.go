@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedeemInviteCodeLimits(t *testing.T) {
+	setupTestDB(t)
+
+	invite, err := createInviteCode(1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []int64{101, 102} {
+		if err := redeemInviteCode(userID, invite.Code); err != nil {
+			t.Fatalf("redeem by %d: %v", userID, err)
+		}
+		if role := getUserRole(userID); role != RoleUser {
+			t.Errorf("role of %d = %q, want %q", userID, role, RoleUser)
+		}
+	}
+	if err := redeemInviteCode(103, invite.Code); err == nil {
+		t.Error("redeeming a used-up code succeeded")
+	}
+	if err := redeemInviteCode(104, "nonexistent"); err == nil {
+		t.Error("redeeming an unknown code succeeded")
+	}
+
+	expired, err := createInviteCode(1, 5, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = withDB(func(db *sql.DB) error {
+		_, err := db.Exec("UPDATE invite_codes SET expires_at = ? WHERE code = ?",
+			time.Now().UTC().Add(-time.Minute).Format(inviteTimeLayout), expired.Code)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redeemInviteCode(105, expired.Code); err == nil {
+		t.Error("redeeming an expired code succeeded")
+	}
+}
+
+func TestRedeemInviteCodeConcurrent(t *testing.T) {
+	setupTestDB(t)
+
+	invite, err := createInviteCode(1, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	redeemed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			if redeemInviteCode(userID, invite.Code) == nil {
+				mutex.Lock()
+				redeemed++
+				mutex.Unlock()
+			}
+		}(int64(200 + i))
+	}
+	wg.Wait()
+
+	if redeemed != 1 {
+		t.Errorf("one-time code redeemed %d times, want 1", redeemed)
+	}
+	var usedCount int
+	err = withDB(func(db *sql.DB) error {
+		return db.QueryRow("SELECT used_count FROM invite_codes WHERE code = ?", invite.Code).Scan(&usedCount)
+	})
+	if err != nil || usedCount != 1 {
+		t.Errorf("used_count = %d, %v, want 1", usedCount, err)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 角色和访问控制：角色保存在 user_roles 表中，启动时按 config.json 的 Roles 写入，
+// 运行中由管理员修改过的角色（updated_by 不为0）和封禁不会被配置文件覆盖
+// ADMINIDS 兼容旧版配置，视为所有者
+// 访问模式 open 时任何人都可以使用（被封禁的除外），allowlist 时只有拥有角色的用户可以使用，
+// approval 时新用户还可以提交申请等待管理员审核（见 registration.go）
+// 群组中按发送者本人的角色判断，匿名管理员按群组本身的角色判断
+
+// 角色
+const (
+	RoleOwner  = "owner"  // 所有者，由配置文件指定
+	RoleAdmin  = "admin"  // 管理员
+	RoleUser   = "user"   // 普通用户
+	RoleBanned = "banned" // 已封禁
+	RoleNone   = ""       // 没有角色
+)
+
+// 访问模式
+const (
+	AccessModeOpen      = "open"      // 所有人可用
+	AccessModeAllowlist = "allowlist" // 只有名单内的用户可用
+	AccessModeApproval  = "approval"  // 新用户需使用邀请码或经管理员审核
+)
+
+var roleNames = map[string]string{
+	RoleOwner:  "所有者",
+	RoleAdmin:  "管理员",
+	RoleUser:   "用户",
+	RoleBanned: "已封禁",
+	RoleNone:   "无",
+}
+
+// roleRank 角色等级，用于比较权限高低
+var roleRank = map[string]int{
+	RoleBanned: -1,
+	RoleNone:   0,
+	RoleUser:   1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// commandRoles 需要特定角色才能使用的命令，未列出的命令只需能使用 Bot
+// /role 不带参数时所有用户都可查看自己的角色，修改他人角色时在 handleRoleCommand 中检查
+var commandRoles = map[string]string{
+	"invite":    RoleAdmin,
+	"pending":   RoleAdmin,
+	"quota":     RoleAdmin,
+	"users":     RoleAdmin,
+	"broadcast": RoleAdmin,
+	"ban":       RoleAdmin,
+	"unban":     RoleAdmin,
+	"feeds":     RoleAdmin,
+	"aistats":   RoleAdmin,
+}
+
+// callbackRoles 需要特定角色才能使用的回调前缀
+var callbackRoles = map[string]string{
+	"role_": RoleAdmin,
+	"reg_":  RoleAdmin,
+	"bc_":   RoleAdmin,
+}
+
+// seedRoles 启动时把配置文件中的角色写入数据库
+// 所有者始终以配置文件为准；其他角色只覆盖同样来自配置文件且未被封禁的记录
+func seedRoles(config *Config) error {
+	seeds := make(map[int64]string)
+	for role, userIDs := range config.Roles {
+		for _, userID := range userIDs {
+			seeds[userID] = role
+		}
+	}
+	if config.ADMINIDS != 0 {
+		seeds[config.ADMINIDS] = RoleOwner
+	}
+	if len(seeds) == 0 {
+		return nil
+	}
+
+	return withDB(func(db *sql.DB) error {
+		for userID, role := range seeds {
+			query := `
+				INSERT INTO user_roles (user_id, role, updated_by, updated_at)
+				VALUES (?, ?, 0, CURRENT_TIMESTAMP)
+				ON CONFLICT(user_id) DO UPDATE SET role = excluded.role, updated_by = 0, updated_at = CURRENT_TIMESTAMP`
+			if role != RoleOwner {
+				query += `
+				WHERE user_roles.updated_by = 0 AND user_roles.role != '` + RoleBanned + `'`
+			}
+			if _, err := db.Exec(query, userID, role); err != nil {
+				return err
+			}
+		}
+		logMessage("info", fmt.Sprintf("已从配置文件载入 %d 个用户角色", len(seeds)))
+		return nil
+	})
+}
+
+// getUserRole 获取用户角色，没有记录时返回 RoleNone
+func getUserRole(userID int64) string {
+	var role string
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow("SELECT role FROM user_roles WHERE user_id = ?", userID).Scan(&role)
+	})
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logMessage("error", fmt.Sprintf("获取用户角色失败: %v", err), userID)
+		}
+		return RoleNone
+	}
+	return role
+}
+
+// setUserRole 设置用户角色
+// RoleNone 也保留一条记录，以免重启时被配置文件中的角色恢复
+func setUserRole(userID int64, role string, operatorID int64) error {
+	return withDB(func(db *sql.DB) error {
+		_, err := db.Exec(`
+			INSERT INTO user_roles (user_id, role, updated_by, updated_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(user_id) DO UPDATE SET
+				role = excluded.role, updated_by = excluded.updated_by, updated_at = CURRENT_TIMESTAMP`,
+			userID, role, operatorID)
+		return err
+	})
+}
+
+// getAllUserRoles 获取所有用户的角色
+func getAllUserRoles(db *sql.DB) (map[int64]string, error) {
+	rows, err := db.Query("SELECT user_id, role FROM user_roles")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make(map[int64]string)
+	for rows.Next() {
+		var userID int64
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+		roles[userID] = role
+	}
+	return roles, rows.Err()
+}
+
+// hasRole 判断角色是否达到要求的等级
+func hasRole(role, required string) bool {
+	return roleRank[role] >= roleRank[required]
+}
+
+// effectiveRole 返回用户实际生效的角色，开放模式下没有角色的用户视为普通用户
+func effectiveRole(role string) string {
+	if role == RoleNone && globalConfig.AccessMode == AccessModeOpen {
+		return RoleUser
+	}
+	return role
+}
+
+// canReceivePushes 判断用户能否接收推送，名单和审核模式下没有角色的用户不再推送
+// 群组由管理员按各自的角色管理，只在群组本身被封禁时停止推送
+func canReceivePushes(userID int64, role string) bool {
+	if isGroupID(userID) {
+		return role != RoleBanned
+	}
+	return hasRole(effectiveRole(role), RoleUser)
+}
+
+// checkAccess 检查用户能否执行需要 required 角色的操作，不能执行时返回提示
+func checkAccess(userID int64, required string) (bool, string) {
+	role := effectiveRole(getUserRole(userID))
+	switch {
+	case role == RoleBanned:
+		return false, "你已被禁止使用此 Bot"
+	case !hasRole(role, RoleUser):
+		return false, registrationNotice(userID)
+	case !hasRole(role, required):
+		return false, "你没有权限执行此操作"
+	}
+	return true, ""
+}
+
+// callbackRequiredRole 返回回调需要的角色
+func callbackRequiredRole(data string) string {
+	for prefix, role := range callbackRoles {
+		if strings.HasPrefix(data, prefix) {
+			return role
+		}
+	}
+	return RoleUser
+}
+
+// canAssignRole 判断操作者能否把目标用户改为指定角色
+// 所有者只能在配置文件中设置；管理员只能管理普通用户和封禁
+func canAssignRole(operatorRole, targetRole, newRole string) bool {
+	if targetRole == RoleOwner || newRole == RoleOwner {
+		return false
+	}
+	if operatorRole == RoleOwner {
+		return true
+	}
+	return operatorRole == RoleAdmin && !hasRole(targetRole, RoleAdmin) && !hasRole(newRole, RoleAdmin)
+}
+
+// handleRoleCommand 处理 /role 命令：/role 查看自己的角色，/role <用户ID> 管理指定用户的角色
+func handleRoleCommand(userID, operatorID int64, args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		role := getUserRole(operatorID)
+		sendMessage(userID, fmt.Sprintf("👤 你的用户ID：%d\n角色：%s\n访问模式：%s", operatorID, roleNames[role], globalConfig.AccessMode))
+		return
+	}
+	if ok, reason := checkAccess(operatorID, RoleAdmin); !ok {
+		sendMessage(userID, reason)
+		return
+	}
+	targetID, err := strconv.ParseInt(args, 10, 64)
+	if err != nil {
+		sendMessage(userID, "❌ 用法：/role <用户ID>")
+		return
+	}
+	showRoleOptions(userID, 0, operatorID, targetID)
+}
+
+// showRoleOptions 显示修改用户角色的按钮
+func showRoleOptions(userID int64, messageID int, operatorID, targetID int64) {
+	operatorRole := getUserRole(operatorID)
+	targetRole := getUserRole(targetID)
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, role := range []string{RoleAdmin, RoleUser, RoleBanned, RoleNone} {
+		if !canAssignRole(operatorRole, targetRole, role) {
+			continue
+		}
+		label := roleNames[role]
+		if role == targetRole {
+			label = "✅ " + label
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("role_%d_%s", targetID, role)))
+	}
+
+	text := fmt.Sprintf("👤 用户 %d\n当前角色：%s", targetID, roleNames[targetRole])
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(row) == 0 {
+		text += "\n\n你不能修改该用户的角色"
+	} else {
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "back_to_menu"),
+	))
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// handleRoleCallback 处理修改角色按钮，value 格式为 "<用户ID>_<角色>"
+func handleRoleCallback(userID int64, messageID int, operatorID int64, value string) {
+	parts := strings.SplitN(value, "_", 2)
+	if len(parts) != 2 {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	targetID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		messageSender.SendError(userID, messageID, "❌ 参数错误")
+		return
+	}
+	newRole := parts[1]
+	if _, ok := roleNames[newRole]; !ok {
+		messageSender.SendError(userID, messageID, "❌ 无效的角色")
+		return
+	}
+
+	if !canAssignRole(getUserRole(operatorID), getUserRole(targetID), newRole) {
+		messageSender.SendError(userID, messageID, "❌ 你不能把该用户设为此角色")
+		return
+	}
+	if err := setUserRole(targetID, newRole, operatorID); err != nil {
+		logMessage("error", fmt.Sprintf("设置用户角色失败: %v", err), operatorID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	logMessage("info", fmt.Sprintf("将用户 %d 的角色设为 %s", targetID, roleNames[newRole]), operatorID)
+	go updateUserCommands(targetID)
+	showRoleOptions(userID, messageID, operatorID, targetID)
+}
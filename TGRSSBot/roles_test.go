@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestSeedRolesKeepsOperatorChanges(t *testing.T) {
+	setupTestDB(t)
+	config := &Config{
+		ADMINIDS: 1,
+		Roles:    map[string][]int64{RoleAdmin: {2}, RoleUser: {3, 4}},
+	}
+	if err := seedRoles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// 运行中的封禁、降级和取消角色
+	for userID, role := range map[int64]string{2: RoleUser, 3: RoleBanned, 4: RoleNone} {
+		if err := setUserRole(userID, role, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seedRoles(config); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int64]string{1: RoleOwner, 2: RoleUser, 3: RoleBanned, 4: RoleNone}
+	for userID, role := range want {
+		if got := getUserRole(userID); got != role {
+			t.Errorf("getUserRole(%d) = %q, want %q", userID, got, role)
+		}
+	}
+}
+
+func TestCanReceivePushes(t *testing.T) {
+	globalConfig = &Config{AccessMode: AccessModeAllowlist}
+	tests := []struct {
+		userID int64
+		role   string
+		want   bool
+	}{
+		{1, RoleUser, true},
+		{1, RoleAdmin, true},
+		{1, RoleNone, false},
+		{1, RoleBanned, false},
+		{-100, RoleNone, true},
+		{-100, RoleBanned, false},
+	}
+	for _, tt := range tests {
+		if got := canReceivePushes(tt.userID, tt.role); got != tt.want {
+			t.Errorf("canReceivePushes(%d, %q) = %v, want %v", tt.userID, tt.role, got, tt.want)
+		}
+	}
+
+	globalConfig.AccessMode = AccessModeOpen
+	if !canReceivePushes(1, RoleNone) {
+		t.Error("canReceivePushes(1, none) = false in open mode, want true")
+	}
+}
@@ -63,11 +63,11 @@ func processMessageWithAI(ctx context.Context, aiHandler *AIHandler, msg *Messag
 
 	// 处理翻译
 	if userPrefs.AutoTranslate && globalConfig.AI.Features.Translation.Enabled {
-		if translateResult, err := aiHandler.HandleTranslateRequest(ctx, content, "", userPrefs.PreferredLang); err == nil {
+		if translateResult, err := aiHandler.TranslateForUser(ctx, userPrefs.UserID, content, "", userPrefs.PreferredLang); err == nil {
 			processed.Translated = translateResult
 			hasAIProcessing = true
 			logMessage("debug", "AI翻译完成")
-		} else {
+		} else if err != ErrAIQuotaExceeded {
 			logMessage("warn", fmt.Sprintf("AI翻译失败: %v", err))
 		}
 	}
@@ -80,11 +80,11 @@ func processMessageWithAI(ctx context.Context, aiHandler *AIHandler, msg *Messag
 		}
 		minLength := globalConfig.AI.Features.Summarization.MinLength
 
-		if summaryResult, err := aiHandler.HandleSummarizeRequest(ctx, content, maxLength, minLength); err == nil {
+		if summaryResult, err := aiHandler.SummarizeForUser(ctx, userPrefs.UserID, content, maxLength, minLength); err == nil {
 			processed.Summary = summaryResult
 			hasAIProcessing = true
 			logMessage("debug", "AI摘要完成")
-		} else {
+		} else if err != ErrAIQuotaExceeded {
 			logMessage("warn", fmt.Sprintf("AI摘要失败: %v", err))
 		}
 	}
@@ -93,16 +93,74 @@ func processMessageWithAI(ctx context.Context, aiHandler *AIHandler, msg *Messag
 	return processed, nil
 }
 
-// sendProcessedMessage 发送处理后的消息
-func sendProcessedMessage(userID int64, sub Subscription, processedMsg *ProcessedMessage, formattedKeywords string) {
+// digestModeFor 返回推送应加入的摘要方式，即时推送时返回空字符串
+// 紧急关键词不进入摘要，始终即时推送
+func digestModeFor(userID int64, rssName string, urgent bool) string {
+	if urgent {
+		return ""
+	}
+	if mode := getEffectiveDeliveryMode(userID, rssName); mode != DeliveryInstant {
+		return mode
+	}
+	return ""
+}
+
+// deliverProcessedMessage 投递处理后的消息
+// digestMode 不为空时加入摘要队列；处于免打扰时段或暂停推送时暂存，待结束后合并补发
+func deliverProcessedMessage(userID int64, sub Subscription, processedMsg *ProcessedMessage, matchedKeywords []string, digestMode string, urgent bool, pushID int64) {
+	if digestMode != "" {
+		err := queueDigestItem(userID, digestMode, sub.Name, processedMsg.Original, matchedKeywords)
+		if err == nil {
+			logMessage("debug", fmt.Sprintf("推送已加入%s: %s", deliveryModeNames[digestMode], processedMsg.Original.Title), userID)
+			return
+		}
+		// 入队失败时继续即时推送，避免丢失消息
+		logMessage("error", fmt.Sprintf("加入摘要队列失败: %v", err), userID)
+	}
+
+	formattedKeywords := formatKeywordCodes(matchedKeywords)
+	if shouldDeferPush(userID, urgent) {
+		htmlMessage, _ := buildPushMessage(userID, sub, processedMsg, formattedKeywords)
+		if err := queueDeferredPush(userID, sub.Name, htmlMessage); err != nil {
+			logMessage("error", fmt.Sprintf("暂存推送失败: %v", err), userID)
+			// 暂存失败时直接推送，避免丢失消息
+			sendProcessedMessage(userID, sub, processedMsg, formattedKeywords, pushID)
+			return
+		}
+		logMessage("debug", fmt.Sprintf("免打扰中，推送已暂存: %s", processedMsg.Original.Title), userID)
+		return
+	}
+	sendProcessedMessage(userID, sub, processedMsg, formattedKeywords, pushID)
+}
+
+// formatKeywordCodes 格式化关键词列表，每个关键词单独用code标签包裹
+func formatKeywordCodes(keywords []string) string {
+	keywordCodes := make([]string, len(keywords))
+	for i, kw := range keywords {
+		keywordCodes[i] = fmt.Sprintf("<code>%s</code>", kw)
+	}
+	return strings.Join(keywordCodes, " ")
+}
+
+// sendProcessedMessage 发送处理后的消息，pushID 为去重用的推送记录ID
+func sendProcessedMessage(userID int64, sub Subscription, processedMsg *ProcessedMessage, formattedKeywords string, pushID int64) {
+	htmlMessage, imageURL := buildPushMessage(userID, sub, processedMsg, formattedKeywords)
+
+	// 有图片时发送图片消息，并记录消息ID以便合并重复内容
+	go sendTrackedPush(userID, sub.Name, imageURL, htmlMessage, pushID)
+}
+
+// buildPushMessage 构造推送消息内容，返回HTML文本和图片URL（频道模式）
+func buildPushMessage(userID int64, sub Subscription, processedMsg *ProcessedMessage, formattedKeywords string) (string, string) {
 	msg := processedMsg.Original
-	formattedDate := msg.PubDate.In(time.FixedZone("CST", 8*60*60)).Format("2006-01-02 15:04:05")
+	formattedDate := formatTimeForUser(userID, msg.PubDate)
 	
 	var htmlMessage string
+	var imageURL string
 	
 	if sub.Channel == 1 {
 		// 频道模式：显示完整内容
-		imageURL := extractImageURL(msg.Description)
+		imageURL = extractImageURL(msg.Description)
 		
 		if processedMsg.HasAI {
 			// 使用AI处理后的格式
@@ -112,13 +170,6 @@ func sendProcessedMessage(userID int64, sub Subscription, processedMsg *Processe
 			cleanDescription := cleanHTMLContent(msg.Description)
 			htmlMessage = fmt.Sprintf("👋 %s: %s\n🕒 %s\n%s\n", sub.Name, formattedKeywords, formattedDate, cleanDescription)
 		}
-		
-		// 根据是否有图片决定发送方式
-		if imageURL != "" {
-			go sendPhotoMessage(userID, imageURL, htmlMessage)
-		} else {
-			go sendHTMLMessage(userID, htmlMessage)
-		}
 	} else {
 		// 链接模式：显示标题和链接
 		htmlMessage = fmt.Sprintf("📌 %s\n🔖 关键词: %s\n🕒 %s", msg.Title, formattedKeywords, formattedDate)
@@ -134,8 +185,9 @@ func sendProcessedMessage(userID int64, sub Subscription, processedMsg *Processe
 		}
 		
 		htmlMessage += fmt.Sprintf("\n🔗 %s", msg.Link)
-		go sendHTMLMessage(userID, htmlMessage)
 	}
+
+	return htmlMessage, imageURL
 }
 
 // formatAIEnhancedMessage 格式化AI增强的消息
@@ -216,7 +268,8 @@ func parseUserIDs(usersStr string) []int64 {
 	var userIDs []int64
 	for _, idStr := range strings.Split(usersStr, ",") {
 		var id int64
-		if n, _ := fmt.Sscanf(strings.TrimSpace(idStr), "%d", &id); n == 1 && id > 0 {
+		// 群组的会话ID为负数
+		if n, _ := fmt.Sscanf(strings.TrimSpace(idStr), "%d", &id); n == 1 && id != 0 {
 			userIDs = append(userIDs, id)
 		}
 	}
@@ -286,6 +339,7 @@ func fetchRSS(db *sql.DB, sub Subscription, client *http.Client) ([]Message, err
 	if err != nil {
 		return nil, err
 	}
+	metricFeedItemsParsed.Add(float64(len(feed.Items)), sub.Name)
 
 	if len(feed.Items) == 0 {
 		return nil, nil
@@ -315,6 +369,8 @@ func fetchRSS(db *sql.DB, sub Subscription, client *http.Client) ([]Message, err
 				Description: item.Description,
 				Link:        item.Link,
 				PubDate:     pubTime,
+				Author:      getItemAuthor(item),
+				Categories:  item.Categories,
 			})
 		}
 	}
@@ -338,7 +394,21 @@ func getItemTime(item *gofeed.Item) time.Time {
 	return time.Now().UTC()
 }
 
-// 获取上次更新时间
+// 获取RSS项目的作者，多个作者用逗号连接
+func getItemAuthor(item *gofeed.Item) string {
+	var names []string
+	for _, author := range item.Authors {
+		if author != nil && author.Name != "" {
+			names = append(names, author.Name)
+		}
+	}
+	if len(names) == 0 && item.Author != nil {
+		names = append(names, item.Author.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// 获取上次更新时间，feed_data 中的时间统一按UTC保存
 func getLastUpdateTime(db *sql.DB, rssName string) (time.Time, error) {
 	var timeStr string
 	err := db.QueryRow("SELECT last_update_time FROM feed_data WHERE rss_name = ?", rssName).Scan(&timeStr)
@@ -346,7 +416,7 @@ func getLastUpdateTime(db *sql.DB, rssName string) (time.Time, error) {
 	if err == sql.ErrNoRows {
 		// 首次运行，插入记录
 		_, err = db.Exec("INSERT INTO feed_data (rss_name, last_update_time, latest_title) VALUES (?, ?, ?)",
-			rssName, time.Now().Format("2006-01-02 15:04:05"), "")
+			rssName, time.Now().UTC().Format("2006-01-02 15:04:05"), "")
 		return time.Time{}, err
 	}
 
@@ -360,21 +430,28 @@ func getLastUpdateTime(db *sql.DB, rssName string) (time.Time, error) {
 // 更新最后更新时间
 func updateLastTime(db *sql.DB, rssName string, updateTime time.Time, title string) {
 	_, err := db.Exec("UPDATE feed_data SET last_update_time = ?, latest_title = ? WHERE rss_name = ?",
-		updateTime.Format("2006-01-02 15:04:05"), title, rssName)
+		updateTime.UTC().Format("2006-01-02 15:04:05"), title, rssName)
 	if err != nil {
 		logMessage("error", fmt.Sprintf("更新时间失败: %v", err))
 	}
 }
 
 // 检查消息是否匹配关键词，返回匹配到的关键词列表
-func matchesKeywords(msg Message, keywords []string) []string {
+// 推送流程使用预编译的 KeywordEngine，这里保留逐条匹配的实现作为规则参照和基准测试对照
+func matchesKeywords(msg Message, keywords []string, fold bool) []string {
 	if len(keywords) == 0 {
 		return nil
 	}
 
 	var matchedKeywords []string
 	var blockedKeywords []string
+	// 开启中文归一化时，内容和关键词都先做全角折叠和繁简转换
+	original := msg
+	if fold {
+		msg = foldMessage(msg)
+	}
 	content := strings.ToLower(msg.Title + " " + msg.Description)
+	var exprDoc *exprDocument
 
 	// 首先检查是否命中屏蔽词
 	for _, keyword := range keywords {
@@ -382,6 +459,8 @@ func matchesKeywords(msg Message, keywords []string) []string {
 		if keyword == "" {
 			continue
 		}
+		// 紧急关键词前缀不参与匹配
+		keyword = strings.TrimPrefix(keyword, UrgentKeywordPrefix)
 		// 检查是否是屏蔽关键词
 		isBlockKeyword := strings.HasPrefix(keyword, "-")
 		if isBlockKeyword {
@@ -389,34 +468,79 @@ func matchesKeywords(msg Message, keywords []string) []string {
 			//fmt.Println("屏蔽关键词:", keyword)
 		}
 
-		// 将关键词转为小写
-		lowerKeyword := strings.ToLower(keyword)
-
-		// 检查是否包含通配符
-		if strings.Contains(lowerKeyword, "*") {
-			//fmt.Println(lowerKeyword)
-			// 将通配符转换为正则表达式
-			pattern := strings.ReplaceAll(lowerKeyword, "*", ".*")
-			pattern = "^.*" + pattern + ".*$"
-
-			// 编译正则表达式
-			re, err := regexp.Compile(pattern)
-			if err == nil && re.MatchString(content) {
-				if isBlockKeyword {
-					blockedKeywords = append(blockedKeywords, keyword)
-				} else {
-					matchedKeywords = append(matchedKeywords, keyword)
-				}
+		// 返回给用户的是原始关键词，匹配使用归一化后的关键词
+		display := keyword
+		if fold && !isPinyinKeyword(keyword) {
+			keyword = foldChineseText(keyword)
+		}
+
+		var matched bool
+		switch {
+		case isPinyinKeyword(display):
+			// 拼音关键词匹配内容的拼音
+			text, err := pinyinKeywordText(display)
+			if err != nil {
+				logMessage("debug", fmt.Sprintf("拼音关键词[%s]无效: %v", display, err))
 				continue
 			}
+			matched = strings.Contains(toPinyinText(original.Title+" "+original.Description), text)
+
+		case isRegexKeyword(keyword):
+			// 正则关键词按 /pattern/flags 匹配原始内容
+			re, err := compileRegexKeyword(keyword)
+			if err != nil {
+				logMessage("debug", fmt.Sprintf("正则关键词[%s]无效: %v", display, err))
+				continue
+			}
+			matched = re.MatchString(msg.Title + " " + msg.Description)
+
+		case hasKeywordModifiers(keyword) || isNearKeyword(keyword):
+			// 带修饰符的关键词和 NEAR 邻近关键词
+			modified, err := compileModifiedKeyword(keyword)
+			if err != nil {
+				logMessage("debug", fmt.Sprintf("关键词[%s]无效: %v", display, err))
+				continue
+			}
+			matched = modified.match(msg.Title+" "+msg.Description, content)
+
+		case isKeywordExpression(keyword):
+			// expr: 前缀的关键词按表达式规则匹配
+			expr, err := ParseKeywordExpr(keywordExprText(keyword))
+			if err != nil {
+				logMessage("debug", fmt.Sprintf("关键词表达式[%s]无效: %v", display, err))
+				continue
+			}
+			if exprDoc == nil {
+				exprDoc = newExprDocument(msg)
+			}
+			matched = expr.match(exprDoc)
+
+		default:
+			// 将关键词转为小写
+			lowerKeyword := strings.ToLower(keyword)
+
+			// 检查是否包含通配符
+			if strings.Contains(lowerKeyword, "*") {
+				// 将通配符转换为正则表达式
+				pattern := strings.ReplaceAll(lowerKeyword, "*", ".*")
+				pattern = "^.*" + pattern + ".*$"
+
+				// 编译正则表达式
+				re, err := regexp.Compile(pattern)
+				matched = err == nil && re.MatchString(content)
+			}
+
+			// 如果没有通配符或正则表达式失败，使用普通匹配
+			if !matched {
+				matched = strings.Contains(content, lowerKeyword)
+			}
 		}
 
-		// 如果没有通配符或正则表达式失败，使用普通匹配
-		if strings.Contains(content, lowerKeyword) {
+		if matched {
 			if isBlockKeyword {
-				blockedKeywords = append(blockedKeywords, keyword)
+				blockedKeywords = append(blockedKeywords, display)
 			} else {
-				matchedKeywords = append(matchedKeywords, keyword)
+				matchedKeywords = append(matchedKeywords, display)
 			}
 		}
 	}
@@ -431,21 +555,37 @@ func matchesKeywords(msg Message, keywords []string) []string {
 	return matchedKeywords
 }
 
+// rssCheckData 一轮检查中所有订阅共享的用户设置和关键词引擎
+type rssCheckData struct {
+	userKeywords  map[int64][]string            // 用户ID -> 关键词
+	keywordScopes map[int64]map[string][]string // 用户ID -> 关键词 -> 生效订阅
+	foldingUsers  map[int64]bool                // 开启中文归一化的用户
+	receiveAll    map[int64]map[string]bool     // 用户ID -> 全量推送的订阅
+	destinations  map[string][]*Destination     // 订阅名称 -> 推送目标
+	roles         map[int64]string              // 用户ID -> 角色
+	engine        *KeywordEngine
+}
+
 // 处理单个订阅
-func processSubscription(db *sql.DB, sub Subscription, userKeywords map[int64][]string, client *http.Client) {
+func processSubscription(db *sql.DB, sub Subscription, data *rssCheckData, client *http.Client) {
 	if cyclenum == 0 {
 		logMessage("info", fmt.Sprintf("处理订阅: %s (%s)", sub.Name, sub.URL))
 	}
+	fetchStart := time.Now()
 	messages, err := fetchRSS(db, sub, client)
+	observeFeedFetch(sub.Name, time.Since(fetchStart), err)
+	recordFeedCheck(db, sub.Name, err)
 	if err != nil {
 		logMessage("error", fmt.Sprintf("获取RSS失败 %s: %v", sub.Name, err))
 		return
 	}
+	metricFeedItemsNew.Add(float64(len(messages)), sub.Name)
 
 	if len(messages) == 0 {
 		logMessage("debug", fmt.Sprintf("订阅 %s 无新内容", sub.Name))
 		return
 	}
+	saveRecentItems(db, sub.Name, messages)
 
 	// 初始化AI处理器（如果启用）
 	var aiHandler *AIHandler
@@ -455,27 +595,51 @@ func processSubscription(db *sql.DB, sub Subscription, userKeywords map[int64][]
 		}
 	}
 
+	// 关键词命中统计，处理完成后一次性写入
+	hitCounter := newKeywordHitCounter(sub.Name)
+
 	// 处理推送
 	pushCount := 0
 	for _, msg := range messages {
+		// 每条消息只扫描一次，所有用户共享匹配结果
+		matcher := data.engine.NewMessageMatcher(msg)
 		for _, userID := range sub.Users {
-			keywords := userKeywords[userID]
-			if len(keywords) == 0 {
+			if !canReceivePushes(userID, data.roles[userID]) {
+				continue // 已封禁或没有使用权限的用户不再推送
+			}
+			// 只保留对当前订阅生效的关键词
+			keywords := keywordsForSubscription(data.userKeywords[userID], data.keywordScopes[userID], sub.Name)
+			receiveAllSub := data.receiveAll[userID][sub.Name]
+			if len(keywords) == 0 && !receiveAllSub {
 				continue // 用户没有设置关键词且不是全量推送，跳过
 			}
-			matchedKeywords := matchesKeywords(msg, keywords)
+			hits := matcher.MatchHits(keywords, data.foldingUsers[userID])
+			hitCounter.add(userID, hits)
+			matchedKeywords := matchedKeywordsFromHits(hits, msg.Title)
+			if receiveAllSub && len(matchedKeywords) == 0 && !hasBlockedHit(hits) {
+				matchedKeywords = []string{ReceiveAllLabel}
+			}
 
 			// 如果匹配到关键词或是全量推送，则发送消息
 			if len(matchedKeywords) > 0 {
+				metricFeedMatches.Inc(sub.Name)
+				// 跨订阅去重，重复内容不再推送
+				pushID, duplicate := checkDuplicatePush(userID, sub.Name, msg, client)
+				if duplicate {
+					continue
+				}
+
 				pushCount++
 				logMessage("debug", fmt.Sprintf("关键词[%s]匹配 推送给用户 %d: %s",
 					strings.Join(matchedKeywords, ", "), userID, msg.Title))
-				
-				recordPush(sub.Name)
-				
+
+				// 摘要只包含标题和链接，加入摘要的条目不做AI处理，避免浪费调用和用户配额
+				urgent := isUrgentMatch(matchedKeywords, keywords)
+				digestMode := digestModeFor(userID, sub.Name, urgent)
+
 				// 获取用户AI偏好设置
 				var processedMsg *ProcessedMessage
-				if aiHandler != nil {
+				if aiHandler != nil && digestMode == "" {
 					userPrefs, err := GetUserAIPreferences(userID)
 					if err != nil {
 						logMessage("warn", fmt.Sprintf("获取用户AI偏好失败: %v", err))
@@ -505,26 +669,16 @@ func processSubscription(db *sql.DB, sub Subscription, userKeywords map[int64][]
 						processedMsg = &ProcessedMessage{Original: &msg, HasAI: false}
 					}
 				} else {
-					// AI未启用，使用原始消息
+					// AI未启用或加入摘要，使用原始消息
 					processedMsg = &ProcessedMessage{Original: &msg, HasAI: false}
 				}
 				
-				// 格式化关键词列表，每个关键词单独用code标签包裹
-				var formattedKeywords string
-				if len(matchedKeywords) > 0 {
-					keywordCodes := make([]string, len(matchedKeywords))
-					for i, kw := range matchedKeywords {
-						keywordCodes[i] = fmt.Sprintf("<code>%s</code>", kw)
-					}
-					formattedKeywords = strings.Join(keywordCodes, " ")
-				}
-				
-				// 构造和发送消息
-				sendProcessedMessage(userID, sub, processedMsg, formattedKeywords)
+				// 构造和投递消息（摘要模式入队，免打扰期间暂存）
+				deliverProcessedMessage(userID, sub, processedMsg, matchedKeywords, digestMode, urgent, pushID)
 				
 				// 给管理员发送简化版本
 				if userID == globalConfig.ADMINIDS {
-					formattedDate := msg.PubDate.In(time.FixedZone("CST", 8*60*60)).Format("2006-01-02 15:04:05")
+					formattedDate := formatTimeForUser(userID, msg.PubDate)
 					var otherpush string
 					if sub.Channel == 1 {
 						cleanDescription := cleanHTMLContent(msg.Description)
@@ -536,6 +690,16 @@ func processSubscription(db *sql.DB, sub Subscription, userKeywords map[int64][]
 				}
 			}
 		}
+
+		// 推送到用户添加的群组和频道
+		for _, dest := range data.destinations[sub.Name] {
+			if deliverToDestination(dest, sub, msg, matcher, data) {
+				pushCount++
+			}
+		}
+	}
+	if err := hitCounter.flush(db); err != nil {
+		logMessage("warn", fmt.Sprintf("保存关键词命中统计失败 %s: %v", sub.Name, err))
 	}
 	logMessage("info", fmt.Sprintf("订阅 %s 完成，推送 %d 条消息", sub.Name, pushCount))
 }
@@ -550,6 +714,7 @@ func checkAllRSS(db *sql.DB) {
 	defer db.Close()
 	startTime := time.Now()
 	resetPushStatsIfNeeded()
+	resetCanonicalBudget()
 	logMessage("info", "开始检查RSS订阅...")
 
 	// 获取数据
@@ -561,15 +726,65 @@ func checkAllRSS(db *sql.DB) {
 
 	if len(subscriptions) == 0 {
 		logMessage("info", "没有找到RSS订阅")
+		observeCheckCycle(time.Since(startTime))
 		return
 	}
 
+	// 按用户配额的最小轮询间隔跳过未到时间的订阅
+	subscriptions = filterSubscriptionsByPollInterval(db, subscriptions)
+
 	userKeywords, err := getUserKeywords(db)
 	if err != nil {
 		logMessage("error", fmt.Sprintf("获取用户关键词失败: %v", err))
 		return
 	}
 
+	keywordScopes, err := getAllKeywordScopes(db)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取关键词范围失败: %v", err))
+		return
+	}
+
+	foldingUsers, err := getTextFoldingUsers(db)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取简繁归一设置失败: %v", err))
+		return
+	}
+
+	receiveAll, err := getAllReceiveAllSubscriptions(db)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取全量推送设置失败: %v", err))
+		return
+	}
+
+	destinations, err := getActiveDestinations(db)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取推送目标失败: %v", err))
+		return
+	}
+
+	roles, err := getAllUserRoles(db)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户角色失败: %v", err))
+		return
+	}
+
+	data := &rssCheckData{
+		userKeywords:  userKeywords,
+		keywordScopes: keywordScopes,
+		foldingUsers:  foldingUsers,
+		receiveAll:    receiveAll,
+		destinations:  destinations,
+		roles:         roles,
+	}
+	// 关键词未变化时复用已编译的匹配引擎，推送目标单独的关键词一并编译
+	data.engine = getKeywordEngine(engineKeywords(userKeywords, destinations))
+
+	// 清理过期的关键词命中明细和推送记录
+	pruneKeywordHits(db)
+	prunePushHistory(db)
+	pruneRecentItems(db)
+
 	client := createHTTPClient(globalConfig.ProxyURL)
 
 	// 并发处理订阅
@@ -578,11 +793,12 @@ func checkAllRSS(db *sql.DB) {
 		wg.Add(1)
 		go func(sub Subscription) {
 			defer wg.Done()
-			processSubscription(db, sub, userKeywords, client)
+			processSubscription(db, sub, data, client)
 		}(sub)
 	}
 
 	wg.Wait()
+	observeCheckCycle(time.Since(startTime))
 	logMessage("info", fmt.Sprintf("RSS检查完成，耗时: %v", time.Since(startTime)))
 	cyclenum = 1
 	// 打印当前的推送统计
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // 内嵌时区数据库，避免精简系统缺少zoneinfo
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UserSettings 用户个性化设置
+type UserSettings struct {
+	UserID      int64     `json:"user_id"`
+	Timezone    string    `json:"timezone"`     // IANA时区名称，如 Asia/Shanghai，空表示跟随全局配置
+	DateFormat  string    `json:"date_format"`  // Go时间布局，空表示跟随全局配置
+	QuietStart  string    `json:"quiet_start"`  // 免打扰开始时间 HH:MM，空表示未启用
+	QuietEnd    string    `json:"quiet_end"`    // 免打扰结束时间 HH:MM
+	SnoozeUntil time.Time `json:"snooze_until"` // 暂停推送截止时间，零值表示未暂停
+
+	DeliveryMode     string `json:"delivery_mode"`      // 推送方式：instant/hourly/daily/weekly
+	DigestTime       string `json:"digest_time"`        // 每日/每周摘要发送时间 HH:MM
+	DigestWeekday    int    `json:"digest_weekday"`     // 每周摘要发送日，0表示周日
+	DigestAIOverview bool   `json:"digest_ai_overview"` // 摘要顶部是否附带AI概览
+
+	TextFolding bool `json:"text_folding"` // 关键词匹配时是否做简繁和全角半角归一
+
+	DedupWindow int    `json:"dedup_window"` // 跨订阅去重窗口（小时），0表示关闭
+	DedupMode   string `json:"dedup_mode"`   // 去重方式：fold/drop
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DateFormatOption 可选的时间格式
+type DateFormatOption struct {
+	Layout  string // Go时间布局
+	Example string // 展示给用户的示例
+}
+
+// 预定义的时间格式
+var DateFormatOptions = []DateFormatOption{
+	{Layout: "2006-01-02 15:04:05", Example: "2025-06-06 22:34:02"},
+	{Layout: "2006-01-02 15:04", Example: "2025-06-06 22:34"},
+	{Layout: "2006/01/02 15:04", Example: "2025/06/06 22:34"},
+	{Layout: "01/02/2006 03:04 PM", Example: "06/06/2025 10:34 PM"},
+	{Layout: "02.01.2006 15:04", Example: "06.06.2025 22:34"},
+	{Layout: "Jan 2, 2006 15:04 MST", Example: "Jun 6, 2025 22:34 CST"},
+}
+
+// 常用时区，用于设置菜单的快捷按钮
+var CommonTimezones = []string{
+	"Asia/Shanghai",
+	"Asia/Tokyo",
+	"Asia/Singapore",
+	"Europe/London",
+	"Europe/Berlin",
+	"America/New_York",
+	"America/Los_Angeles",
+	"UTC",
+}
+
+// 语言代码到时区的推断表，仅包含能较可靠推断的语言
+var languageTimezones = map[string]string{
+	"zh":      "Asia/Shanghai",
+	"zh-hans": "Asia/Shanghai",
+	"zh-cn":   "Asia/Shanghai",
+	"zh-hant": "Asia/Taipei",
+	"zh-tw":   "Asia/Taipei",
+	"zh-hk":   "Asia/Hong_Kong",
+	"ja":      "Asia/Tokyo",
+	"ko":      "Asia/Seoul",
+	"ru":      "Europe/Moscow",
+	"de":      "Europe/Berlin",
+	"fr":      "Europe/Paris",
+	"it":      "Europe/Rome",
+	"uk":      "Europe/Kyiv",
+	"th":      "Asia/Bangkok",
+	"vi":      "Asia/Ho_Chi_Minh",
+	"id":      "Asia/Jakarta",
+}
+
+// defaultUserSettings 返回默认设置，时区和时间格式留空以跟随全局配置
+func defaultUserSettings(userID int64) *UserSettings {
+	return &UserSettings{
+		UserID:        userID,
+		DeliveryMode:  DeliveryInstant,
+		DigestTime:    DefaultDigestTime,
+		DigestWeekday: int(time.Monday),
+		DedupMode:     DedupModeFold,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// GetUserSettings 获取用户设置，不存在时返回默认设置
+func GetUserSettings(userID int64) (*UserSettings, error) {
+	settings := defaultUserSettings(userID)
+	var snoozeUntil sql.NullTime
+
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow(`
+			SELECT timezone, date_format, quiet_start, quiet_end, snooze_until,
+				   delivery_mode, digest_time, digest_weekday, digest_ai_overview,
+				   text_folding, dedup_window, dedup_mode, created_at, updated_at
+			FROM user_settings WHERE user_id = ?`, userID).Scan(
+			&settings.Timezone, &settings.DateFormat, &settings.QuietStart, &settings.QuietEnd, &snoozeUntil,
+			&settings.DeliveryMode, &settings.DigestTime, &settings.DigestWeekday, &settings.DigestAIOverview,
+			&settings.TextFolding, &settings.DedupWindow, &settings.DedupMode, &settings.CreatedAt, &settings.UpdatedAt)
+	})
+
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if snoozeUntil.Valid {
+		settings.SnoozeUntil = snoozeUntil.Time
+	}
+	if !isValidDeliveryMode(settings.DeliveryMode) {
+		settings.DeliveryMode = DeliveryInstant
+	}
+	if settings.DigestTime == "" {
+		settings.DigestTime = DefaultDigestTime
+	}
+	if !isValidDedupMode(settings.DedupMode) {
+		settings.DedupMode = DedupModeFold
+	}
+	return settings, nil
+}
+
+// timezoneName 返回生效的时区名称，未设置时为全局配置
+func (s *UserSettings) timezoneName() string {
+	if s.Timezone == "" {
+		return globalConfig.Timezone
+	}
+	return s.Timezone
+}
+
+// dateLayout 返回生效的时间格式，未设置时为全局配置
+func (s *UserSettings) dateLayout() string {
+	if s.DateFormat == "" {
+		return globalConfig.DateFormat
+	}
+	return s.DateFormat
+}
+
+// settingColumns 可以通过 UpdateUserSettingFields 修改的列
+var settingColumns = map[string]bool{
+	"timezone":           true,
+	"date_format":        true,
+	"quiet_start":        true,
+	"quiet_end":          true,
+	"snooze_until":       true,
+	"delivery_mode":      true,
+	"digest_time":        true,
+	"digest_weekday":     true,
+	"digest_ai_overview": true,
+	"text_folding":       true,
+	"dedup_window":       true,
+	"dedup_mode":         true,
+}
+
+// UpdateUserSettingFields 只更新指定的设置列，记录不存在时先按默认值创建
+// 每次只写入改动的列，同时进行的其他设置修改不会被覆盖
+func UpdateUserSettingFields(userID int64, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if !settingColumns[column] {
+			return fmt.Errorf("未知的设置项: %s", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	assignments := make([]string, 0, len(columns)+1)
+	args := make([]interface{}, 0, len(columns)+2)
+	for _, column := range columns {
+		assignments = append(assignments, column+" = ?")
+		args = append(args, fields[column])
+	}
+	assignments = append(assignments, "updated_at = ?")
+	args = append(args, time.Now(), userID)
+
+	return withDB(func(db *sql.DB) error {
+		if _, err := db.Exec("INSERT OR IGNORE INTO user_settings (user_id) VALUES (?)", userID); err != nil {
+			return err
+		}
+		_, err := db.Exec("UPDATE user_settings SET "+strings.Join(assignments, ", ")+" WHERE user_id = ?", args...)
+		return err
+	})
+}
+
+// hasUserSettings 检查用户是否已保存过设置
+func hasUserSettings(userID int64) bool {
+	var count int
+	err := withDB(func(db *sql.DB) error {
+		return db.QueryRow("SELECT COUNT(*) FROM user_settings WHERE user_id = ?", userID).Scan(&count)
+	})
+	return err == nil && count > 0
+}
+
+// inferTimezone 根据Telegram客户端语言推断时区，无法推断时返回空字符串
+func inferTimezone(languageCode string) string {
+	code := strings.ToLower(languageCode)
+	if tz, ok := languageTimezones[code]; ok {
+		return tz
+	}
+	// 尝试只用主语言部分，如 "de-at" -> "de"
+	if idx := strings.Index(code, "-"); idx > 0 {
+		if tz, ok := languageTimezones[code[:idx]]; ok {
+			return tz
+		}
+	}
+	return ""
+}
+
+// initUserSettingsIfNeeded 首次使用时根据客户端语言初始化时区
+// 群组按发起命令的管理员的客户端语言推断，无法推断时不保存，继续跟随全局配置
+func initUserSettingsIfNeeded(userID int64, languageCode string) {
+	if hasUserSettings(userID) {
+		return
+	}
+	tz := inferTimezone(languageCode)
+	if tz == "" {
+		return
+	}
+
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"timezone": tz}); err != nil {
+		logMessage("warn", fmt.Sprintf("初始化用户设置失败: %v", err), userID)
+		return
+	}
+	logMessage("debug", fmt.Sprintf("已为用户推断时区: %s (语言: %s)", tz, languageCode), userID)
+}
+
+// loadLocation 加载时区，为空或失败时回退到全局默认时区
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		name = globalConfig.Timezone
+	}
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	}
+	if loc, err := time.LoadLocation(globalConfig.Timezone); err == nil {
+		return loc
+	}
+	return time.FixedZone("CST", 8*60*60)
+}
+
+// getUserLocation 获取用户所在时区
+func getUserLocation(userID int64) *time.Location {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		return loadLocation(globalConfig.Timezone)
+	}
+	return loadLocation(settings.Timezone)
+}
+
+// formatTimeForUser 按用户时区和时间格式格式化时间
+func formatTimeForUser(userID int64, t time.Time) string {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		settings = defaultUserSettings(userID)
+	}
+	return t.In(loadLocation(settings.Timezone)).Format(settings.dateLayout())
+}
+
+// formatFeedUpdateTime 格式化feed_data中记录的更新时间（UTC）
+func formatFeedUpdateTime(userID int64, value string) string {
+	if value == "" {
+		return ""
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.UTC)
+	if err != nil {
+		return value
+	}
+	return formatTimeForUser(userID, t)
+}
+
+// showSettingsMenu 显示设置菜单
+func showSettingsMenu(userID int64, messageID int) {
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		logMessage("error", fmt.Sprintf("获取用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "获取设置失败，请稍后重试")
+		return
+	}
+
+	loc := loadLocation(settings.Timezone)
+	now := time.Now().In(loc).Format(settings.dateLayout())
+	text := fmt.Sprintf(`⚙️ 个人设置
+
+🌍 时区：%s
+📅 时间格式：%s
+🕒 当前时间：%s
+🌙 免打扰：%s
+⏸ 暂停推送：%s
+📬 推送方式：%s
+🈶 简繁/全角归一：%s
+🔁 跨订阅去重：%s
+
+推送时间、订阅更新时间和统计信息都会按此设置显示。
+开启归一后，关键词匹配不区分简繁体和全角半角，例如 显卡 可匹配 顯卡，RTX 可匹配 ＲＴＸ。`,
+		settings.timezoneName(), settings.dateLayout(), now,
+		describeQuietHours(settings), describeSnooze(settings), describeDeliveryMode(settings, ""),
+		describeSwitch(settings.TextFolding), describeDedup(settings))
+
+	foldingLabel := "🈶 开启简繁/全角归一"
+	if settings.TextFolding {
+		foldingLabel = "🈶 关闭简繁/全角归一"
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🌍 设置时区", "set_timezone"),
+			tgbotapi.NewInlineKeyboardButtonData("📅 时间格式", "set_datefmt"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🌙 免打扰时段", "set_quiet_hours"),
+			tgbotapi.NewInlineKeyboardButtonData("⏸ 暂停推送", "snooze_menu"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📬 推送方式", "delivery_menu"),
+			tgbotapi.NewInlineKeyboardButtonData("🔁 跨订阅去重", "dedup_menu"),
+		),
+	}
+	// 群组本身就是推送目标，不再转发到其他群组或频道
+	if !isGroupID(userID) {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📢 群组/频道推送", "dest_menu"),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(foldingLabel, "toggle_text_folding"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "back_to_menu"),
+		),
+	)
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// describeSwitch 返回开关状态的文字描述
+func describeSwitch(on bool) string {
+	if on {
+		return "已开启"
+	}
+	return "未开启"
+}
+
+// toggleTextFolding 切换关键词中文归一化开关
+func toggleTextFolding(userID int64, messageID int) {
+	settings, err := GetUserSettings(userID)
+	if err == nil {
+		err = UpdateUserSettingFields(userID, map[string]interface{}{"text_folding": !settings.TextFolding})
+	}
+	if err != nil {
+		logMessage("error", fmt.Sprintf("设置简繁归一失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置失败，请稍后重试")
+		return
+	}
+	showSettingsMenu(userID, messageID)
+}
+
+// getTextFoldingUsers 获取开启中文归一化的用户
+func getTextFoldingUsers(db *sql.DB) (map[int64]bool, error) {
+	rows, err := db.Query("SELECT user_id FROM user_settings WHERE text_folding = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[int64]bool)
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users[userID] = true
+	}
+	return users, rows.Err()
+}
+
+// showTimezonePrompt 显示时区设置提示和常用时区按钮
+func showTimezonePrompt(userID int64, messageID int) {
+	setUserState(userID, "set_timezone", messageID, nil)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var currentRow []tgbotapi.InlineKeyboardButton
+	for i, tz := range CommonTimezones {
+		currentRow = append(currentRow, tgbotapi.NewInlineKeyboardButtonData(tz, "set_tz_"+tz))
+		if len(currentRow) == 2 || i == len(CommonTimezones)-1 {
+			rows = append(rows, currentRow)
+			currentRow = nil
+		}
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+	))
+
+	text := "🌍 请选择常用时区，或直接输入IANA时区名称：\n\n📝 示例：Asia/Shanghai、Europe/Paris、America/Chicago"
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, text, &keyboard)
+}
+
+// showDateFormatOptions 显示时间格式选项
+func showDateFormatOptions(userID int64, messageID int) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, option := range DateFormatOptions {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(option.Example, fmt.Sprintf("set_datefmt_%d", i)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回设置", "settings"),
+	))
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	messageSender.SendResponse(userID, messageID, "📅 请选择时间显示格式：", &keyboard)
+}
+
+// setUserTimezone 设置用户时区
+func setUserTimezone(userID int64, messageID int, timezone string) {
+	timezone = strings.TrimSpace(timezone)
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		messageSender.SendError(userID, messageID, fmt.Sprintf("❌ 无效的时区: %s\n请输入IANA时区名称，如 Asia/Shanghai", timezone))
+		return
+	}
+
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"timezone": timezone}); err != nil {
+		logMessage("error", fmt.Sprintf("保存用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置时区失败，请稍后重试")
+		return
+	}
+
+	clearUserState(userID)
+	logMessage("info", fmt.Sprintf("用户时区已设置为 %s", timezone), userID)
+	showSettingsMenu(userID, messageID)
+}
+
+// setUserDateFormat 设置用户时间格式
+func setUserDateFormat(userID int64, messageID int, index int) {
+	if index < 0 || index >= len(DateFormatOptions) {
+		messageSender.SendError(userID, messageID, "❌ 无效的时间格式")
+		return
+	}
+
+	layout := DateFormatOptions[index].Layout
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"date_format": layout}); err != nil {
+		logMessage("error", fmt.Sprintf("保存用户设置失败: %v", err), userID)
+		messageSender.SendError(userID, messageID, "设置时间格式失败，请稍后重试")
+		return
+	}
+
+	showSettingsMenu(userID, messageID)
+}
+
+// handleTimezoneInput 处理用户输入的时区
+func handleTimezoneInput(message *tgbotapi.Message) {
+	setUserTimezone(message.Chat.ID, 0, message.Text)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateUserSettingFields(t *testing.T) {
+	setupTestDB(t)
+	const userID = 1
+
+	// 记录不存在时按默认值创建
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"timezone": "Asia/Tokyo"}); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := GetUserSettings(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Timezone != "Asia/Tokyo" || settings.DeliveryMode != DeliveryInstant ||
+		settings.DigestTime != DefaultDigestTime || settings.DigestWeekday != int(time.Monday) {
+		t.Errorf("settings = %+v, want Asia/Tokyo with defaults", settings)
+	}
+
+	// 同时修改不同的设置项，互不覆盖
+	var wg sync.WaitGroup
+	for _, fields := range []map[string]interface{}{
+		{"text_folding": true},
+		{"digest_ai_overview": true},
+		{"quiet_start": "23:00", "quiet_end": "07:00"},
+		{"dedup_window": 24},
+	} {
+		wg.Add(1)
+		go func(fields map[string]interface{}) {
+			defer wg.Done()
+			if err := UpdateUserSettingFields(userID, fields); err != nil {
+				t.Error(err)
+			}
+		}(fields)
+	}
+	wg.Wait()
+
+	settings, err = GetUserSettings(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.TextFolding || !settings.DigestAIOverview || settings.QuietStart != "23:00" ||
+		settings.QuietEnd != "07:00" || settings.DedupWindow != 24 || settings.Timezone != "Asia/Tokyo" {
+		t.Errorf("settings = %+v, want all updates kept", settings)
+	}
+
+	if err := UpdateUserSettingFields(userID, map[string]interface{}{"user_id": 2}); err == nil {
+		t.Error("UpdateUserSettingFields(user_id) succeeded, want error")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 中文归一化：NFKC 全角/半角折叠 + 繁体转简体，关键词和内容使用同一套规则转换
+// 拼音关键词使用 py: 前缀，例如 py:xianka 可匹配 "显卡"、"顯卡"
+
+// PinyinKeywordPrefix 拼音关键词前缀
+const PinyinKeywordPrefix = "py:"
+
+//go:embed dict/t2s.txt
+var t2sDictData string
+
+//go:embed dict/pinyin.txt
+var pinyinDictData string
+
+var (
+	t2sOnce    sync.Once
+	t2sTable   map[rune]rune
+	pinyinOnce sync.Once
+	pinyinMap  map[rune]string
+
+	pinyinKeywordPattern = regexp.MustCompile(`^[a-z]+$`)
+)
+
+// loadT2SDict 加载繁简对照表，每个词条为 繁体字+简体字
+func loadT2SDict() map[rune]rune {
+	t2sOnce.Do(func() {
+		t2sTable = make(map[rune]rune)
+		for _, line := range strings.Split(t2sDictData, "\n") {
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, pair := range strings.Fields(line) {
+				runes := []rune(pair)
+				if len(runes) == 2 {
+					t2sTable[runes[0]] = runes[1]
+				}
+			}
+		}
+	})
+	return t2sTable
+}
+
+// loadPinyinDict 加载拼音表，每行为 拼音 + 汉字列表，先出现的读音优先
+func loadPinyinDict() map[rune]string {
+	pinyinOnce.Do(func() {
+		pinyinMap = make(map[rune]string)
+		for _, line := range strings.Split(pinyinDictData, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, r := range fields[1] {
+				if _, ok := pinyinMap[r]; !ok {
+					pinyinMap[r] = fields[0]
+				}
+			}
+		}
+	})
+	return pinyinMap
+}
+
+// foldChineseText 对文本做 NFKC 折叠并将繁体字转换为简体字，不改变大小写
+func foldChineseText(s string) string {
+	table := loadT2SDict()
+	return strings.Map(func(r rune) rune {
+		if simplified, ok := table[r]; ok {
+			return simplified
+		}
+		return r
+	}, norm.NFKC.String(s))
+}
+
+// foldMessage 返回归一化后的消息副本，用于匹配
+func foldMessage(msg Message) Message {
+	folded := msg
+	folded.Title = foldChineseText(msg.Title)
+	folded.Description = foldChineseText(msg.Description)
+	folded.Author = foldChineseText(msg.Author)
+	folded.Categories = make([]string, len(msg.Categories))
+	for i, category := range msg.Categories {
+		folded.Categories[i] = foldChineseText(category)
+	}
+	return folded
+}
+
+// toPinyinText 将文本转换为拼音串：汉字替换为不带声调的拼音，
+// 字母数字转为小写保留，其余字符作为分隔
+func toPinyinText(s string) string {
+	table := loadPinyinDict()
+	var b strings.Builder
+	lastSpace := false
+	for _, r := range strings.ToLower(foldChineseText(s)) {
+		if py, ok := table[r]; ok {
+			b.WriteString(py)
+			lastSpace = false
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			lastSpace = false
+			continue
+		}
+		if !lastSpace {
+			b.WriteByte(' ')
+			lastSpace = true
+		}
+	}
+	return b.String()
+}
+
+// isPinyinKeyword 判断是否为 py: 前缀的拼音关键词
+func isPinyinKeyword(keyword string) bool {
+	return strings.HasPrefix(strings.ToLower(keyword), PinyinKeywordPrefix)
+}
+
+// pinyinKeywordText 返回拼音关键词的匹配内容，格式不正确时返回错误
+func pinyinKeywordText(keyword string) (string, error) {
+	text := strings.ToLower(keyword[len(PinyinKeywordPrefix):])
+	if !pinyinKeywordPattern.MatchString(text) {
+		return "", fmt.Errorf("拼音关键词只能包含字母，例如 py:xianka")
+	}
+	return text, nil
+}
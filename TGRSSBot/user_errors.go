@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UserErrorKind 用户操作失败的原因类别，API 据此返回对应的状态码
+type UserErrorKind int
+
+const (
+	UserErrorInvalid  UserErrorKind = iota // 输入有误或校验失败
+	UserErrorNotFound                      // 要操作的对象不存在
+	UserErrorConflict                      // 与已有内容重复
+	UserErrorQuota                         // 超出用户配额
+)
+
+// UserError 可以直接展示给用户的操作失败原因，与数据库等内部错误区分开
+type UserError struct {
+	Kind    UserErrorKind
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return e.Message
+}
+
+// newUserError 创建 UserError
+func newUserError(kind UserErrorKind, format string, args ...interface{}) *UserError {
+	return &UserError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// asUserError 判断错误是否为 UserError
+func asUserError(err error) (*UserError, bool) {
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		return userErr, true
+	}
+	return nil, false
+}
+
+// userErrorResult 把 UserError 转换为 Bot 中以 ❌ 开头的提示，其他错误原样返回
+func userErrorResult(result string, err error) (string, error) {
+	if userErr, ok := asUserError(err); ok {
+		return "❌ " + userErr.Message, nil
+	}
+	return result, err
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Webhook 模式：由 Telegram 主动推送更新到内置的 HTTP(S) 服务，替代长轮询
+// 启动时调用 setWebhook 注册地址和密钥，退出时调用 deleteWebhook
+// 每个请求都需带有 X-Telegram-Bot-Api-Secret-Token 头，与配置的密钥一致才会处理
+// 收到的更新与长轮询一样交给 dispatchUpdate 分发
+
+const (
+	webhookSecretHeader   = "X-Telegram-Bot-Api-Secret-Token"
+	webhookDefaultListen  = ":8443"
+	webhookMaxBodyBytes   = 1 << 20          // 单个更新请求体的最大字节数
+	webhookShutdownWait   = 10 * time.Second // 退出时等待请求处理完成的时间
+	webhookReadTimeout    = 30 * time.Second
+	webhookMaxConnections = 100 // Telegram 允许的最大并发连接数
+)
+
+// webhookAllowedUpdates 需要接收的更新类型，与 dispatchUpdate 处理的类型一致
+var webhookAllowedUpdates = []string{"message", "callback_query", "inline_query", "my_chat_member"}
+
+// webhookSecretPattern Telegram 对密钥的要求：1-256 个字母、数字、_ 或 -
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// WebhookConfig Webhook 模式配置
+type WebhookConfig struct {
+	Enabled        bool   `json:"enabled"`         // 是否启用 Webhook 模式，关闭时使用长轮询
+	Listen         string `json:"listen"`          // 本地监听地址，默认 :8443
+	URL            string `json:"url"`             // Telegram 访问的公网 HTTPS 地址
+	Path           string `json:"path"`            // 本地处理更新的路径，默认与 url 的路径相同
+	SecretToken    string `json:"secret_token"`    // 校验请求的密钥，留空时每次启动随机生成
+	CertFile       string `json:"cert_file"`       // TLS 证书文件，留空时以 HTTP 监听（由反向代理终止 TLS）
+	KeyFile        string `json:"key_file"`        // TLS 私钥文件
+	SelfSigned     bool   `json:"self_signed"`     // 证书为自签名时上传给 Telegram
+	MaxConnections int    `json:"max_connections"` // Telegram 的最大并发连接数，0 表示默认值
+	DropPending    bool   `json:"drop_pending"`    // 注册时丢弃积压的更新
+}
+
+// validateWebhookConfig 检查 Webhook 配置并补全默认值
+func validateWebhookConfig(cfg *WebhookConfig) error {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("无效的 Webhook 地址 %q", cfg.URL)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("Webhook 地址必须使用 https: %s", cfg.URL)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = webhookDefaultListen
+	}
+	if cfg.Path == "" {
+		cfg.Path = u.Path
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.Path[0] != '/' {
+		cfg.Path = "/" + cfg.Path
+	}
+	if cfg.SecretToken != "" && !webhookSecretPattern.MatchString(cfg.SecretToken) {
+		return fmt.Errorf("Webhook 密钥只能包含 1-256 个字母、数字、_ 或 -")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("Webhook 的 cert_file 和 key_file 需同时设置")
+	}
+	if cfg.SelfSigned && cfg.CertFile == "" {
+		return fmt.Errorf("Webhook 使用自签名证书时需设置 cert_file")
+	}
+	if cfg.MaxConnections < 0 || cfg.MaxConnections > webhookMaxConnections {
+		return fmt.Errorf("Webhook 的 max_connections 需在 0-%d 之间", webhookMaxConnections)
+	}
+	return nil
+}
+
+// webhookEnabled 是否使用 Webhook 模式
+func webhookEnabled() bool {
+	return globalConfig.Webhook != nil && globalConfig.Webhook.Enabled
+}
+
+// generateWebhookSecret 随机生成密钥
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// newWebhookHandler 校验密钥并解析更新，立即回应 Telegram 后异步分发
+func newWebhookHandler(secret string, dispatch func(tgbotapi.Update)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			logMessage("warn", fmt.Sprintf("拒绝密钥不匹配的 Webhook 请求: %s", r.RemoteAddr))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(io.LimitReader(r.Body, webhookMaxBodyBytes)).Decode(&update); err != nil {
+			logMessage("warn", fmt.Sprintf("解析 Webhook 更新失败: %v", err))
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		go dispatch(update)
+	})
+}
+
+// setWebhook 向 Telegram 注册 Webhook，库中的 WebhookConfig 不支持 secret_token，因此直接构造参数
+func setWebhook(cfg *WebhookConfig, secret string) error {
+	params := make(tgbotapi.Params)
+	params["url"] = cfg.URL
+	params["secret_token"] = secret
+	params.AddNonZero("max_connections", cfg.MaxConnections)
+	params.AddBool("drop_pending_updates", cfg.DropPending)
+	if err := params.AddInterface("allowed_updates", webhookAllowedUpdates); err != nil {
+		return err
+	}
+
+	var err error
+	if cfg.SelfSigned {
+		_, err = bot.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{
+			{Name: "certificate", Data: tgbotapi.FilePath(cfg.CertFile)},
+		})
+	} else {
+		_, err = bot.MakeRequest("setWebhook", params)
+	}
+	return err
+}
+
+// deleteWebhook 删除 Webhook，之后 Telegram 会把更新积压到下次启动
+func deleteWebhook() {
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		logMessage("warn", fmt.Sprintf("删除 Webhook 失败: %v", err))
+		return
+	}
+	logMessage("info", "已删除 Webhook")
+}
+
+// clearStaleWebhook 长轮询模式下清除上次遗留的 Webhook，否则 getUpdates 会一直失败
+func clearStaleWebhook() {
+	info, err := bot.GetWebhookInfo()
+	if err != nil {
+		logMessage("warn", fmt.Sprintf("获取 Webhook 信息失败: %v", err))
+		return
+	}
+	if info.URL == "" {
+		return
+	}
+	logMessage("info", fmt.Sprintf("检测到遗留的 Webhook %s，切换回长轮询", info.URL))
+	deleteWebhook()
+}
+
+// runWebhook 启动 Webhook 服务并阻塞，收到退出信号后删除 Webhook 并关闭服务
+func runWebhook(cfg *WebhookConfig) error {
+	secret := cfg.SecretToken
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return fmt.Errorf("生成 Webhook 密钥失败: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, newWebhookHandler(secret, dispatchUpdate))
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: webhookReadTimeout,
+		ReadTimeout:       webhookReadTimeout,
+	}
+
+	// 先监听端口，确认可用后再注册，避免 Telegram 推送到无法访问的地址
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %v", cfg.Listen, err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.CertFile != "" {
+			serveErr <- server.ServeTLS(listener, cfg.CertFile, cfg.KeyFile)
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+
+	seedWebhookErrorDate()
+	if err := setWebhook(cfg, secret); err != nil {
+		server.Close()
+		return fmt.Errorf("注册 Webhook 失败: %v", err)
+	}
+	logMessage("info", fmt.Sprintf("Webhook 模式已启动，监听 %s%s，公网地址 %s", cfg.Listen, cfg.Path, cfg.URL))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		logMessage("info", fmt.Sprintf("收到信号 %v，正在关闭 Webhook 服务", sig))
+	case err := <-serveErr:
+		deleteWebhook()
+		return fmt.Errorf("Webhook 服务异常退出: %v", err)
+	}
+
+	deleteWebhook()
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownWait)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("关闭 Webhook 服务失败: %v", err)
+	}
+	return nil
+}